@@ -0,0 +1,175 @@
+package ics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions of an alarm.
+const (
+	AlarmAudio   = "AUDIO"
+	AlarmDisplay = "DISPLAY"
+	AlarmEmail   = "EMAIL"
+)
+
+// Alarm is a reminder of an event or a todo, a VALARM component.
+//
+// An alarm is triggered Trigger after the start of each occurrence, or
+// after its end if RelatedEnd is true, so it is negative for alarms that
+// go off before. Alarms with an absolute TriggerTime go off at that time
+// instead. After being triggered the alarm repeats Repeat more times, once
+// every Duration.
+type Alarm struct {
+	Action      string
+	Trigger     time.Duration
+	RelatedEnd  bool
+	TriggerTime time.Time
+	Duration    time.Duration
+	Repeat      int
+	Summary     string
+	Description string
+	Attachments []Attachment
+	Attendees   []Attendee
+
+	// Component is the raw VALARM component the alarm was parsed from.
+	Component *Component
+}
+
+// FireTimes returns all the times the alarm goes off for the given
+// occurrence, in order. For todos the occurrence starts at the start of
+// the todo and ends when it is due; alarms related to the start of todos
+// without start are related to their due time.
+func (a Alarm) FireTimes(o Occurrence) []time.Time {
+	first := a.TriggerTime
+	if first.IsZero() {
+		related := o.Start
+		if (a.RelatedEnd && !o.End.IsZero()) || related.IsZero() {
+			related = o.End
+		}
+		first = related.Add(a.Trigger)
+	}
+
+	times := []time.Time{first}
+	if a.Duration > 0 {
+		for i := 1; i <= a.Repeat; i++ {
+			times = append(times, first.Add(time.Duration(i)*a.Duration))
+		}
+	}
+	return times
+}
+
+// parseAlarms parses all the VALARM components of the given component.
+func parseAlarms(data *Component, tz Timezones) ([]Alarm, error) {
+	var alarms []Alarm
+	for _, alarmData := range data.ChildrenNamed("VALARM") {
+		alarm, err := parseAlarm(alarmData, tz)
+		if err != nil {
+			return nil, err
+		}
+		alarmData.typed = alarmComponent(alarm)
+		alarms = append(alarms, *alarm)
+	}
+	return alarms, nil
+}
+
+func parseAlarm(alarmData *Component, tz Timezones) (*Alarm, error) {
+	alarm := &Alarm{
+		Action:      strings.ToUpper(alarmData.Value("ACTION")),
+		Summary:     unescapeText(alarmData.Value("SUMMARY")),
+		Description: unescapeText(alarmData.Value("DESCRIPTION")),
+		Attendees:   parseAttendees(alarmData),
+		Component:   alarmData,
+	}
+
+	// Alarms without TRIGGER, which some clients write, go off at the
+	// start of each occurrence.
+	trigger := alarmData.Property("TRIGGER")
+	switch {
+	case trigger == nil:
+	case strings.EqualFold(trigger.Params.Get("VALUE"), "DATE-TIME"):
+		t, err := parseDatetime(trigger.Value, "", tz)
+		if err != nil {
+			return nil, err
+		}
+		alarm.TriggerTime = t.Time
+	default:
+		d, err := parseDuration(trigger.Value)
+		if err != nil {
+			return nil, err
+		}
+		alarm.Trigger = d
+		alarm.RelatedEnd = strings.EqualFold(trigger.Params.Get("RELATED"), "END")
+	}
+
+	if v := alarmData.Value("DURATION"); v != "" {
+		d, err := parseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		alarm.Duration = d
+	}
+
+	alarm.Repeat, _ = strconv.Atoi(alarmData.Value("REPEAT"))
+
+	var err error
+	alarm.Attachments, err = parseAttachments(alarmData)
+	if err != nil {
+		return nil, err
+	}
+
+	return alarm, nil
+}
+
+// alarmTime returns the trigger of the first alarm relative to the start
+// of the occurrences, which is the AlarmTime of events.
+func alarmTime(alarms []Alarm) time.Duration {
+	for _, a := range alarms {
+		if a.TriggerTime.IsZero() && !a.RelatedEnd {
+			return a.Trigger
+		}
+	}
+	return 0
+}
+
+// alarmComponent returns the VALARM component for the alarm.
+func alarmComponent(a *Alarm) *Component {
+	c := NewComponent("VALARM")
+	c.origin = a.Component
+	c.Add(&Property{Name: "ACTION", Value: a.Action})
+
+	trigger := &Property{Name: "TRIGGER"}
+	if !a.TriggerTime.IsZero() {
+		trigger.Params.Set("VALUE", "DATE-TIME")
+		trigger.Value = a.TriggerTime.UTC().Format(icsFormat)
+	} else {
+		if a.RelatedEnd {
+			trigger.Params.Set("RELATED", "END")
+		}
+		trigger.Value = formatDuration(a.Trigger)
+	}
+	c.Add(trigger)
+
+	if a.Repeat > 0 {
+		c.Add(&Property{Name: "DURATION", Value: formatDuration(a.Duration)})
+		c.Add(&Property{Name: "REPEAT", Value: strconv.Itoa(a.Repeat)})
+	}
+
+	if a.Summary != "" {
+		c.Add(textProperty("SUMMARY", a.Summary))
+	}
+
+	if a.Description != "" {
+		c.Add(textProperty("DESCRIPTION", a.Description))
+	}
+
+	for _, attachment := range a.Attachments {
+		c.Add(attachmentProperty(attachment))
+	}
+
+	for _, attendee := range a.Attendees {
+		c.Add(attendeeProperty("ATTENDEE", attendee))
+	}
+
+	return c
+}
@@ -0,0 +1,218 @@
+package ics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAlarms = strings.Join([]string{
+	"BEGIN:VCALENDAR",
+	"BEGIN:VEVENT",
+	"UID:meeting",
+	"DTSTART:20160704T100000Z",
+	"DTEND:20160704T110000Z",
+	"SUMMARY:Meeting",
+	"BEGIN:VALARM",
+	"ACTION:DISPLAY",
+	"TRIGGER:-PT15M",
+	"DURATION:PT5M",
+	"REPEAT:2",
+	"DESCRIPTION:Meeting soon",
+	"END:VALARM",
+	"BEGIN:VALARM",
+	"ACTION:EMAIL",
+	"TRIGGER;RELATED=END:PT0S",
+	"SUMMARY:Meeting over",
+	"DESCRIPTION:Write the minutes",
+	"ATTENDEE;CN=John:mailto:john@example.com",
+	"END:VALARM",
+	"END:VEVENT",
+	"BEGIN:VTODO",
+	"UID:report",
+	"DUE:20160705T170000Z",
+	"BEGIN:VALARM",
+	"ACTION:AUDIO",
+	"TRIGGER;VALUE=DATE-TIME:20160705T090000Z",
+	"END:VALARM",
+	"BEGIN:VALARM",
+	"ACTION:DISPLAY",
+	"TRIGGER:-P1D",
+	"DESCRIPTION:Report due tomorrow",
+	"END:VALARM",
+	"END:VTODO",
+	"END:VCALENDAR",
+	"",
+}, "\r\n")
+
+func TestParseAlarms(t *testing.T) {
+	cal, err := ParseICalContent(testAlarms, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := cal.Events[0]
+	if len(event.Alarms) != 2 {
+		t.Fatalf("expected 2 alarms, got %d", len(event.Alarms))
+	}
+
+	if event.AlarmTime != -15*time.Minute {
+		t.Errorf("expected alarm time of -15m, got %s", event.AlarmTime)
+	}
+
+	display, email := event.Alarms[0], event.Alarms[1]
+	if display.Action != AlarmDisplay || display.Trigger != -15*time.Minute || display.Duration != 5*time.Minute || display.Repeat != 2 {
+		t.Errorf("unexpected alarm %+v", display)
+	}
+
+	if email.Action != AlarmEmail || !email.RelatedEnd || email.Summary != "Meeting over" ||
+		len(email.Attendees) != 1 || email.Attendees[0].Email != "john@example.com" {
+		t.Errorf("unexpected alarm %+v", email)
+	}
+
+	todo := cal.Todos[0]
+	if len(todo.Alarms) != 2 {
+		t.Fatalf("expected 2 alarms, got %d", len(todo.Alarms))
+	}
+
+	if !todo.Alarms[0].TriggerTime.Equal(time.Date(2016, time.July, 5, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected absolute trigger, got %s", todo.Alarms[0].TriggerTime)
+	}
+}
+
+func TestAlarmFireTimes(t *testing.T) {
+	cal, err := ParseICalContent(testAlarms, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := func(day, hour, min int) time.Time {
+		return time.Date(2016, time.July, day, hour, min, 0, 0, time.UTC)
+	}
+
+	meeting := Occurrence{Start: date(4, 10, 0), End: date(4, 11, 0)}
+	report := Occurrence{End: date(5, 17, 0)}
+	cases := []struct {
+		alarm      Alarm
+		occurrence Occurrence
+		expected   []time.Time
+	}{
+		{cal.Events[0].Alarms[0], meeting, []time.Time{date(4, 9, 45), date(4, 9, 50), date(4, 9, 55)}},
+		{cal.Events[0].Alarms[1], meeting, []time.Time{date(4, 11, 0)}},
+		{cal.Todos[0].Alarms[0], report, []time.Time{date(5, 9, 0)}},
+		{cal.Todos[0].Alarms[1], report, []time.Time{date(4, 17, 0)}},
+	}
+
+	for i, c := range cases {
+		times := c.alarm.FireTimes(c.occurrence)
+		if len(times) != len(c.expected) {
+			t.Errorf("%d: expected %v, got %v", i, c.expected, times)
+			continue
+		}
+
+		for j := range times {
+			if !times[j].Equal(c.expected[j]) {
+				t.Errorf("%d: expected %v, got %v", i, c.expected, times)
+				break
+			}
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	cases := []struct {
+		value    string
+		duration time.Duration
+		format   string
+	}{
+		{"PT15M", 15 * time.Minute, "PT15M"},
+		{"-PT15M", -15 * time.Minute, "-PT15M"},
+		{"+P1D", 24 * time.Hour, "P1D"},
+		{"P2W", 14 * 24 * time.Hour, "P2W"},
+		{"P1DT2H3M4S", 26*time.Hour + 3*time.Minute + 4*time.Second, "P1DT2H3M4S"},
+		{"PT1H30S", time.Hour + 30*time.Second, "PT1H0M30S"},
+		{"PT0S", 0, "PT0S"},
+	}
+
+	for _, c := range cases {
+		d, err := parseDuration(c.value)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", c.value, err)
+			continue
+		}
+
+		if d != c.duration {
+			t.Errorf("%s: expected %s, got %s", c.value, c.duration, d)
+		}
+
+		if f := formatDuration(d); f != c.format {
+			t.Errorf("%s: expected to be formatted as %s, got %s", c.value, c.format, f)
+		}
+	}
+
+	for _, v := range []string{"", "15M", "PT", "P1H", "PT1D", "PTXM"} {
+		if _, err := parseDuration(v); err == nil {
+			t.Errorf("%q: expected an error", v)
+		}
+	}
+}
+
+func TestEncodeAlarms(t *testing.T) {
+	cal, err := ParseICalContent(testAlarms, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := cal.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []string{
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-PT15M\r\nDURATION:PT5M\r\nREPEAT:2\r\n",
+		"TRIGGER;RELATED=END:PT0S\r\n",
+		"TRIGGER;VALUE=DATE-TIME:20160705T090000Z\r\n",
+		"TRIGGER:-P1D\r\n",
+	} {
+		if !strings.Contains(buf.String(), e) {
+			t.Errorf("expected output to contain %q:\n%s", e, buf.String())
+		}
+	}
+
+	result, err := ParseICalContent(buf.String(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Events[0].Alarms) != 2 || len(result.Todos[0].Alarms) != 2 {
+		t.Errorf("expected alarms to be written")
+	}
+}
+
+func TestRoundTripAlarms(t *testing.T) {
+	cal, err := ParseICalContent(testAlarms, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out := encodeRoundTrip(t, &cal); out != testAlarms {
+		t.Errorf("expected output to be identical to the input, got:\n%s", out)
+	}
+
+	cal.Events[0].Alarms[0].Trigger = -30 * time.Minute
+	cal.Todos[0].Alarms = cal.Todos[0].Alarms[1:]
+
+	out := encodeRoundTrip(t, &cal)
+	if !strings.Contains(out, "ACTION:DISPLAY\r\nTRIGGER:-PT30M\r\nDURATION:PT5M\r\nREPEAT:2\r\nDESCRIPTION:Meeting soon\r\nEND:VALARM") {
+		t.Errorf("expected modified alarm to be written, got:\n%s", out)
+	}
+
+	if !strings.Contains(out, "TRIGGER;RELATED=END:PT0S\r\n") {
+		t.Errorf("expected unchanged alarm to be kept, got:\n%s", out)
+	}
+
+	if strings.Contains(out, "ACTION:AUDIO") {
+		t.Errorf("expected removed alarm not to be written, got:\n%s", out)
+	}
+}
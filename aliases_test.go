@@ -0,0 +1,76 @@
+package ics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWindowsZones(t *testing.T) {
+	for alias, name := range windowsZones {
+		if _, err := time.LoadLocation(name); err != nil {
+			t.Errorf("%s: %s", alias, err)
+		}
+	}
+}
+
+func TestTimezonesLocationAliases(t *testing.T) {
+	cases := map[string]string{
+		"W. Europe Standard Time":                         "Europe/Berlin",
+		"eastern standard time":                           "America/New_York",
+		"/mozilla.org/20050126_1/Europe/Berlin":           "Europe/Berlin",
+		"/softwarestudio.org/Olson_20011030_5/Asia/Tokyo": "Asia/Tokyo",
+		"/example.com/1/Tokyo Standard Time":              "Asia/Tokyo",
+		"Europe/Madrid":                                   "Europe/Madrid",
+	}
+
+	var tz Timezones
+	for tzid, expected := range cases {
+		loc, err := tz.Location(tzid)
+		if err != nil {
+			t.Errorf("%s: %s", tzid, err)
+		} else if loc.String() != expected {
+			t.Errorf("expected %s to resolve to %s, got %s", tzid, expected, loc)
+		}
+	}
+
+	if _, err := tz.Location("/example.com/Nowhere"); err == nil {
+		t.Errorf("expected error resolving unknown time zone")
+	}
+}
+
+func TestRegisterTimezoneAlias(t *testing.T) {
+	if err := RegisterTimezoneAlias("Central Europe", "Europe/Paris"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RegisterTimezoneAlias("Somewhere", "Nowhere/Unknown"); err == nil {
+		t.Errorf("expected error registering alias of unknown time zone")
+	}
+
+	content := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:1",
+		`DTSTART;TZID="Central Europe":20160704T100000`,
+		`DTEND;TZID="Central Europe":20160704T110000`,
+		`EXDATE;TZID="W. Europe Standard Time":20160711T100000`,
+		"RRULE:FREQ=WEEKLY;COUNT=3",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	cal, err := ParseICalContent(content, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := cal.Events[0]
+	if e.Start.Location().String() != "Europe/Paris" {
+		t.Errorf("expected start in Europe/Paris, got %s", e.Start.Location())
+	}
+
+	if len(e.ExDates) != 1 || !e.ExDates[0].Equal(time.Date(2016, time.July, 11, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected excluded date to be resolved, got %v", e.ExDates)
+	}
+}
@@ -7,4 +7,23 @@ type Attendee struct {
 	Status string
 	Role   string
 	Type   string
+
+	// Params are the parameters of the attendee that are not mapped to any
+	// field, such as vendor extensions, which are written back as they are.
+	Params Params
+}
+
+// ReplyStampParam is the parameter of the attendees of stored events with
+// the DTSTAMP of their last reply, which the itip package keeps to reject
+// replies that arrive out of order. It is written with the events that
+// have it, except in calendars with a REQUEST or REPLY method, as it only
+// means something to the calendar the events are stored in.
+const ReplyStampParam = "X-REPLY-DTSTAMP"
+
+// attendeeParams are the parameters of attendees mapped to their fields.
+var attendeeParams = map[string]bool{
+	"CN":       true,
+	"ROLE":     true,
+	"PARTSTAT": true,
+	"CUTYPE":   true,
 }
@@ -0,0 +1,391 @@
+package ics
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Availability is the time in which someone is available, a VAVAILABILITY
+// component, such as their working hours. Between Start and End, which are
+// zero if the availability has no start or end, they are busy with the
+// type of BusyType, BUSY-UNAVAILABLE by default, except during the
+// occurrences of the Available time.
+//
+// When several availabilities overlap, the one with the highest Priority
+// wins, 1 being the highest and 9 the lowest. Priority 0, which is the
+// default, is lower than all the others.
+type Availability struct {
+	Start     time.Time
+	End       time.Time
+	DTStart   DateTime
+	DTEnd     DateTime
+	Created   time.Time
+	Modified  time.Time
+	ID        string
+	Summary   string
+	Location  string
+	BusyType  string
+	Priority  int
+	Sequence  int
+	Organizer Attendee
+	Available []Available
+
+	// Component is the raw VAVAILABILITY component the availability was
+	// parsed from.
+	Component *Component
+}
+
+// Available is a time in which someone is available, an AVAILABLE
+// component, which can repeat like events do. Like events, the ones with a
+// RecurrenceID override an instance of the repeating one with the same ID.
+type Available struct {
+	Start        time.Time
+	End          time.Time
+	DTStart      DateTime
+	DTEnd        DateTime
+	ID           string
+	Summary      string
+	Location     string
+	RRule        string
+	RDates       []time.Time
+	ExDates      []time.Time
+	RecurrenceID time.Time
+
+	// Component is the raw AVAILABLE component the time was parsed from.
+	Component *Component
+}
+
+// NewAvailability returns a new empty Availability entity
+func NewAvailability() *Availability {
+	return &Availability{
+		BusyType: FreeBusyUnavailable,
+	}
+}
+
+// IsAvailable reports whether t is in one of the available times of the
+// availability.
+func (a *Availability) IsAvailable(t time.Time) bool {
+	for _, p := range a.Intervals(t, t.Add(time.Nanosecond)) {
+		if !t.Before(p.Start) && t.Before(p.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// Intervals returns the available time of the availability between from
+// and to, with the available times expanded, clipped to the time window
+// and to the start and end of the availability and with the overlapping
+// ones merged, in order. If to is zero the window has no end, so the
+// availability must have one or its available times must not repeat
+// forever.
+func (a *Availability) Intervals(from, to time.Time) []Period {
+	if !a.Start.IsZero() && a.Start.After(from) {
+		from = a.Start
+	}
+
+	if !a.End.IsZero() && (to.IsZero() || a.End.Before(to)) {
+		to = a.End
+	}
+
+	overrides := make(map[string]map[int64]*Available)
+	for i := range a.Available {
+		av := &a.Available[i]
+		if av.RecurrenceID.IsZero() {
+			continue
+		}
+
+		if overrides[av.ID] == nil {
+			overrides[av.ID] = make(map[int64]*Available)
+		}
+		overrides[av.ID][av.RecurrenceID.Unix()] = av
+	}
+
+	var periods []Period
+	add := func(start, end time.Time) {
+		if start.Before(from) {
+			start = from
+		}
+
+		if !to.IsZero() && end.After(to) {
+			end = to
+		}
+
+		if start.Before(end) {
+			periods = append(periods, Period{Start: start, End: end, Type: FreeBusyFree})
+		}
+	}
+
+	for i := range a.Available {
+		av := &a.Available[i]
+		if !av.RecurrenceID.IsZero() {
+			add(av.Start, av.End)
+			continue
+		}
+
+		duration := av.End.Sub(av.Start)
+		next := recurrenceStarts(av.Start, av.RRule, av.RDates, av.ExDates)
+		for {
+			start, ok := next()
+			if !ok || (!to.IsZero() && !start.Before(to)) {
+				break
+			}
+
+			if _, ok := overrides[av.ID][start.Unix()]; !ok {
+				add(start, start.Add(duration))
+			}
+		}
+	}
+
+	return mergePeriods(periods)
+}
+
+// unavailable returns the time between from and to in which the
+// availabilities of the calendar make its owner busy, with the type of
+// busy time they define, in order.
+func (c *Calendar) unavailable(from, to time.Time) []Period {
+	availabilities := make([]*Availability, len(c.Availabilities))
+	for i := range c.Availabilities {
+		availabilities[i] = &c.Availabilities[i]
+	}
+
+	// the ones with lower priority go first, so the ones with higher
+	// priority replace them
+	rank := func(priority int) int {
+		if priority == 0 {
+			return 10
+		}
+		return priority
+	}
+	sort.SliceStable(availabilities, func(i, j int) bool {
+		return rank(availabilities[i].Priority) > rank(availabilities[j].Priority)
+	})
+
+	var result []Period
+	for _, a := range availabilities {
+		span := Period{Start: from, End: to}
+		if !a.Start.IsZero() && a.Start.After(span.Start) {
+			span.Start = a.Start
+		}
+
+		if !a.End.IsZero() && (span.End.IsZero() || a.End.Before(span.End)) {
+			span.End = a.End
+		}
+
+		if span.End.IsZero() || !span.Start.Before(span.End) {
+			continue
+		}
+
+		busy := subtractPeriods([]Period{span}, a.Intervals(span.Start, span.End))
+		for i := range busy {
+			busy[i].Type = a.BusyType
+		}
+
+		result = append(subtractPeriods(result, []Period{span}), busy...)
+		sort.SliceStable(result, func(i, j int) bool {
+			return result[i].Start.Before(result[j].Start)
+		})
+	}
+	return result
+}
+
+func parseAvailabilities(cal *Calendar, availabilitiesData []*Component) error {
+	for _, availabilityData := range availabilitiesData {
+		var err error
+		availability := NewAvailability()
+		availability.Component = availabilityData
+
+		availability.DTStart, availability.DTEnd, err = parseAvailabilityDates(availabilityData, cal.Timezones)
+		if err != nil {
+			return err
+		}
+
+		for _, availableData := range availabilityData.ChildrenNamed("AVAILABLE") {
+			available, err := parseAvailable(cal, availableData)
+			if err != nil {
+				return err
+			}
+			availability.Available = append(availability.Available, *available)
+		}
+
+		if busyType := availabilityData.Value("BUSYTYPE"); busyType != "" {
+			availability.BusyType = busyType
+		}
+
+		availability.Start = availability.DTStart.In(cal.Timezone)
+		availability.End = availability.DTEnd.In(cal.Timezone)
+		availability.ID = parseUID(availabilityData)
+		availability.Summary = parseSummary(availabilityData)
+		availability.Location = parseLocation(availabilityData)
+		availability.Priority = parseTodoPriority(availabilityData)
+		availability.Sequence = parseSequence(availabilityData)
+		availability.Created = parseCreated(availabilityData)
+		availability.Modified = parseModified(availabilityData)
+		availability.Organizer = parseOrganizer(availabilityData)
+		availabilityData.typed = availabilityComponent(availability)
+		cal.Availabilities = append(cal.Availabilities, *availability)
+	}
+
+	return nil
+}
+
+func parseAvailable(cal *Calendar, availableData *Component) (*Available, error) {
+	var err error
+	available := &Available{Component: availableData}
+	available.DTStart, available.DTEnd, err = parseAvailabilityDates(availableData, cal.Timezones)
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions, err := parseExcludedDates(availableData, cal.Timezones)
+	if err != nil {
+		return nil, err
+	}
+
+	rdates, err := parseRecurrenceDates(availableData, cal.Timezones)
+	if err != nil {
+		return nil, err
+	}
+
+	recurrenceID, err := parseRecurrenceID(availableData, cal.Timezones)
+	if err != nil {
+		return nil, err
+	}
+
+	available.Start = available.DTStart.In(cal.Timezone)
+	available.End = available.DTEnd.In(cal.Timezone)
+	available.ExDates = resolveDates(exclusions, cal.Timezone)
+	available.RDates = resolveDates(rdates, cal.Timezone)
+	available.RecurrenceID = recurrenceID.In(cal.Timezone)
+	available.ID = parseUID(availableData)
+	available.Summary = parseSummary(availableData)
+	available.Location = parseLocation(availableData)
+	available.RRule = parseRRule(availableData)
+	return available, nil
+}
+
+// parseAvailabilityDates parses the start and end of an availability or an
+// available time, whose end can be given by a DURATION instead of DTEND.
+func parseAvailabilityDates(data *Component, tz Timezones) (DateTime, DateTime, error) {
+	start, err := parseDateProperty("DTSTART", data, tz)
+	if err != nil {
+		return DateTime{}, DateTime{}, err
+	}
+
+	end, err := parseDateProperty("DTEND", data, tz)
+	if err != nil {
+		return DateTime{}, DateTime{}, err
+	}
+
+	if v := data.Value("DURATION"); v != "" && end.IsZero() && !start.IsZero() {
+		d, err := parseDuration(v)
+		if err != nil {
+			return DateTime{}, DateTime{}, err
+		}
+
+		end = start
+		end.Time = start.Time.Add(d)
+	}
+
+	return start, end, nil
+}
+
+// availabilityComponent returns the VAVAILABILITY component for the
+// availability, with an AVAILABLE component for each available time.
+func availabilityComponent(a *Availability) *Component {
+	c := NewComponent("VAVAILABILITY")
+	c.origin = a.Component
+	c.Add(&Property{Name: "UID", Value: a.ID})
+	addStamp(c, a.Component)
+
+	date := a.DTStart.Kind == Date
+	if !a.Start.IsZero() {
+		c.Add(timeProperty("DTSTART", dateTimeValue(a.Start, a.DTStart, date)))
+	}
+
+	if !a.End.IsZero() {
+		c.Add(timeProperty("DTEND", dateTimeValue(a.End, a.DTEnd, date)))
+	}
+
+	if a.BusyType != "" && a.BusyType != FreeBusyUnavailable {
+		c.Add(&Property{Name: "BUSYTYPE", Value: a.BusyType})
+	}
+
+	if a.Priority != 0 {
+		c.Add(&Property{Name: "PRIORITY", Value: strconv.Itoa(a.Priority)})
+	}
+
+	if !a.Created.IsZero() {
+		c.Add(&Property{Name: "CREATED", Value: a.Created.UTC().Format(icsFormat)})
+	}
+
+	if !a.Modified.IsZero() {
+		c.Add(&Property{Name: "LAST-MODIFIED", Value: a.Modified.UTC().Format(icsFormat)})
+	}
+
+	if a.Sequence != 0 {
+		c.Add(&Property{Name: "SEQUENCE", Value: strconv.Itoa(a.Sequence)})
+	}
+
+	if a.Summary != "" {
+		c.Add(textProperty("SUMMARY", a.Summary))
+	}
+
+	if a.Location != "" {
+		c.Add(textProperty("LOCATION", a.Location))
+	}
+
+	if a.Organizer.Email != "" || a.Organizer.Name != "" {
+		c.Add(attendeeProperty("ORGANIZER", a.Organizer))
+	}
+
+	for i := range a.Available {
+		c.Children = append(c.Children, availableComponent(&a.Available[i]))
+	}
+
+	return c
+}
+
+// availableComponent returns the AVAILABLE component for an available time.
+func availableComponent(av *Available) *Component {
+	c := NewComponent("AVAILABLE")
+	c.origin = av.Component
+	c.Add(&Property{Name: "UID", Value: av.ID})
+	addStamp(c, av.Component)
+
+	date := av.DTStart.Kind == Date
+	if !av.Start.IsZero() {
+		c.Add(timeProperty("DTSTART", dateTimeValue(av.Start, av.DTStart, date)))
+	}
+
+	if !av.End.IsZero() {
+		c.Add(timeProperty("DTEND", dateTimeValue(av.End, av.DTEnd, date)))
+	}
+
+	if !av.RecurrenceID.IsZero() {
+		c.Add(timeProperty("RECURRENCE-ID", dateTimeValue(av.RecurrenceID, av.DTStart, date)))
+	}
+
+	if av.RRule != "" {
+		c.Add(&Property{Name: "RRULE", Value: av.RRule})
+	}
+
+	for _, rdate := range av.RDates {
+		c.Add(timeProperty("RDATE", dateTimeValue(rdate, av.DTStart, date)))
+	}
+
+	for _, exdate := range av.ExDates {
+		c.Add(timeProperty("EXDATE", dateTimeValue(exdate, av.DTStart, date)))
+	}
+
+	if av.Summary != "" {
+		c.Add(textProperty("SUMMARY", av.Summary))
+	}
+
+	if av.Location != "" {
+		c.Add(textProperty("LOCATION", av.Location))
+	}
+
+	return c
+}
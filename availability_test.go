@@ -0,0 +1,214 @@
+package ics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAvailability = strings.Join([]string{
+	"BEGIN:VCALENDAR",
+	"VERSION:2.0",
+	"PRODID:-//example.com//iCalendar 2.0//EN",
+	"BEGIN:VAVAILABILITY",
+	"UID:office-hours@example.com",
+	"DTSTAMP:20160701T000000Z",
+	"DTSTART;TZID=America/New_York:20160701T000000",
+	"SUMMARY:Office hours",
+	"BEGIN:AVAILABLE",
+	"UID:weekdays@example.com",
+	"DTSTAMP:20160701T000000Z",
+	"DTSTART;TZID=America/New_York:20160704T090000",
+	"DTEND;TZID=America/New_York:20160704T170000",
+	"RRULE:FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR",
+	"EXDATE;TZID=America/New_York:20160706T090000",
+	"SUMMARY:Monday to Friday from 9:00 to 17:00",
+	"END:AVAILABLE",
+	"BEGIN:AVAILABLE",
+	"UID:weekdays@example.com",
+	"DTSTAMP:20160701T000000Z",
+	"RECURRENCE-ID;TZID=America/New_York:20160705T090000",
+	"DTSTART;TZID=America/New_York:20160705T120000",
+	"DURATION:PT4H",
+	"END:AVAILABLE",
+	"END:VAVAILABILITY",
+	"BEGIN:VAVAILABILITY",
+	"UID:holiday@example.com",
+	"DTSTAMP:20160701T000000Z",
+	"DTSTART;TZID=America/New_York:20160708T000000",
+	"DTEND;TZID=America/New_York:20160709T000000",
+	"BUSYTYPE:BUSY",
+	"PRIORITY:1",
+	"END:VAVAILABILITY",
+	"END:VCALENDAR",
+	"",
+}, "\r\n")
+
+func TestParseAvailability(t *testing.T) {
+	cal, err := ParseICalContent(testAvailability, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cal.Availabilities) != 2 {
+		t.Fatalf("expected 2 availabilities, got %d", len(cal.Availabilities))
+	}
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.FailNow()
+	}
+
+	office, holiday := cal.Availabilities[0], cal.Availabilities[1]
+	if office.Summary != "Office hours" || office.BusyType != FreeBusyUnavailable || office.Priority != 0 || !office.End.IsZero() {
+		t.Errorf("unexpected availability %+v", office)
+	}
+
+	if holiday.BusyType != FreeBusyBusy || holiday.Priority != 1 || !holiday.End.Equal(time.Date(2016, time.July, 9, 0, 0, 0, 0, newYork)) {
+		t.Errorf("unexpected availability %+v", holiday)
+	}
+
+	if len(office.Available) != 2 {
+		t.Fatalf("expected 2 available times, got %d", len(office.Available))
+	}
+
+	override := office.Available[1]
+	if !override.End.Equal(time.Date(2016, time.July, 5, 16, 0, 0, 0, newYork)) || override.RecurrenceID.IsZero() {
+		t.Errorf("unexpected available time %+v", override)
+	}
+}
+
+func TestAvailabilityIntervals(t *testing.T) {
+	cal, err := ParseICalContent(testAvailability, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.FailNow()
+	}
+
+	date := func(day, hour int) time.Time {
+		return time.Date(2016, time.July, day, hour, 0, 0, 0, newYork)
+	}
+
+	office := &cal.Availabilities[0]
+	expected := []Period{
+		{date(4, 10), date(4, 17), FreeBusyFree},
+		{date(5, 12), date(5, 16), FreeBusyFree},
+		{date(7, 9), date(7, 17), FreeBusyFree},
+		{date(8, 9), date(8, 12), FreeBusyFree},
+	}
+
+	assertPeriodsEqual(t, expected, office.Intervals(date(4, 10), date(8, 12)))
+
+	for _, c := range []struct {
+		t         time.Time
+		available bool
+	}{
+		{date(4, 9), true},
+		{date(4, 17), false},
+		{date(5, 10), false},
+		{date(5, 15), true},
+		{date(6, 10), false},
+		{date(9, 10), false},
+		{date(11, 16), true},
+	} {
+		if office.IsAvailable(c.t) != c.available {
+			t.Errorf("expected availability at %s to be %v", c.t, c.available)
+		}
+	}
+}
+
+func TestCalendarFreeBusyAvailability(t *testing.T) {
+	cal, err := ParseICalContent(testAvailability, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.FailNow()
+	}
+
+	date := func(day, hour int) time.Time {
+		return time.Date(2016, time.July, day, hour, 0, 0, 0, newYork)
+	}
+
+	event := NewEvent()
+	event.ID = "lunch"
+	event.Start, event.End = date(7, 12), date(7, 13)
+	cal.Events = append(cal.Events, *event)
+
+	fb := cal.FreeBusy(date(6, 0), date(9, 0))
+	expected := []Period{
+		{date(6, 0), date(7, 9), FreeBusyUnavailable},
+		{date(7, 12), date(7, 13), FreeBusyBusy},
+		{date(7, 17), date(8, 0), FreeBusyUnavailable},
+		{date(8, 0), date(9, 0), FreeBusyBusy},
+	}
+
+	assertPeriodsEqual(t, expected, fb.Periods)
+
+	slots := FindSlots([]Participant{{Calendar: &cal}}, SlotSearch{
+		From:     date(6, 0),
+		To:       date(9, 0),
+		Duration: 3 * time.Hour,
+		Step:     time.Hour,
+	})
+
+	if len(slots) != 3 || !slots[0].Start.Equal(date(7, 9)) || !slots[1].Start.Equal(date(7, 13)) || !slots[2].Start.Equal(date(7, 14)) {
+		t.Errorf("expected slots out of the busy time, got %v", slots)
+	}
+}
+
+func TestEncodeAvailability(t *testing.T) {
+	cal, err := ParseICalContent(testAvailability, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := cal.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []string{
+		"BEGIN:AVAILABLE\r\nUID:weekdays@example.com\r\nDTSTAMP:20160701T000000Z\r\nDTSTART;TZID=America/New_York:20160704T090000\r\n",
+		"DTEND;TZID=America/New_York:20160705T160000\r\n",
+		"BUSYTYPE:BUSY\r\nPRIORITY:1\r\n",
+	} {
+		if !strings.Contains(buf.String(), e) {
+			t.Errorf("expected output to contain %q:\n%s", e, buf.String())
+		}
+	}
+
+	if strings.Contains(buf.String(), "BUSYTYPE:BUSY-UNAVAILABLE") {
+		t.Errorf("expected default busy type not to be written")
+	}
+}
+
+func TestRoundTripAvailability(t *testing.T) {
+	cal, err := ParseICalContent(testAvailability, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out := encodeRoundTrip(t, &cal); out != testAvailability {
+		t.Errorf("expected output to be identical to the input, got:\n%s", out)
+	}
+
+	cal.Availabilities[0].Available = cal.Availabilities[0].Available[:1]
+	cal.Availabilities[0].Available[0].RRule = "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH"
+
+	out := encodeRoundTrip(t, &cal)
+	if strings.Contains(out, "DURATION:PT4H") {
+		t.Errorf("expected removed available time not to be written, got:\n%s", out)
+	}
+
+	if !strings.Contains(out, "RRULE:FREQ=WEEKLY;BYDAY=MO,TU,WE,TH\r\nEXDATE") {
+		t.Errorf("expected modified available time to be written, got:\n%s", out)
+	}
+}
@@ -0,0 +1,419 @@
+// Package caldav implements the CalDAV protocol, as defined in RFC 4791,
+// with a client to read and write the calendars of a server:
+//
+//	client, err := caldav.NewClient("https://example.com/dav/", nil)
+//	if err != nil {
+//		// handle error
+//	}
+//	client.SetBasicAuth("alice", "secret")
+//
+//	calendars, err := client.FindCalendars(ctx)
+//	objects, err := client.QueryCalendar(ctx, calendars[0].Path, caldav.Query{
+//		Start: from,
+//		End:   to,
+//	})
+//
+// And a handler that serves calendars to CalDAV clients, such as Apple
+// Calendar or Thunderbird:
+//
+//	handler := caldav.NewHandler(caldav.NewMemoryStorage())
+//	handler.Prefix = "/dav"
+//	http.Handle("/dav/", handler)
+//
+// Every calendar object is a resource of its own, with an ics file with one
+// event, or the overrides of the occurrences of one repeating event.
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/erizocosmico/go-ics"
+)
+
+// Collection is a calendar collection of a server.
+type Collection struct {
+	Path        string
+	Name        string
+	Description string
+	// Components are the components the calendar can have, such as VEVENT
+	// or VTODO. Any component can be stored if it is empty.
+	Components []string
+	// CTag changes every time the calendar changes, in the servers that
+	// support it.
+	CTag string
+	// SyncToken is the token of the current state of the calendar, in the
+	// servers that support incremental synchronization.
+	SyncToken string
+}
+
+// Object is a calendar object resource, an ics file stored in a calendar
+// collection.
+type Object struct {
+	Path string
+	ETag string
+	// Data is the content of the ics file, which servers return as it was
+	// written, so it only changes, and its ETag with it, when it is
+	// written again.
+	Data     []byte
+	Calendar ics.Calendar
+}
+
+// Query is a filter of the calendar objects of a collection. Objects match
+// if they have a component of the given kind, VEVENT by default, that takes
+// place between Start and End. A zero Start or End leaves the time range
+// open on that side, and both being zero matches all the components.
+type Query struct {
+	Component string
+	Start     time.Time
+	End       time.Time
+}
+
+// HTTPError is the error returned when the server responds with a status
+// code other than the expected ones. The status code is 412 (Precondition
+// Failed) for writes whose ETag does not match the one in the server.
+type HTTPError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Method, e.Path, e.Status)
+}
+
+// Client is a CalDAV client of a server.
+type Client struct {
+	http     *http.Client
+	endpoint *url.URL
+	username string
+	password string
+}
+
+// NewClient returns a client of the CalDAV server with the given endpoint,
+// which makes the requests with the given HTTP client, or with
+// http.DefaultClient if it is nil.
+func NewClient(endpoint string, client *http.Client) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Client{http: client, endpoint: u}, nil
+}
+
+// SetBasicAuth makes the client authenticate with HTTP basic authentication.
+func (c *Client) SetBasicAuth(username, password string) {
+	c.username, c.password = username, password
+}
+
+// FindCurrentUserPrincipal returns the path of the principal of the user
+// authenticated in the server.
+func (c *Client) FindCurrentUserPrincipal(ctx context.Context) (string, error) {
+	ms, err := c.propfind(ctx, c.endpoint.Path, "0", "<D:current-user-principal/>")
+	if err != nil {
+		return "", err
+	}
+
+	for _, r := range ms.Responses {
+		if p := r.ok(); p.CurrentUserPrincipal != nil {
+			return p.CurrentUserPrincipal.Href, nil
+		}
+	}
+	return "", fmt.Errorf("server did not return the current user principal")
+}
+
+// FindCalendarHomeSet returns the path of the collection with the calendars
+// of the principal.
+func (c *Client) FindCalendarHomeSet(ctx context.Context, principal string) (string, error) {
+	ms, err := c.propfind(ctx, principal, "0", "<C:calendar-home-set/>")
+	if err != nil {
+		return "", err
+	}
+
+	for _, r := range ms.Responses {
+		if p := r.ok(); p.CalendarHomeSet != nil {
+			return p.CalendarHomeSet.Href, nil
+		}
+	}
+	return "", fmt.Errorf("server did not return the calendar home set of %s", principal)
+}
+
+// FindCalendars returns the calendars of the user authenticated in the
+// server, which are found from the endpoint of the client.
+func (c *Client) FindCalendars(ctx context.Context) ([]Collection, error) {
+	principal, err := c.FindCurrentUserPrincipal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	home, err := c.FindCalendarHomeSet(ctx, principal)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.ListCalendars(ctx, home)
+}
+
+// ListCalendars returns the calendars in the collection at the given path,
+// such as a calendar home set.
+func (c *Client) ListCalendars(ctx context.Context, home string) ([]Collection, error) {
+	ms, err := c.propfind(ctx, home, "1", strings.Join([]string{
+		"<D:resourcetype/>",
+		"<D:displayname/>",
+		"<C:calendar-description/>",
+		"<C:supported-calendar-component-set/>",
+		"<CS:getctag/>",
+		"<D:sync-token/>",
+	}, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Collection
+	for _, r := range ms.Responses {
+		p := r.ok()
+		if p.ResourceType == nil || p.ResourceType.Calendar == nil || len(r.Hrefs) == 0 {
+			continue
+		}
+
+		col := Collection{
+			Path:        r.Hrefs[0],
+			Name:        p.DisplayName,
+			Description: p.CalendarDescription,
+			CTag:        p.CTag,
+			SyncToken:   p.SyncToken,
+		}
+
+		if p.SupportedComponents != nil {
+			for _, c := range p.SupportedComponents.Comps {
+				col.Components = append(col.Components, c.Name)
+			}
+		}
+		result = append(result, col)
+	}
+	return result, nil
+}
+
+// QueryCalendar returns the calendar objects of the calendar at the given
+// path that match the query.
+func (c *Client) QueryCalendar(ctx context.Context, path string, q Query) ([]Object, error) {
+	component := q.Component
+	if component == "" {
+		component = "VEVENT"
+	}
+
+	var timeRange string
+	if !q.Start.IsZero() || !q.End.IsZero() {
+		timeRange = "<C:time-range"
+		if !q.Start.IsZero() {
+			timeRange += ` start="` + formatTimeRange(q.Start) + `"`
+		}
+		if !q.End.IsZero() {
+			timeRange += ` end="` + formatTimeRange(q.End) + `"`
+		}
+		timeRange += "/>"
+	}
+
+	body := xmlHeader +
+		`<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">` +
+		`<D:prop><D:getetag/><C:calendar-data/></D:prop>` +
+		`<C:filter><C:comp-filter name="VCALENDAR">` +
+		`<C:comp-filter name="` + escape(component) + `">` + timeRange + `</C:comp-filter>` +
+		`</C:comp-filter></C:filter>` +
+		`</C:calendar-query>`
+
+	ms, err := c.report(ctx, path, "1", body)
+	if err != nil {
+		return nil, err
+	}
+	return objects(ms)
+}
+
+// MultiGet returns the calendar objects at the given paths, which must be
+// in the calendar at the given path.
+func (c *Client) MultiGet(ctx context.Context, path string, paths ...string) ([]Object, error) {
+	var hrefs strings.Builder
+	for _, p := range paths {
+		hrefs.WriteString("<D:href>" + escape(c.resolve(p).EscapedPath()) + "</D:href>")
+	}
+
+	body := xmlHeader +
+		`<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">` +
+		`<D:prop><D:getetag/><C:calendar-data/></D:prop>` +
+		hrefs.String() +
+		`</C:calendar-multiget>`
+
+	ms, err := c.report(ctx, path, "1", body)
+	if err != nil {
+		return nil, err
+	}
+	return objects(ms)
+}
+
+// GetObject returns the calendar object at the given path.
+func (c *Client) GetObject(ctx context.Context, path string) (*Object, error) {
+	resp, err := c.do(ctx, http.MethodGet, path, nil, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	cal, err := ics.ParseICalContent(string(content), c.resolve(path).String(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Object{Path: path, ETag: resp.Header.Get("ETag"), Data: content, Calendar: cal}, nil
+}
+
+// PutObject writes the calendar as the calendar object at the given path
+// and returns its new ETag, which is empty if the server did not return
+// it. If etag is empty, the object is only written if it does not exist
+// yet and, otherwise, only if its ETag is still the given one, so changes
+// made by others are never overwritten.
+func (c *Client) PutObject(ctx context.Context, path string, cal *ics.Calendar, etag string) (string, error) {
+	var buf bytes.Buffer
+	if _, err := cal.WriteTo(&buf); err != nil {
+		return "", err
+	}
+
+	header := http.Header{"Content-Type": {"text/calendar; charset=utf-8"}}
+	if etag == "" {
+		header.Set("If-None-Match", "*")
+	} else {
+		header.Set("If-Match", etag)
+	}
+
+	resp, err := c.do(ctx, http.MethodPut, path, header, &buf, http.StatusCreated, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// DeleteObject deletes the calendar object at the given path. If etag is
+// not empty, the object is only deleted if its ETag is still the given one.
+func (c *Client) DeleteObject(ctx context.Context, path, etag string) error {
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-Match", etag)
+	}
+
+	resp, err := c.do(ctx, http.MethodDelete, path, header, nil, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="utf-8"?>`
+
+func (c *Client) propfind(ctx context.Context, path, depth, props string) (*multistatus, error) {
+	body := xmlHeader +
+		`<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">` +
+		`<D:prop>` + props + `</D:prop>` +
+		`</D:propfind>`
+	return c.multistatus(ctx, "PROPFIND", path, depth, body)
+}
+
+func (c *Client) report(ctx context.Context, path, depth, body string) (*multistatus, error) {
+	return c.multistatus(ctx, "REPORT", path, depth, body)
+}
+
+func (c *Client) multistatus(ctx context.Context, method, path, depth, body string) (*multistatus, error) {
+	header := http.Header{
+		"Content-Type": {"application/xml; charset=utf-8"},
+		"Depth":        {depth},
+	}
+
+	resp, err := c.do(ctx, method, path, header, strings.NewReader(body), http.StatusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("invalid response to %s %s: %s", method, path, err)
+	}
+	return &ms, nil
+}
+
+// do makes a request and returns its response, which is an error if its
+// status code is not one of the expected ones.
+func (c *Client) do(ctx context.Context, method, path string, header http.Header, body io.Reader, expected ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.resolve(path).String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+
+	resp.Body.Close()
+	return nil, &HTTPError{Method: method, Path: path, StatusCode: resp.StatusCode, Status: resp.Status}
+}
+
+// resolve returns the URL of the given path, which is relative to the
+// endpoint of the client.
+func (c *Client) resolve(path string) *url.URL {
+	u, err := url.Parse(path)
+	if err != nil {
+		return c.endpoint.ResolveReference(&url.URL{Path: path})
+	}
+	return c.endpoint.ResolveReference(u)
+}
+
+// objects returns the calendar objects of the responses.
+func objects(ms *multistatus) ([]Object, error) {
+	var result []Object
+	for _, r := range ms.Responses {
+		p := r.ok()
+		if p.CalendarData == "" || len(r.Hrefs) == 0 {
+			continue
+		}
+
+		cal, err := ics.ParseICalContent(p.CalendarData, "", 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid calendar data of %s: %s", r.Hrefs[0], err)
+		}
+
+		result = append(result, Object{Path: r.Hrefs[0], ETag: p.ETag, Data: []byte(p.CalendarData), Calendar: cal})
+	}
+	return result, nil
+}
@@ -0,0 +1,329 @@
+package caldav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/erizocosmico/go-ics"
+)
+
+func testObject(uid, start string) string {
+	return strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//example.com//iCalendar 2.0//EN",
+		"BEGIN:VEVENT",
+		"UID:" + uid,
+		"DTSTAMP:20160701T000000Z",
+		"DTSTART:" + start,
+		"DURATION:PT1H",
+		"SUMMARY:Event " + uid,
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+}
+
+// standIn is a CalDAV server that stands in for a real one in the tests of
+// the client, with the calendar objects of a single calendar.
+type standIn struct {
+	mu       sync.Mutex
+	objects  map[string]string
+	etags    map[string]int
+	requests []string
+	bodies   []string
+}
+
+const calendarPath = "/dav/calendars/alice/work/"
+
+func newStandIn() *standIn {
+	s := &standIn{objects: make(map[string]string), etags: make(map[string]int)}
+	s.objects[calendarPath+"1.ics"] = testObject("1", "20160704T100000Z")
+	s.objects[calendarPath+"2.ics"] = testObject("2", "20160705T100000Z")
+	s.etags[calendarPath+"1.ics"] = 1
+	s.etags[calendarPath+"2.ics"] = 1
+	return s
+}
+
+func (s *standIn) etag(path string) string {
+	return fmt.Sprintf(`"%d"`, s.etags[path])
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Depth"))
+	s.bodies = append(s.bodies, string(body))
+
+	multistatus := func(responses ...string) {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, `<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:" xmlns:cal="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+		io.WriteString(w, strings.Join(responses, ""))
+		io.WriteString(w, `</d:multistatus>`)
+	}
+
+	ok := func(href, props string) string {
+		return `<d:response><d:href>` + href + `</d:href><d:propstat><d:prop>` + props + `</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>` +
+			`<d:propstat><d:prop><d:displayname/></d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat></d:response>`
+	}
+
+	object := func(path string) string {
+		return ok(path, `<d:getetag>`+s.etag(path)+`</d:getetag><cal:calendar-data>`+escape(s.objects[path])+`</cal:calendar-data>`)
+	}
+
+	switch {
+	case r.Method == "PROPFIND" && r.URL.Path == "/dav/":
+		multistatus(ok("/dav/", `<d:current-user-principal><d:href>/dav/principals/alice/</d:href></d:current-user-principal>`))
+	case r.Method == "PROPFIND" && r.URL.Path == "/dav/principals/alice/":
+		multistatus(ok("/dav/principals/alice/", `<cal:calendar-home-set><d:href>/dav/calendars/alice/</d:href></cal:calendar-home-set>`))
+	case r.Method == "PROPFIND" && r.URL.Path == "/dav/calendars/alice/":
+		multistatus(
+			ok("/dav/calendars/alice/", `<d:resourcetype><d:collection/></d:resourcetype>`),
+			ok(calendarPath, `<d:resourcetype><d:collection/><cal:calendar/></d:resourcetype><d:displayname>Work</d:displayname>`+
+				`<cal:calendar-description>Meetings</cal:calendar-description><cs:getctag>42</cs:getctag>`+
+				`<cal:supported-calendar-component-set><cal:comp name="VEVENT"/></cal:supported-calendar-component-set>`),
+			ok("/dav/calendars/alice/tasks/", `<d:resourcetype><d:collection/><cal:calendar/></d:resourcetype><d:displayname>Tasks</d:displayname>`+
+				`<cal:supported-calendar-component-set><cal:comp name="VTODO"/></cal:supported-calendar-component-set>`),
+		)
+	case r.Method == "REPORT" && r.URL.Path == calendarPath:
+		var paths []string
+		if strings.Contains(string(body), "calendar-multiget") {
+			for _, part := range strings.Split(string(body), "<D:href>")[1:] {
+				paths = append(paths, part[:strings.Index(part, "<")])
+			}
+		} else {
+			// the stand-in does not filter by time
+			for p := range s.objects {
+				paths = append(paths, p)
+			}
+			sort.Strings(paths)
+		}
+
+		var responses []string
+		for _, p := range paths {
+			if _, ok := s.objects[p]; ok {
+				responses = append(responses, object(p))
+			} else {
+				responses = append(responses, `<d:response><d:href>`+p+`</d:href><d:status>HTTP/1.1 404 Not Found</d:status></d:response>`)
+			}
+		}
+		multistatus(responses...)
+	case r.Method == http.MethodGet:
+		content, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", s.etag(r.URL.Path))
+		io.WriteString(w, content)
+	case r.Method == http.MethodPut:
+		_, exists := s.objects[r.URL.Path]
+		if (r.Header.Get("If-None-Match") == "*" && exists) || (r.Header.Get("If-Match") != "" && r.Header.Get("If-Match") != s.etag(r.URL.Path)) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		s.objects[r.URL.Path] = string(body)
+		s.etags[r.URL.Path]++
+		w.Header().Set("ETag", s.etag(r.URL.Path))
+		if exists {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case r.Method == http.MethodDelete:
+		if _, ok := s.objects[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("If-Match") != "" && r.Header.Get("If-Match") != s.etag(r.URL.Path) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestClient(t *testing.T, h http.Handler) *Client {
+	t.Helper()
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(server.URL+"/dav/", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetBasicAuth("alice", "secret")
+	return client
+}
+
+func TestClientFindCalendars(t *testing.T) {
+	s := newStandIn()
+	client := newTestClient(t, s)
+
+	calendars, err := client.FindCalendars(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Collection{
+		{Path: calendarPath, Name: "Work", Description: "Meetings", Components: []string{"VEVENT"}, CTag: "42"},
+		{Path: "/dav/calendars/alice/tasks/", Name: "Tasks", Components: []string{"VTODO"}},
+	}
+
+	if fmt.Sprint(calendars) != fmt.Sprint(expected) {
+		t.Errorf("expected calendars %v, got %v", expected, calendars)
+	}
+
+	requests := []string{"PROPFIND /dav/ 0", "PROPFIND /dav/principals/alice/ 0", "PROPFIND /dav/calendars/alice/ 1"}
+	if fmt.Sprint(s.requests) != fmt.Sprint(requests) {
+		t.Errorf("expected requests %v, got %v", requests, s.requests)
+	}
+
+	client.SetBasicAuth("alice", "wrong")
+	_, err = client.FindCalendars(context.Background())
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected an unauthorized error, got %v", err)
+	}
+}
+
+func TestClientQueryCalendar(t *testing.T) {
+	s := newStandIn()
+	client := newTestClient(t, s)
+
+	objects, err := client.QueryCalendar(context.Background(), calendarPath, Query{
+		Start: time.Date(2016, time.July, 4, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2016, time.July, 11, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(objects) != 2 {
+		t.Fatalf("expected 2 objects, got %d", len(objects))
+	}
+
+	o := objects[0]
+	if o.Path != calendarPath+"1.ics" || o.ETag != `"1"` || len(o.Calendar.Events) != 1 || o.Calendar.Events[0].ID != "1" {
+		t.Errorf("unexpected object %+v", o)
+	}
+
+	for _, expected := range []string{
+		`<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:time-range start="20160704T000000Z" end="20160711T000000Z"/></C:comp-filter></C:comp-filter>`,
+		`<D:getetag/><C:calendar-data/>`,
+	} {
+		if !strings.Contains(s.bodies[0], expected) {
+			t.Errorf("expected request to contain %q:\n%s", expected, s.bodies[0])
+		}
+	}
+
+	if _, err := client.QueryCalendar(context.Background(), calendarPath, Query{Component: "VTODO"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(s.bodies[1], `<C:comp-filter name="VTODO"></C:comp-filter>`) {
+		t.Errorf("expected query without time range, got:\n%s", s.bodies[1])
+	}
+}
+
+func TestClientMultiGet(t *testing.T) {
+	s := newStandIn()
+	client := newTestClient(t, s)
+
+	objects, err := client.MultiGet(context.Background(), calendarPath, calendarPath+"2.ics", "missing.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(objects) != 1 || objects[0].Path != calendarPath+"2.ics" || objects[0].Calendar.Events[0].ID != "2" {
+		t.Errorf("unexpected objects %+v", objects)
+	}
+
+	if !strings.Contains(s.bodies[0], "<D:href>/dav/missing.ics</D:href>") {
+		t.Errorf("expected relative paths to be resolved, got:\n%s", s.bodies[0])
+	}
+}
+
+func TestClientPutDelete(t *testing.T) {
+	s := newStandIn()
+	client := newTestClient(t, s)
+	ctx := context.Background()
+
+	o, err := client.GetObject(ctx, calendarPath+"1.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o.ETag != `"1"` || o.Calendar.Events[0].Summary != "Event 1" {
+		t.Errorf("unexpected object %+v", o)
+	}
+
+	o.Calendar.Events[0].Summary = "Renamed"
+	etag, err := client.PutObject(ctx, o.Path, &o.Calendar, o.ETag)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if etag != `"2"` || !strings.Contains(s.objects[o.Path], "SUMMARY:Renamed\r\n") {
+		t.Errorf("expected object to be updated, got etag %s:\n%s", etag, s.objects[o.Path])
+	}
+
+	// the object changed since it was read
+	_, err = client.PutObject(ctx, o.Path, &o.Calendar, o.ETag)
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected a precondition error, got %v", err)
+	}
+
+	// new objects are not written over existing ones
+	if _, err := client.PutObject(ctx, o.Path, &o.Calendar, ""); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected a precondition error, got %v", err)
+	}
+
+	cal := ics.NewCalendar()
+	e := ics.NewEvent()
+	e.ID = "3"
+	e.Start = time.Date(2016, time.July, 6, 10, 0, 0, 0, time.UTC)
+	e.End = e.Start.Add(time.Hour)
+	cal.Events = append(cal.Events, *e)
+	if etag, err = client.PutObject(ctx, calendarPath+"3.ics", &cal, ""); err != nil || etag != `"1"` {
+		t.Errorf("expected object to be created, got %s, %v", etag, err)
+	}
+
+	if err := client.DeleteObject(ctx, o.Path, `"1"`); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected a precondition error, got %v", err)
+	}
+
+	if err := client.DeleteObject(ctx, o.Path, `"2"`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := s.objects[o.Path]; ok {
+		t.Errorf("expected object to be deleted")
+	}
+
+	if _, err := client.GetObject(ctx, o.Path); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
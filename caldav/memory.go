@@ -0,0 +1,274 @@
+package caldav
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/erizocosmico/go-ics"
+)
+
+// MemoryStorage is a SyncStorage that keeps the calendars in memory, which
+// is useful for tests and for calendars that are generated when the program
+// starts. Its sync tokens are only valid until the program exits.
+type MemoryStorage struct {
+	mu        sync.RWMutex
+	calendars map[string]*memoryCalendar
+	// epoch is the time the storage was created, which makes the sync
+	// tokens of different storages different.
+	epoch int64
+	// created is the number of calendars created in the storage, which
+	// makes the sync tokens of a calendar that is deleted and created
+	// again different from the ones it had before.
+	created int
+}
+
+// memoryCalendar is a calendar in memory, whose version increases every
+// time one of its objects changes. The version in which every object was
+// last changed or deleted is kept to know the changes since a version.
+// The id of the calendar is the number of calendars created before it.
+type memoryCalendar struct {
+	id       int
+	col      Collection
+	objects  map[string]Object
+	version  int
+	versions map[string]int
+	deleted  map[string]int
+}
+
+// NewMemoryStorage returns a new empty storage in memory.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		calendars: make(map[string]*memoryCalendar),
+		epoch:     time.Now().UnixNano(),
+	}
+}
+
+// ListCalendars implements Storage.
+func (s *MemoryStorage) ListCalendars(ctx context.Context) ([]Collection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Collection, 0, len(s.calendars))
+	for _, c := range s.calendars {
+		result = append(result, s.collection(c))
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result, nil
+}
+
+// GetCalendar implements Storage.
+func (s *MemoryStorage) GetCalendar(ctx context.Context, path string) (*Collection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.calendars[path]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	col := s.collection(c)
+	return &col, nil
+}
+
+// CreateCalendar implements Storage.
+func (s *MemoryStorage) CreateCalendar(ctx context.Context, col Collection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !strings.HasSuffix(col.Path, "/") {
+		col.Path += "/"
+	}
+
+	if _, ok := s.calendars[col.Path]; ok {
+		return fmt.Errorf("calendar %s already exists", col.Path)
+	}
+
+	s.created++
+	s.calendars[col.Path] = &memoryCalendar{
+		id:       s.created,
+		col:      col,
+		objects:  make(map[string]Object),
+		versions: make(map[string]int),
+		deleted:  make(map[string]int),
+	}
+	return nil
+}
+
+// DeleteCalendar implements Storage.
+func (s *MemoryStorage) DeleteCalendar(ctx context.Context, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.calendars[path]; !ok {
+		return ErrNotFound
+	}
+
+	delete(s.calendars, path)
+	return nil
+}
+
+// ListObjects implements Storage.
+func (s *MemoryStorage) ListObjects(ctx context.Context, calendar string) ([]Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.calendars[calendar]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	result := make([]Object, 0, len(c.objects))
+	for _, o := range c.objects {
+		result = append(result, o)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result, nil
+}
+
+// GetObject implements Storage.
+func (s *MemoryStorage) GetObject(ctx context.Context, p string) (*Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.calendars[path.Dir(p)+"/"]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	o, ok := c.objects[p]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &o, nil
+}
+
+// PutObject implements Storage. The ETag of the calendar objects is the
+// hash of their content.
+func (s *MemoryStorage) PutObject(ctx context.Context, p string, data []byte, cal *ics.Calendar, cond Preconditions) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.calendars[path.Dir(p)+"/"]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	if err := cond.Check(c.object(p)); err != nil {
+		return "", err
+	}
+
+	uid := objectUID(cal)
+	for other, o := range c.objects {
+		if other != p && objectUID(&o.Calendar) == uid {
+			return "", &UIDConflictError{Path: other}
+		}
+	}
+
+	etag := fmt.Sprintf(`"%x"`, sha1.Sum(data))
+	c.objects[p] = Object{Path: p, ETag: etag, Data: append([]byte(nil), data...), Calendar: *cal}
+	c.version++
+	c.versions[p] = c.version
+	delete(c.deleted, p)
+	return etag, nil
+}
+
+// DeleteObject implements Storage.
+func (s *MemoryStorage) DeleteObject(ctx context.Context, p string, cond Preconditions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.calendars[path.Dir(p)+"/"]
+	if !ok {
+		return ErrNotFound
+	}
+
+	existing := c.object(p)
+	if existing == nil {
+		return ErrNotFound
+	}
+
+	if err := cond.Check(existing); err != nil {
+		return err
+	}
+
+	delete(c.objects, p)
+	c.version++
+	delete(c.versions, p)
+	c.deleted[p] = c.version
+	return nil
+}
+
+// object returns the calendar object at the given path, or nil if there
+// is none.
+func (c *memoryCalendar) object(p string) *Object {
+	o, ok := c.objects[p]
+	if !ok {
+		return nil
+	}
+	return &o
+}
+
+// Changes implements SyncStorage.
+func (s *MemoryStorage) Changes(ctx context.Context, calendar, token string) (changed, deleted []string, current string, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.calendars[calendar]
+	if !ok {
+		return nil, nil, "", ErrNotFound
+	}
+
+	since := 0
+	if token != "" {
+		var epoch int64
+		var id int
+		_, err := fmt.Sscanf(token, syncTokenFormat, &epoch, &id, &since)
+		if err != nil || epoch != s.epoch || id != c.id || since > c.version {
+			return nil, nil, "", ErrInvalidSyncToken
+		}
+	}
+
+	for p, v := range c.versions {
+		if v > since {
+			changed = append(changed, p)
+		}
+	}
+
+	if token != "" {
+		for p, v := range c.deleted {
+			if v > since {
+				deleted = append(deleted, p)
+			}
+		}
+	}
+
+	sort.Strings(changed)
+	sort.Strings(deleted)
+	return changed, deleted, s.syncToken(c), nil
+}
+
+// syncTokenFormat is the format of the sync tokens, which are URIs with
+// the epoch of the storage and the id and the version of the calendar.
+const syncTokenFormat = "data:,%d-%d-%d"
+
+func (s *MemoryStorage) syncToken(c *memoryCalendar) string {
+	return fmt.Sprintf(syncTokenFormat, s.epoch, c.id, c.version)
+}
+
+// collection returns the collection of the calendar, whose CTag is its
+// version, which changes every time one of its objects changes.
+func (s *MemoryStorage) collection(c *memoryCalendar) Collection {
+	col := c.col
+	col.CTag = strconv.Itoa(c.version)
+	col.SyncToken = s.syncToken(c)
+	return col
+}
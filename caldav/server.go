@@ -0,0 +1,840 @@
+package caldav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/erizocosmico/go-ics"
+)
+
+// ErrNotFound is the error storages return for calendars and calendar
+// objects that do not exist.
+var ErrNotFound = errors.New("not found")
+
+// Storage stores the calendars a Handler serves. The paths of calendars
+// are relative to the handler and end with a slash, such as /work/, and
+// the ones of calendar objects are in their calendar, such as
+// /work/meeting.ics.
+type Storage interface {
+	// ListCalendars returns all the calendars.
+	ListCalendars(ctx context.Context) ([]Collection, error)
+	// GetCalendar returns the calendar at the given path.
+	GetCalendar(ctx context.Context, path string) (*Collection, error)
+	// CreateCalendar creates a new empty calendar.
+	CreateCalendar(ctx context.Context, col Collection) error
+	// DeleteCalendar deletes the calendar at the given path and all of its
+	// calendar objects.
+	DeleteCalendar(ctx context.Context, path string) error
+	// ListObjects returns all the calendar objects of the calendar at the
+	// given path.
+	ListObjects(ctx context.Context, calendar string) ([]Object, error)
+	// GetObject returns the calendar object at the given path.
+	GetObject(ctx context.Context, path string) (*Object, error)
+	// PutObject creates or replaces the calendar object at the given path
+	// with the given content, which is parsed as cal, and returns its new
+	// ETag. The preconditions and the UID of the calendar are checked in
+	// the same operation as the write: it returns ErrPreconditionFailed
+	// if the current object does not meet the preconditions, and a
+	// *UIDConflictError if another calendar object of the calendar has
+	// the same UID.
+	PutObject(ctx context.Context, path string, data []byte, cal *ics.Calendar, cond Preconditions) (string, error)
+	// DeleteObject deletes the calendar object at the given path, or
+	// returns ErrPreconditionFailed if it does not meet the preconditions.
+	DeleteObject(ctx context.Context, path string, cond Preconditions) error
+}
+
+// ErrPreconditionFailed is the error storages return for writes whose
+// preconditions are not met by the current calendar object.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// Preconditions are the conditions on the current calendar object for it
+// to be written or deleted, from the If-Match and If-None-Match headers of
+// requests. Empty conditions are always met.
+type Preconditions struct {
+	// IfMatch is the ETag the object must have, or * if it must exist.
+	IfMatch string
+	// IfNoneMatch is an ETag the object must not have, or * if it must
+	// not exist.
+	IfNoneMatch string
+}
+
+// Check returns an error wrapping ErrPreconditionFailed if the calendar
+// object, which is nil if it does not exist, does not meet the
+// preconditions.
+func (p Preconditions) Check(existing *Object) error {
+	if p.IfMatch != "" {
+		if existing == nil || (p.IfMatch != "*" && p.IfMatch != existing.ETag) {
+			return fmt.Errorf("%w: ETag does not match", ErrPreconditionFailed)
+		}
+	}
+
+	if p.IfNoneMatch != "" && existing != nil {
+		if p.IfNoneMatch == "*" || p.IfNoneMatch == existing.ETag {
+			return fmt.Errorf("%w: calendar object already exists", ErrPreconditionFailed)
+		}
+	}
+	return nil
+}
+
+// UIDConflictError is the error storages return for calendar objects with
+// the same UID as another calendar object of their calendar, at Path.
+type UIDConflictError struct {
+	Path string
+}
+
+func (e *UIDConflictError) Error() string {
+	return fmt.Sprintf("UID already in use by %s", e.Path)
+}
+
+// ErrInvalidSyncToken is the error returned for sync tokens that are not
+// valid, or no longer are, in which case the synchronization has to start
+// again without token.
+var ErrInvalidSyncToken = errors.New("invalid sync token")
+
+// SyncStorage is a Storage that keeps track of the changes of calendars,
+// which lets clients synchronize them incrementally with the
+// sync-collection report of RFC 6578. The SyncToken of the calendars it
+// returns must be the token of their current state.
+type SyncStorage interface {
+	Storage
+	// Changes returns the paths of the calendar objects of the calendar
+	// that were created or changed and the ones that were deleted since the
+	// state of the given sync token, and the token of the current state.
+	// An empty token returns all the calendar objects as changed. It
+	// returns ErrInvalidSyncToken for tokens it does not know.
+	Changes(ctx context.Context, calendar, token string) (changed, deleted []string, current string, err error)
+}
+
+// Handler is an http.Handler that serves the calendars of a storage over
+// CalDAV, for a single user whose principal and calendar home set are the
+// root of the handler. Multiple users can be served by different handlers,
+// or by a storage that uses the context set by Authenticate.
+//
+// Calendar queries can filter calendar objects by their components and by
+// time ranges, which take into account all the occurrences of repeating
+// components, but property and parameter filters are ignored, so clients
+// get more objects than the ones they asked for.
+type Handler struct {
+	storage Storage
+
+	// Prefix is the path the handler is served at, if it is not the root
+	// of the server, such as /dav.
+	Prefix string
+
+	// Authenticate, if it is not nil, authenticates every request with the
+	// username and password of its HTTP basic authentication, which are
+	// empty if it has none. It returns the context of the calls to the
+	// storage for the request, such as one with the user, or an error if
+	// the request must be rejected.
+	Authenticate func(ctx context.Context, username, password string) (context.Context, error)
+
+	// Realm is the realm of the basic authentication, which is shown by
+	// clients when they ask for the password.
+	Realm string
+}
+
+// NewHandler returns a new handler that serves the calendars of the given
+// storage.
+func NewHandler(storage Storage) *Handler {
+	return &Handler{storage: storage, Realm: "CalDAV"}
+}
+
+// allComponents are the components of calendars with no supported
+// components defined.
+var allComponents = []string{"VEVENT", "VTODO", "VJOURNAL"}
+
+const calendarContentType = "text/calendar; charset=utf-8"
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if h.Authenticate != nil {
+		username, password, _ := r.BasicAuth()
+		var err error
+		if ctx, err = h.Authenticate(ctx, username, password); err != nil {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, h.Realm))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	path, ok := h.trimPrefix(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	p := resourcePath(path)
+	var err error
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("DAV", "1, 3, calendar-access")
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT, MKCALENDAR")
+		w.WriteHeader(http.StatusNoContent)
+	case "PROPFIND":
+		err = h.propfind(ctx, w, r, p)
+	case "REPORT":
+		err = h.report(ctx, w, r, p)
+	case http.MethodGet, http.MethodHead:
+		err = h.get(ctx, w, r, p)
+	case http.MethodPut:
+		err = h.put(ctx, w, r, p)
+	case http.MethodDelete:
+		err = h.delete(ctx, w, r, p)
+	case "MKCALENDAR":
+		err = h.mkcalendar(ctx, w, r, p)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+
+	var httpErr *HTTPError
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotFound):
+		http.NotFound(w, r)
+	case errors.Is(err, ErrPreconditionFailed):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case errors.As(err, &httpErr):
+		http.Error(w, httpErr.Status, httpErr.StatusCode)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// trimPrefix returns the path in the handler of a path of the server, and
+// false if the path is not in the handler.
+func (h *Handler) trimPrefix(p string) (string, bool) {
+	prefix := strings.TrimSuffix(h.Prefix, "/")
+	if prefix != "" && p != prefix && !strings.HasPrefix(p, prefix+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(p, prefix), true
+}
+
+// resource is a path in the handler, which is the root, a calendar or a
+// calendar object.
+type resource struct {
+	path     string
+	calendar string
+	object   bool
+}
+
+// resourcePath returns the resource at the given path. Paths deeper than
+// the ones of calendar objects are calendar objects that do not exist.
+func resourcePath(p string) resource {
+	var parts []string
+	for _, part := range strings.Split(p, "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	switch len(parts) {
+	case 0:
+		return resource{path: "/"}
+	case 1:
+		return resource{path: "/" + parts[0] + "/", calendar: "/" + parts[0] + "/"}
+	}
+	return resource{path: "/" + strings.Join(parts, "/"), calendar: "/" + parts[0] + "/", object: true}
+}
+
+// statusError returns an error that makes the handler respond with the
+// given status code.
+func statusError(code int, format string, args ...interface{}) error {
+	return &HTTPError{StatusCode: code, Status: fmt.Sprintf(format, args...)}
+}
+
+func (h *Handler) propfind(ctx context.Context, w http.ResponseWriter, r *http.Request, res resource) error {
+	var req propfindRequest
+	if err := decodeBody(r, &req); err != nil {
+		return err
+	}
+
+	depth := r.Header.Get("Depth")
+	var responses []responseOut
+	switch {
+	case res.object:
+		o, err := h.storage.GetObject(ctx, res.path)
+		if err != nil {
+			return err
+		}
+		responses = append(responses, h.response(o.Path, objectProps(o), &req))
+	case res.calendar != "":
+		col, err := h.storage.GetCalendar(ctx, res.calendar)
+		if err != nil {
+			return err
+		}
+		responses = append(responses, h.response(col.Path, h.calendarProps(col), &req))
+
+		if depth != "0" {
+			objects, err := h.storage.ListObjects(ctx, col.Path)
+			if err != nil {
+				return err
+			}
+
+			for i := range objects {
+				responses = append(responses, h.response(objects[i].Path, objectProps(&objects[i]), &req))
+			}
+		}
+	default:
+		responses = append(responses, h.response("/", h.rootProps(), &req))
+		if depth != "0" {
+			calendars, err := h.storage.ListCalendars(ctx)
+			if err != nil {
+				return err
+			}
+
+			for i := range calendars {
+				responses = append(responses, h.response(calendars[i].Path, h.calendarProps(&calendars[i]), &req))
+			}
+		}
+	}
+
+	return writeMultistatus(w, responses, "")
+}
+
+func (h *Handler) report(ctx context.Context, w http.ResponseWriter, r *http.Request, res resource) error {
+	var req reportRequest
+	if err := decodeBody(r, &req); err != nil {
+		return err
+	}
+
+	if res.calendar == "" || res.object {
+		return statusError(http.StatusForbidden, "reports are only supported on calendars")
+	}
+
+	col, err := h.storage.GetCalendar(ctx, res.calendar)
+	if err != nil {
+		return err
+	}
+
+	switch req.XMLName {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		var responses []responseOut
+		for _, href := range req.Hrefs {
+			p, err := h.hrefPath(href)
+			if err != nil {
+				return err
+			}
+
+			o, err := h.storage.GetObject(ctx, p)
+			if errors.Is(err, ErrNotFound) {
+				responses = append(responses, responseOut{Href: href, Status: "HTTP/1.1 404 Not Found"})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			responses = append(responses, h.response(o.Path, objectProps(o), &req.propfindRequest))
+		}
+		return writeMultistatus(w, responses, "")
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		objects, err := h.storage.ListObjects(ctx, col.Path)
+		if err != nil {
+			return err
+		}
+
+		var responses []responseOut
+		for i := range objects {
+			if req.Filter != nil {
+				ok, err := matches(&objects[i].Calendar, &req.Filter.CompFilter)
+				if err != nil {
+					return statusError(http.StatusBadRequest, "invalid filter: %s", err)
+				}
+				if !ok {
+					continue
+				}
+			}
+			responses = append(responses, h.response(objects[i].Path, objectProps(&objects[i]), &req.propfindRequest))
+		}
+		return writeMultistatus(w, responses, "")
+	case xml.Name{Space: nsCalDAV, Local: "free-busy-query"}:
+		return h.freeBusy(ctx, w, col, req.TimeRange)
+	case xml.Name{Space: nsDAV, Local: "sync-collection"}:
+		return h.syncCollection(ctx, w, r, col, &req)
+	}
+
+	return statusError(http.StatusForbidden, "unsupported report %s", req.XMLName.Local)
+}
+
+// syncCollection writes the calendar objects of the calendar that changed
+// since the sync token of the request.
+func (h *Handler) syncCollection(ctx context.Context, w http.ResponseWriter, r *http.Request, col *Collection, req *reportRequest) error {
+	storage, ok := h.storage.(SyncStorage)
+	if !ok {
+		return statusError(http.StatusForbidden, "unsupported report %s", req.XMLName.Local)
+	}
+
+	if r.Header.Get("Depth") != "" && r.Header.Get("Depth") != "0" {
+		return statusError(http.StatusBadRequest, "sync-collection requires depth 0")
+	}
+
+	changed, deleted, token, err := storage.Changes(ctx, col.Path, req.SyncToken)
+	if errors.Is(err, ErrInvalidSyncToken) {
+		return writeError(w, http.StatusForbidden, `<valid-sync-token/>`)
+	}
+	if err != nil {
+		return err
+	}
+
+	var responses []responseOut
+	for _, p := range changed {
+		o, err := h.storage.GetObject(ctx, p)
+		if errors.Is(err, ErrNotFound) {
+			// deleted after the changes were read
+			deleted = append(deleted, p)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		responses = append(responses, h.response(o.Path, objectProps(o), &req.propfindRequest))
+	}
+
+	for _, p := range deleted {
+		responses = append(responses, responseOut{Href: h.href(p), Status: "HTTP/1.1 404 Not Found"})
+	}
+	return writeMultistatus(w, responses, token)
+}
+
+// freeBusy writes the free/busy time of the calendar in the time range.
+func (h *Handler) freeBusy(ctx context.Context, w http.ResponseWriter, col *Collection, tr *timeRange) error {
+	if tr == nil {
+		return statusError(http.StatusBadRequest, "free/busy query without time range")
+	}
+
+	start, end, err := tr.times()
+	if err != nil || start.IsZero() || end.IsZero() {
+		return statusError(http.StatusBadRequest, "invalid time range")
+	}
+
+	objects, err := h.storage.ListObjects(ctx, col.Path)
+	if err != nil {
+		return err
+	}
+
+	all := ics.NewCalendar()
+	for _, o := range objects {
+		all.Events = append(all.Events, o.Calendar.Events...)
+		all.Availabilities = append(all.Availabilities, o.Calendar.Availabilities...)
+	}
+
+	cal := ics.NewCalendar()
+	cal.FreeBusies = append(cal.FreeBusies, *all.FreeBusy(start, end))
+	w.Header().Set("Content-Type", calendarContentType)
+	_, err = cal.WriteTo(w)
+	return err
+}
+
+// matches reports whether the calendar matches the filter of components.
+func matches(cal *ics.Calendar, f *compFilter) (bool, error) {
+	if f.Name != "VCALENDAR" {
+		return f.IsNotDefined != nil, nil
+	}
+
+	for i := range f.CompFilters {
+		ok, err := matchesComponent(cal, &f.CompFilters[i])
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchesComponent(cal *ics.Calendar, f *compFilter) (bool, error) {
+	found, err := hasComponent(cal, f.Name, f.TimeRange)
+	if err != nil {
+		return false, err
+	}
+	return found != (f.IsNotDefined != nil), nil
+}
+
+// hasComponent reports whether the calendar has a component with the given
+// name that takes place in the time range, if it is not nil.
+func hasComponent(cal *ics.Calendar, name string, tr *timeRange) (bool, error) {
+	if tr == nil {
+		switch name {
+		case "VEVENT":
+			return len(cal.Events) > 0, nil
+		case "VTODO":
+			return len(cal.Todos) > 0, nil
+		case "VJOURNAL":
+			return len(cal.Journals) > 0, nil
+		case "VFREEBUSY":
+			return len(cal.FreeBusies) > 0, nil
+		case "VAVAILABILITY":
+			return len(cal.Availabilities) > 0, nil
+		}
+		return false, nil
+	}
+
+	start, end, err := tr.times()
+	if err != nil {
+		return false, err
+	}
+
+	switch name {
+	case "VEVENT":
+		for range cal.Between(start, end) {
+			return true, nil
+		}
+	case "VTODO":
+		for i := range cal.Todos {
+			for range cal.Todos[i].Occurrences(start, end) {
+				return true, nil
+			}
+		}
+	case "VJOURNAL":
+		for i := range cal.Journals {
+			for range cal.Journals[i].Occurrences(start, end) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (h *Handler) get(ctx context.Context, w http.ResponseWriter, r *http.Request, res resource) error {
+	if !res.object {
+		return statusError(http.StatusMethodNotAllowed, "only calendar objects can be read")
+	}
+
+	o, err := h.storage.GetObject(ctx, res.path)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", calendarContentType)
+	w.Header().Set("ETag", o.ETag)
+	w.Header().Set("Content-Length", fmt.Sprint(len(o.Data)))
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	_, err = w.Write(o.Data)
+	return err
+}
+
+func (h *Handler) put(ctx context.Context, w http.ResponseWriter, r *http.Request, res resource) error {
+	if !res.object {
+		return statusError(http.StatusMethodNotAllowed, "only calendar objects can be written")
+	}
+
+	if _, err := h.storage.GetCalendar(ctx, res.calendar); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return statusError(http.StatusConflict, "calendar %s does not exist", res.calendar)
+		}
+		return err
+	}
+
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	cal, err := ics.ParseICalContent(string(content), "", 0)
+	if err != nil {
+		return statusError(http.StatusBadRequest, "invalid calendar data: %s", err)
+	}
+
+	if err := validateObject(&cal); err != nil {
+		return statusError(http.StatusBadRequest, "invalid calendar object: %s", err)
+	}
+
+	existing, err := h.storage.GetObject(ctx, res.path)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	// the content is stored as it is, so the properties of the calendar
+	// that are not parsed are kept, and its ETag is the one of the content
+	// that is returned
+	etag, err := h.storage.PutObject(ctx, res.path, content, &cal, preconditions(r))
+	var conflict *UIDConflictError
+	if errors.As(err, &conflict) {
+		return writeError(w, http.StatusForbidden, `<no-uid-conflict xmlns="`+nsCalDAV+`">`+h.hrefXML(conflict.Path)+`</no-uid-conflict>`)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", etag)
+	if existing == nil {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return nil
+}
+
+// validateObject returns an error if the calendar is not a valid calendar
+// object, whose components must all have the same UID.
+func validateObject(cal *ics.Calendar) error {
+	var uids []string
+	for _, e := range cal.Events {
+		uids = append(uids, e.ID)
+	}
+	for _, t := range cal.Todos {
+		uids = append(uids, t.ID)
+	}
+	for _, j := range cal.Journals {
+		uids = append(uids, j.ID)
+	}
+
+	if len(uids) == 0 {
+		return fmt.Errorf("no events, todos or journals")
+	}
+
+	for _, uid := range uids {
+		if uid == "" {
+			return fmt.Errorf("component without UID")
+		}
+		if uid != uids[0] {
+			return fmt.Errorf("components with different UIDs")
+		}
+	}
+	return nil
+}
+
+// objectUID returns the UID of the components of a valid calendar object.
+func objectUID(cal *ics.Calendar) string {
+	switch {
+	case len(cal.Events) > 0:
+		return cal.Events[0].ID
+	case len(cal.Todos) > 0:
+		return cal.Todos[0].ID
+	case len(cal.Journals) > 0:
+		return cal.Journals[0].ID
+	}
+	return ""
+}
+
+// preconditions returns the preconditions of the If-Match and
+// If-None-Match headers of the request.
+func preconditions(r *http.Request) Preconditions {
+	return Preconditions{IfMatch: r.Header.Get("If-Match"), IfNoneMatch: r.Header.Get("If-None-Match")}
+}
+
+func (h *Handler) delete(ctx context.Context, w http.ResponseWriter, r *http.Request, res resource) error {
+	switch {
+	case res.object:
+		if err := h.storage.DeleteObject(ctx, res.path, preconditions(r)); err != nil {
+			return err
+		}
+	case res.calendar != "":
+		if err := h.storage.DeleteCalendar(ctx, res.calendar); err != nil {
+			return err
+		}
+	default:
+		return statusError(http.StatusForbidden, "the root can not be deleted")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *Handler) mkcalendar(ctx context.Context, w http.ResponseWriter, r *http.Request, res resource) error {
+	if res.calendar == "" || res.object {
+		return statusError(http.StatusForbidden, "calendars can only be created in the root")
+	}
+
+	var req mkcalendarRequest
+	if err := decodeBody(r, &req); err != nil {
+		return err
+	}
+
+	_, err := h.storage.GetCalendar(ctx, res.calendar)
+	if err == nil {
+		return statusError(http.StatusMethodNotAllowed, "calendar %s already exists", res.calendar)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	p := req.Set.Prop
+	col := Collection{Path: res.calendar, Name: p.DisplayName, Description: p.CalendarDescription}
+	if p.SupportedComponents != nil {
+		for _, c := range p.SupportedComponents.Comps {
+			col.Components = append(col.Components, c.Name)
+		}
+	}
+
+	if err := h.storage.CreateCalendar(ctx, col); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// decodeBody decodes the XML body of the request, if it has one.
+func decodeBody(r *http.Request, v interface{}) error {
+	err := xml.NewDecoder(r.Body).Decode(v)
+	if err != nil && err != io.EOF {
+		return statusError(http.StatusBadRequest, "invalid request body: %s", err)
+	}
+	return nil
+}
+
+// hrefPath returns the path in the handler of an href of a request.
+func (h *Handler) hrefPath(href string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", statusError(http.StatusBadRequest, "invalid href %q", href)
+	}
+
+	p, ok := h.trimPrefix(u.Path)
+	if !ok {
+		return "", statusError(http.StatusBadRequest, "href %q is not in the handler", href)
+	}
+	return resourcePath(p).path, nil
+}
+
+// href returns the href of the given path in the handler.
+func (h *Handler) href(p string) string {
+	return (&url.URL{Path: h.Prefix + p}).EscapedPath()
+}
+
+func davProp(local, inner string) rawProp {
+	return rawProp{XMLName: xml.Name{Space: nsDAV, Local: local}, Inner: inner}
+}
+
+func calDAVProp(local, inner string) rawProp {
+	return rawProp{XMLName: xml.Name{Space: nsCalDAV, Local: local}, Inner: inner}
+}
+
+func (h *Handler) hrefXML(p string) string {
+	return `<href xmlns="DAV:">` + escape(h.href(p)) + `</href>`
+}
+
+func (h *Handler) rootProps() []rawProp {
+	return []rawProp{
+		davProp("resourcetype", `<collection xmlns="DAV:"/>`),
+		davProp("current-user-principal", h.hrefXML("/")),
+		davProp("principal-URL", h.hrefXML("/")),
+		calDAVProp("calendar-home-set", h.hrefXML("/")),
+		davProp("current-user-privilege-set", privileges),
+	}
+}
+
+const privileges = `<privilege xmlns="DAV:"><all/></privilege>`
+
+func (h *Handler) calendarProps(col *Collection) []rawProp {
+	components := col.Components
+	if len(components) == 0 {
+		components = allComponents
+	}
+
+	var comps strings.Builder
+	for _, c := range components {
+		comps.WriteString(`<comp xmlns="` + nsCalDAV + `" name="` + escape(c) + `"/>`)
+	}
+
+	props := []rawProp{
+		davProp("resourcetype", `<collection xmlns="DAV:"/><calendar xmlns="`+nsCalDAV+`"/>`),
+		davProp("displayname", escape(col.Name)),
+		calDAVProp("calendar-description", escape(col.Description)),
+		calDAVProp("supported-calendar-component-set", comps.String()),
+		davProp("current-user-privilege-set", privileges),
+	}
+
+	reports := []xml.Name{
+		{Space: nsCalDAV, Local: "calendar-query"},
+		{Space: nsCalDAV, Local: "calendar-multiget"},
+		{Space: nsCalDAV, Local: "free-busy-query"},
+	}
+
+	if _, ok := h.storage.(SyncStorage); ok && col.SyncToken != "" {
+		props = append(props, davProp("sync-token", escape(col.SyncToken)))
+		reports = append(reports, xml.Name{Space: nsDAV, Local: "sync-collection"})
+	}
+
+	var supported strings.Builder
+	for _, r := range reports {
+		supported.WriteString(`<supported-report xmlns="DAV:"><report><` + r.Local + ` xmlns="` + r.Space + `"/></report></supported-report>`)
+	}
+	props = append(props, davProp("supported-report-set", supported.String()))
+
+	if col.CTag != "" {
+		props = append(props, rawProp{XMLName: xml.Name{Space: nsCS, Local: "getctag"}, Inner: escape(col.CTag)})
+	}
+	return props
+}
+
+func objectProps(o *Object) []rawProp {
+	return []rawProp{
+		davProp("resourcetype", ""),
+		davProp("getetag", escape(o.ETag)),
+		davProp("getcontenttype", calendarContentType),
+		calDAVProp("calendar-data", escape(string(o.Data))),
+	}
+}
+
+// response returns the response with the properties of the resource at
+// the given path that the request asks for. Requests for all properties
+// do not get the calendar data of calendar objects.
+func (h *Handler) response(p string, props []rawProp, req *propfindRequest) responseOut {
+	var found, missing propstatOut
+	if req.Prop == nil || req.AllProp != nil {
+		for _, prop := range props {
+			if prop.XMLName.Local != "calendar-data" {
+				found.Prop.Props = append(found.Prop.Props, prop)
+			}
+		}
+	} else {
+		for _, name := range req.Prop.Names {
+			prop, ok := findProp(props, name.XMLName)
+			if !ok {
+				prop = rawProp{XMLName: name.XMLName}
+				missing.Prop.Props = append(missing.Prop.Props, prop)
+				continue
+			}
+			found.Prop.Props = append(found.Prop.Props, prop)
+		}
+	}
+
+	resp := responseOut{Href: h.href(p)}
+	if len(found.Prop.Props) > 0 {
+		found.Status = "HTTP/1.1 200 OK"
+		resp.Propstats = append(resp.Propstats, found)
+	}
+
+	if len(missing.Prop.Props) > 0 {
+		missing.Status = "HTTP/1.1 404 Not Found"
+		resp.Propstats = append(resp.Propstats, missing)
+	}
+	return resp
+}
+
+func findProp(props []rawProp, name xml.Name) (rawProp, bool) {
+	for _, p := range props {
+		if p.XMLName == name {
+			return p, true
+		}
+	}
+	return rawProp{}, false
+}
+
+// writeError writes an error response with the given status code and the
+// precondition that failed.
+func writeError(w http.ResponseWriter, code int, precondition string) error {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(code)
+	_, err := io.WriteString(w, xml.Header+`<error xmlns="DAV:">`+precondition+`</error>`)
+	return err
+}
+
+func writeMultistatus(w http.ResponseWriter, responses []responseOut, syncToken string) error {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(multistatusOut{Responses: responses, SyncToken: syncToken})
+}
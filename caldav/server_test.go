@@ -0,0 +1,356 @@
+package caldav
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erizocosmico/go-ics"
+)
+
+var errUnauthorized = errors.New("wrong username or password")
+
+type userKey struct{}
+
+func newTestServer(t *testing.T) (*MemoryStorage, *httptest.Server) {
+	t.Helper()
+	storage := NewMemoryStorage()
+	if err := storage.CreateCalendar(context.Background(), Collection{Path: "/work/", Name: "Work", Components: []string{"VEVENT"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(storage)
+	h.Prefix = "/dav"
+	h.Authenticate = func(ctx context.Context, username, password string) (context.Context, error) {
+		if username != "alice" || password != "secret" {
+			return nil, errUnauthorized
+		}
+		return context.WithValue(ctx, userKey{}, username), nil
+	}
+
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	return storage, server
+}
+
+func newServerClient(t *testing.T, server *httptest.Server) *Client {
+	t.Helper()
+	client, err := NewClient(server.URL+"/dav/", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetBasicAuth("alice", "secret")
+	return client
+}
+
+func request(t *testing.T, server *httptest.Server, method, path, body string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("alice", "secret")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(content)
+}
+
+// weekly returns a calendar with an event that repeats every week four
+// times from the 4th of July of 2016.
+func weekly(uid string) *ics.Calendar {
+	cal := ics.NewCalendar()
+	e := ics.NewEvent()
+	e.ID = uid
+	e.Summary = "Weekly"
+	e.Start = time.Date(2016, time.July, 4, 10, 0, 0, 0, time.UTC)
+	e.End = e.Start.Add(time.Hour)
+	e.RRule = "FREQ=WEEKLY;COUNT=4"
+	cal.Events = append(cal.Events, *e)
+	return &cal
+}
+
+func TestHandlerDiscovery(t *testing.T) {
+	_, server := newTestServer(t)
+	client := newServerClient(t, server)
+
+	calendars, err := client.FindCalendars(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calendars) != 1 || calendars[0].Path != "/dav/work/" || calendars[0].Name != "Work" || calendars[0].CTag != "0" {
+		t.Fatalf("unexpected calendars %+v", calendars)
+	}
+
+	if len(calendars[0].Components) != 1 || calendars[0].Components[0] != "VEVENT" {
+		t.Errorf("unexpected components %v", calendars[0].Components)
+	}
+
+	resp, body := request(t, server, "PROPFIND", "/dav/work/", `<?xml version="1.0"?><propfind xmlns="DAV:"><prop><displayname/><quota-used-bytes/></prop></propfind>`, map[string]string{"Depth": "0"})
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("unexpected status %s", resp.Status)
+	}
+
+	for _, expected := range []string{
+		`<displayname xmlns="DAV:">Work</displayname>`,
+		`<quota-used-bytes xmlns="DAV:"></quota-used-bytes>`,
+		`HTTP/1.1 404 Not Found`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected response to contain %q:\n%s", expected, body)
+		}
+	}
+
+	client.SetBasicAuth("alice", "wrong")
+	_, err = client.FindCalendars(context.Background())
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected an unauthorized error, got %v", err)
+	}
+
+	resp, _ = request(t, server, http.MethodOptions, "/dav/", "", nil)
+	if !strings.Contains(resp.Header.Get("DAV"), "calendar-access") {
+		t.Errorf("expected calendar access to be supported, got %q", resp.Header.Get("DAV"))
+	}
+}
+
+func TestHandlerObjects(t *testing.T) {
+	_, server := newTestServer(t)
+	client := newServerClient(t, server)
+	ctx := context.Background()
+
+	etag, err := client.PutObject(ctx, "work/weekly.ics", weekly("weekly"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.PutObject(ctx, "work/weekly.ics", weekly("weekly"), ""); err == nil {
+		t.Errorf("expected existing object not to be overwritten")
+	}
+
+	o, err := client.GetObject(ctx, "work/weekly.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o.ETag != etag || len(o.Calendar.Events) != 1 || o.Calendar.Events[0].RRule != "FREQ=WEEKLY;COUNT=4" {
+		t.Errorf("unexpected object %+v", o)
+	}
+
+	o.Calendar.Events[0].Summary = "Renamed"
+	newETag, err := client.PutObject(ctx, o.Path, &o.Calendar, o.ETag)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var httpErr *HTTPError
+	if _, err := client.PutObject(ctx, o.Path, &o.Calendar, o.ETag); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected a precondition error, got %v", err)
+	}
+
+	objects, err := client.MultiGet(ctx, "work/", "work/weekly.ics", "work/missing.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(objects) != 1 || objects[0].ETag != newETag || objects[0].Calendar.Events[0].Summary != "Renamed" {
+		t.Errorf("unexpected objects %+v", objects)
+	}
+
+	if err := client.DeleteObject(ctx, o.Path, etag); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected a precondition error, got %v", err)
+	}
+
+	if err := client.DeleteObject(ctx, o.Path, newETag); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.GetObject(ctx, o.Path); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+
+	invalid := weekly("a")
+	invalid.Events = append(invalid.Events, weekly("b").Events...)
+	if _, err := client.PutObject(ctx, "work/invalid.ics", invalid, ""); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected objects with several UIDs to be rejected, got %v", err)
+	}
+
+	if _, err := client.PutObject(ctx, "home/weekly.ics", weekly("weekly"), ""); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusConflict {
+		t.Errorf("expected objects out of calendars to be rejected, got %v", err)
+	}
+}
+
+func TestHandlerQuery(t *testing.T) {
+	_, server := newTestServer(t)
+	client := newServerClient(t, server)
+	ctx := context.Background()
+
+	if _, err := client.PutObject(ctx, "work/weekly.ics", weekly("weekly"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	single := weekly("single")
+	single.Events[0].RRule = ""
+	if _, err := client.PutObject(ctx, "work/single.ics", single, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		query    Query
+		expected []string
+	}{
+		{Query{}, []string{"/dav/work/single.ics", "/dav/work/weekly.ics"}},
+		// only the last occurrence of the weekly event
+		{Query{Start: time.Date(2016, time.July, 25, 0, 0, 0, 0, time.UTC), End: time.Date(2016, time.July, 26, 0, 0, 0, 0, time.UTC)}, []string{"/dav/work/weekly.ics"}},
+		{Query{Start: time.Date(2016, time.July, 26, 0, 0, 0, 0, time.UTC)}, nil},
+		{Query{End: time.Date(2016, time.July, 4, 10, 30, 0, 0, time.UTC)}, []string{"/dav/work/single.ics", "/dav/work/weekly.ics"}},
+		{Query{Component: "VTODO"}, nil},
+	} {
+		objects, err := client.QueryCalendar(ctx, "work/", c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var paths []string
+		for _, o := range objects {
+			paths = append(paths, o.Path)
+		}
+
+		if strings.Join(paths, ",") != strings.Join(c.expected, ",") {
+			t.Errorf("expected objects %v for %+v, got %v", c.expected, c.query, paths)
+		}
+	}
+
+	resp, body := request(t, server, "REPORT", "/dav/work/", `<?xml version="1.0"?>`+
+		`<C:free-busy-query xmlns:C="urn:ietf:params:xml:ns:caldav">`+
+		`<C:time-range start="20160711T000000Z" end="20160712T000000Z"/>`+
+		`</C:free-busy-query>`, map[string]string{"Depth": "1"})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != calendarContentType {
+		t.Fatalf("unexpected response %s %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+
+	for _, expected := range []string{"BEGIN:VFREEBUSY\r\n", "FREEBUSY;FBTYPE=BUSY:20160711T100000Z/20160711T110000Z\r\n"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected free/busy time to contain %q:\n%s", expected, body)
+		}
+	}
+}
+
+func TestHandlerMkcalendar(t *testing.T) {
+	storage, server := newTestServer(t)
+	body := `<?xml version="1.0"?>` +
+		`<C:mkcalendar xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><D:set><D:prop>` +
+		`<D:displayname>Tasks</D:displayname>` +
+		`<C:supported-calendar-component-set><C:comp name="VTODO"/></C:supported-calendar-component-set>` +
+		`</D:prop></D:set></C:mkcalendar>`
+
+	if resp, _ := request(t, server, "MKCALENDAR", "/dav/tasks/", body, nil); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("unexpected status %s", resp.Status)
+	}
+
+	col, err := storage.GetCalendar(context.Background(), "/tasks/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if col.Name != "Tasks" || len(col.Components) != 1 || col.Components[0] != "VTODO" {
+		t.Errorf("unexpected calendar %+v", col)
+	}
+
+	if resp, _ := request(t, server, "MKCALENDAR", "/dav/tasks/", "", nil); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected existing calendar not to be created, got %s", resp.Status)
+	}
+
+	if resp, _ := request(t, server, http.MethodDelete, "/dav/tasks/", "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("unexpected status %s", resp.Status)
+	}
+
+	if _, err := storage.GetCalendar(context.Background(), "/tasks/"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected calendar to be deleted, got %v", err)
+	}
+}
+
+func TestHandlerObjectContent(t *testing.T) {
+	storage, server := newTestServer(t)
+	content := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//example.com//Client//EN",
+		"BEGIN:VEVENT",
+		"UID:party@example.com",
+		"DTSTART:20160704T180000Z",
+		"SUMMARY:Party",
+		"CATEGORIES:FUN,FRIENDS",
+		"URL:https://example.com/party",
+		"X-FOO;X-BAR=1:baz",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+
+	resp, _ := request(t, server, http.MethodPut, "/dav/work/party.ics", content, map[string]string{"If-None-Match": "*"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("unexpected status %s", resp.Status)
+	}
+	etag := resp.Header.Get("ETag")
+
+	// the content is returned as it was written, even without DTSTAMP
+	for i := 0; i < 2; i++ {
+		resp, body := request(t, server, http.MethodGet, "/dav/work/party.ics", "", nil)
+		if body != content || resp.Header.Get("ETag") != etag {
+			t.Errorf("expected the content written with ETag %s, got %s:\n%s", etag, resp.Header.Get("ETag"), body)
+		}
+	}
+
+	objects, err := newServerClient(t, server).QueryCalendar(context.Background(), "work/", Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(objects) != 1 || string(objects[0].Data) != content || objects[0].ETag != etag {
+		t.Errorf("expected calendar data to be the content written, got %+v", objects)
+	}
+
+	// the same UID can not be in two calendar objects of the calendar
+	resp, body := request(t, server, http.MethodPut, "/dav/work/copy.ics", content, nil)
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "no-uid-conflict") || !strings.Contains(body, "/dav/work/party.ics") {
+		t.Errorf("expected a UID conflict, got %s:\n%s", resp.Status, body)
+	}
+
+	// the prefix is a whole segment of the path
+	if resp, _ := request(t, server, http.MethodGet, "/davwork/party.ics", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected paths out of the prefix not to be found, got %s", resp.Status)
+	}
+
+	// the preconditions are checked by the storage when it writes
+	ctx := context.Background()
+	cal := weekly("new")
+	if _, err := storage.PutObject(ctx, "/work/new.ics", []byte("new"), cal, Preconditions{IfNoneMatch: "*"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.PutObject(ctx, "/work/new.ics", []byte("other"), cal, Preconditions{IfNoneMatch: "*"}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expected existing object not to be replaced, got %v", err)
+	}
+
+	if err := storage.DeleteObject(ctx, "/work/new.ics", Preconditions{IfMatch: etag}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expected object with another ETag not to be deleted, got %v", err)
+	}
+}
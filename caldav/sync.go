@@ -0,0 +1,151 @@
+package caldav
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/erizocosmico/go-ics"
+)
+
+// SyncChanges are the changes of a calendar since a sync token.
+type SyncChanges struct {
+	// Token is the sync token of the state of the calendar with the
+	// changes, which is the one to use in the next synchronization.
+	Token string
+	// Updated are the calendar objects that were created or changed.
+	Updated []Object
+	// Deleted are the paths of the calendar objects that were deleted.
+	Deleted []string
+}
+
+// SyncCalendar returns the changes of the calendar at the given path since
+// the state of the given sync token, using the sync-collection report of
+// RFC 6578. An empty token returns all the calendar objects. If the server
+// does not accept the token, which happens when it is too old, the error
+// is ErrInvalidSyncToken and the synchronization has to start again with an
+// empty token.
+func (c *Client) SyncCalendar(ctx context.Context, path, token string) (*SyncChanges, error) {
+	body := xmlHeader +
+		`<D:sync-collection xmlns:D="DAV:">` +
+		`<D:sync-token>` + escape(token) + `</D:sync-token>` +
+		`<D:sync-level>1</D:sync-level>` +
+		`<D:prop><D:getetag/></D:prop>` +
+		`</D:sync-collection>`
+
+	ms, err := c.report(ctx, path, "0", body)
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && token != "" && (httpErr.StatusCode == http.StatusForbidden || httpErr.StatusCode == http.StatusConflict) {
+		return nil, ErrInvalidSyncToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	changes := &SyncChanges{Token: ms.SyncToken}
+	var updated []string
+	for _, r := range ms.Responses {
+		if len(r.Hrefs) == 0 {
+			continue
+		}
+
+		if statusCode(r.Status) == http.StatusNotFound {
+			changes.Deleted = append(changes.Deleted, r.Hrefs[0])
+			continue
+		}
+		updated = append(updated, r.Hrefs[0])
+	}
+
+	if len(updated) > 0 {
+		// the report only has the ETags of the objects
+		if changes.Updated, err = c.MultiGet(ctx, path, updated...); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// LocalCalendar is a local copy of a calendar of a server, which is kept up
+// to date with Client.Sync. Its sync token and objects can be stored to
+// resume the synchronization later.
+type LocalCalendar struct {
+	Path      string
+	SyncToken string
+	// Objects are the calendar objects of the calendar by their path.
+	Objects map[string]Object
+}
+
+// NewLocalCalendar returns a new empty local copy of the calendar at the
+// given path, which has not been synchronized yet.
+func NewLocalCalendar(path string) *LocalCalendar {
+	return &LocalCalendar{Path: path, Objects: make(map[string]Object)}
+}
+
+// Apply applies the changes to the local calendar.
+func (l *LocalCalendar) Apply(changes *SyncChanges) {
+	if l.Objects == nil {
+		l.Objects = make(map[string]Object)
+	}
+
+	for _, o := range changes.Updated {
+		l.Objects[o.Path] = o
+	}
+
+	for _, p := range changes.Deleted {
+		delete(l.Objects, p)
+	}
+	l.SyncToken = changes.Token
+}
+
+// Calendar returns a calendar with the components of all the calendar
+// objects of the local calendar.
+func (l *LocalCalendar) Calendar() ics.Calendar {
+	paths := make([]string, 0, len(l.Objects))
+	for p := range l.Objects {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	cal := ics.NewCalendar()
+	for _, p := range paths {
+		o := l.Objects[p]
+		cal.Events = append(cal.Events, o.Calendar.Events...)
+		cal.Todos = append(cal.Todos, o.Calendar.Todos...)
+		cal.Journals = append(cal.Journals, o.Calendar.Journals...)
+		cal.FreeBusies = append(cal.FreeBusies, o.Calendar.FreeBusies...)
+		cal.Availabilities = append(cal.Availabilities, o.Calendar.Availabilities...)
+	}
+	return cal
+}
+
+// Sync brings the local calendar up to date with the calendar of the
+// server and returns the changes applied to it. If the server does not
+// accept its sync token, all the calendar objects are fetched again, and
+// the ones that are no longer in the server are deleted.
+func (c *Client) Sync(ctx context.Context, l *LocalCalendar) (*SyncChanges, error) {
+	changes, err := c.SyncCalendar(ctx, l.Path, l.SyncToken)
+	if errors.Is(err, ErrInvalidSyncToken) {
+		if changes, err = c.SyncCalendar(ctx, l.Path, ""); err != nil {
+			return nil, err
+		}
+
+		found := make(map[string]bool, len(changes.Updated))
+		for _, o := range changes.Updated {
+			found[o.Path] = true
+		}
+
+		for p := range l.Objects {
+			if !found[p] {
+				changes.Deleted = append(changes.Deleted, p)
+			}
+		}
+		sort.Strings(changes.Deleted)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	l.Apply(changes)
+	return changes, nil
+}
@@ -0,0 +1,161 @@
+package caldav
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func objectPaths(l *LocalCalendar) string {
+	var paths []string
+	for p := range l.Objects {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, ",")
+}
+
+func TestSync(t *testing.T) {
+	_, server := newTestServer(t)
+	client := newServerClient(t, server)
+	ctx := context.Background()
+
+	for _, uid := range []string{"a", "b"} {
+		if _, err := client.PutObject(ctx, "work/"+uid+".ics", weekly(uid), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	local := NewLocalCalendar("work/")
+	changes, err := client.Sync(ctx, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes.Updated) != 2 || len(changes.Deleted) != 0 || local.SyncToken == "" {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+
+	if objectPaths(local) != "/dav/work/a.ics,/dav/work/b.ics" {
+		t.Errorf("unexpected objects %s", objectPaths(local))
+	}
+
+	calendars, err := client.ListCalendars(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calendars) != 1 || calendars[0].SyncToken != local.SyncToken {
+		t.Errorf("expected calendar to have sync token %q, got %+v", local.SyncToken, calendars)
+	}
+
+	changes, err = client.Sync(ctx, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes.Updated) != 0 || len(changes.Deleted) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+
+	// the token is stored and the synchronization resumes later
+	token := local.SyncToken
+
+	b := local.Objects["/dav/work/b.ics"]
+	b.Calendar.Events[0].Summary = "Renamed"
+	if _, err := client.PutObject(ctx, b.Path, &b.Calendar, b.ETag); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.DeleteObject(ctx, "work/a.ics", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.PutObject(ctx, "work/c.ics", weekly("c"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err = client.SyncCalendar(ctx, "work/", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes.Updated) != 2 || len(changes.Deleted) != 1 || changes.Deleted[0] != "/dav/work/a.ics" {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+
+	local.Apply(changes)
+	if objectPaths(local) != "/dav/work/b.ics,/dav/work/c.ics" {
+		t.Errorf("unexpected objects %s", objectPaths(local))
+	}
+
+	cal := local.Calendar()
+	if len(cal.Events) != 2 || cal.Events[0].Summary != "Renamed" || cal.Events[1].ID != "c" {
+		t.Errorf("unexpected calendar %+v", cal.Events)
+	}
+}
+
+func TestSyncInvalidToken(t *testing.T) {
+	_, server := newTestServer(t)
+	client := newServerClient(t, server)
+	ctx := context.Background()
+
+	if _, err := client.PutObject(ctx, "work/a.ics", weekly("a"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.SyncCalendar(ctx, "work/", "data:,1-1"); !errors.Is(err, ErrInvalidSyncToken) {
+		t.Errorf("expected an invalid sync token error, got %v", err)
+	}
+
+	// a copy from a storage that is gone
+	local := NewLocalCalendar("work/")
+	local.SyncToken = "data:,1-1"
+	local.Objects["/dav/work/gone.ics"] = Object{Path: "/dav/work/gone.ics"}
+
+	changes, err := client.Sync(ctx, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes.Deleted) != 1 || changes.Deleted[0] != "/dav/work/gone.ics" {
+		t.Errorf("expected missing objects to be deleted, got %+v", changes)
+	}
+
+	if objectPaths(local) != "/dav/work/a.ics" || local.SyncToken == "data:,1-1" {
+		t.Errorf("unexpected local calendar %s %s", objectPaths(local), local.SyncToken)
+	}
+
+	// a calendar that is deleted and created again has the same version
+	storage := NewMemoryStorage()
+	if err := storage.CreateCalendar(ctx, Collection{Path: "/home/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	col, err := storage.GetCalendar(ctx, "/home/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.DeleteCalendar(ctx, "/home/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.CreateCalendar(ctx, Collection{Path: "/home/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := storage.Changes(ctx, "/home/", col.SyncToken); !errors.Is(err, ErrInvalidSyncToken) {
+		t.Errorf("expected token of the deleted calendar to be invalid, got %v", err)
+	}
+
+	resp, _ := request(t, server, "REPORT", "/dav/work/", `<?xml version="1.0"?>`+
+		`<D:sync-collection xmlns:D="DAV:"><D:sync-token/><D:sync-level>1</D:sync-level><D:prop/></D:sync-collection>`,
+		map[string]string{"Depth": "1"})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a depth other than 0 to be rejected, got %s", resp.Status)
+	}
+}
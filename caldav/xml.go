@@ -0,0 +1,188 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Namespaces of the XML elements of CalDAV.
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+// timeRangeFormat is the format of the times of time-range filters.
+const timeRangeFormat = "20060102T150405Z"
+
+type multistatus struct {
+	XMLName   xml.Name   `xml:"DAV: multistatus"`
+	Responses []response `xml:"DAV: response"`
+	SyncToken string     `xml:"DAV: sync-token,omitempty"`
+}
+
+type response struct {
+	Hrefs     []string   `xml:"DAV: href"`
+	Status    string     `xml:"DAV: status,omitempty"`
+	Propstats []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Prop   prop   `xml:"DAV: prop"`
+	Status string `xml:"DAV: status"`
+}
+
+type prop struct {
+	ResourceType         *resourceType `xml:"DAV: resourcetype,omitempty"`
+	DisplayName          string        `xml:"DAV: displayname,omitempty"`
+	ETag                 string        `xml:"DAV: getetag,omitempty"`
+	CurrentUserPrincipal *href         `xml:"DAV: current-user-principal,omitempty"`
+	CalendarHomeSet      *href         `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set,omitempty"`
+	CalendarDescription  string        `xml:"urn:ietf:params:xml:ns:caldav calendar-description,omitempty"`
+	SupportedComponents  *compSet      `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set,omitempty"`
+	CalendarData         string        `xml:"urn:ietf:params:xml:ns:caldav calendar-data,omitempty"`
+	CTag                 string        `xml:"http://calendarserver.org/ns/ getctag,omitempty"`
+	SyncToken            string        `xml:"DAV: sync-token,omitempty"`
+}
+
+type resourceType struct {
+	Collection *struct{} `xml:"DAV: collection,omitempty"`
+	Calendar   *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar,omitempty"`
+}
+
+type href struct {
+	Href string `xml:"DAV: href"`
+}
+
+type compSet struct {
+	Comps []comp `xml:"urn:ietf:params:xml:ns:caldav comp"`
+}
+
+type comp struct {
+	Name string `xml:"name,attr"`
+}
+
+// ok returns the properties of the response that were found.
+func (r *response) ok() prop {
+	var p prop
+	for _, ps := range r.Propstats {
+		if statusCode(ps.Status) == 200 {
+			p = ps.Prop
+		}
+	}
+	return p
+}
+
+// statusCode returns the code of an HTTP status line, such as
+// "HTTP/1.1 200 OK", or 0 if it has none.
+func statusCode(status string) int {
+	fields := strings.Fields(status)
+	if len(fields) < 2 {
+		return 0
+	}
+
+	code, _ := strconv.Atoi(fields[1])
+	return code
+}
+
+// escape returns the text escaped to be used in XML.
+func escape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func formatTimeRange(t time.Time) string {
+	return t.UTC().Format(timeRangeFormat)
+}
+
+// propfindRequest is the body of PROPFIND requests, and of the REPORT
+// requests that ask for some properties.
+type propfindRequest struct {
+	AllProp *struct{}  `xml:"DAV: allprop"`
+	Prop    *propNames `xml:"DAV: prop"`
+}
+
+type propNames struct {
+	Names []anyElement `xml:",any"`
+}
+
+type anyElement struct {
+	XMLName xml.Name
+}
+
+type reportRequest struct {
+	XMLName xml.Name
+	propfindRequest
+	Hrefs     []string   `xml:"DAV: href"`
+	Filter    *filter    `xml:"urn:ietf:params:xml:ns:caldav filter"`
+	TimeRange *timeRange `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	SyncToken string     `xml:"DAV: sync-token"`
+	SyncLevel string     `xml:"DAV: sync-level"`
+}
+
+type filter struct {
+	CompFilter compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+type compFilter struct {
+	Name         string       `xml:"name,attr"`
+	IsNotDefined *struct{}    `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TimeRange    *timeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	CompFilters  []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+type timeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+// times returns the start and end of the time range, which are zero if
+// they are not defined.
+func (tr *timeRange) times() (start, end time.Time, err error) {
+	if tr.Start != "" {
+		if start, err = time.Parse(timeRangeFormat, tr.Start); err != nil {
+			return
+		}
+	}
+
+	if tr.End != "" {
+		end, err = time.Parse(timeRangeFormat, tr.End)
+	}
+	return
+}
+
+type mkcalendarRequest struct {
+	Set struct {
+		Prop prop `xml:"DAV: prop"`
+	} `xml:"DAV: set"`
+}
+
+// rawProp is a property of a resource, with its content as XML.
+type rawProp struct {
+	XMLName xml.Name
+	Inner   string `xml:",innerxml"`
+}
+
+type responseOut struct {
+	XMLName   xml.Name      `xml:"DAV: response"`
+	Href      string        `xml:"DAV: href"`
+	Status    string        `xml:"DAV: status,omitempty"`
+	Propstats []propstatOut `xml:"DAV: propstat"`
+}
+
+type propstatOut struct {
+	Prop struct {
+		Props []rawProp
+	} `xml:"DAV: prop"`
+	Status string `xml:"DAV: status"`
+}
+
+type multistatusOut struct {
+	XMLName   xml.Name `xml:"DAV: multistatus"`
+	Responses []responseOut
+	SyncToken string `xml:"DAV: sync-token,omitempty"`
+}
@@ -2,19 +2,47 @@ package ics
 
 import "time"
 
-// Calendar represents a single calendar with events
+// Calendar represents a single calendar with events. Calendars that are
+// iTIP scheduling messages have the method of the message (METHOD), such as
+// REQUEST, in Method.
 type Calendar struct {
 	Name        string
 	Description string
 	URL         string
 	Version     float64
+	Method      string
 	Timezone    *time.Location
 	Events      []Event
+	Todos       []Todo
+	Journals    []Journal
+	FreeBusies  []FreeBusy
+
+	// Availabilities are the times in which the owner of the calendar is
+	// available, which make them busy outside of them.
+	Availabilities []Availability
+
+	// Timezones are the timezones defined in the calendar, which are used
+	// to resolve the TZIDs of its times.
+	Timezones Timezones
+
+	// TimezoneErrors are the errors of the VTIMEZONE components that could
+	// not be parsed. Their TZIDs are resolved as if the calendar did not
+	// define them, with the IANA database or the registered aliases.
+	TimezoneErrors []error
+
+	// Component is the raw VCALENDAR component the calendar was parsed
+	// from, with all of its properties, including the ones not mapped to
+	// any field. It is nil for calendars that were not parsed.
+	Component *Component
 }
 
 // NewCalendar returns a new empty calendar instance
 func NewCalendar() Calendar {
 	return Calendar{
-		Events: []Event{},
+		Events:         []Event{},
+		Todos:          []Todo{},
+		Journals:       []Journal{},
+		FreeBusies:     []FreeBusy{},
+		Availabilities: []Availability{},
 	}
 }
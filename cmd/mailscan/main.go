@@ -0,0 +1,108 @@
+// Command mailscan prints the history of the events sent by email in some
+// mbox files or Maildir directories, such as archived mailboxes:
+//
+//	mailscan [-o calendar.ics] mailbox...
+//
+// Every version of an event, and every reply to it, is printed with the
+// email it comes from. With -o, the last version of all the events is
+// written to an ics file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/erizocosmico/go-ics/imip"
+)
+
+func main() {
+	output := flag.String("o", "", "write the last version of the events to this ics file")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: mailscan [-o calendar.ics] mailbox...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*output, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "mailscan:", err)
+		os.Exit(1)
+	}
+}
+
+func run(output string, mailboxes []string) error {
+	t := imip.NewTimeline()
+	for _, m := range mailboxes {
+		if err := t.Scan(m); err != nil {
+			return err
+		}
+	}
+
+	for _, err := range t.Errors {
+		fmt.Fprintln(os.Stderr, "mailscan: skipping", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "UID\tRECURRENCE-ID\tSEQUENCE\tMETHOD\tSTART\tATTENDEES\tDATE\tFROM\tSOURCE")
+	for _, e := range t.Entries {
+		var recurrenceID string
+		if !e.Event.RecurrenceID.IsZero() {
+			recurrenceID = e.Event.RecurrenceID.Format(time.RFC3339)
+		}
+
+		var attendees string
+		for i, a := range e.Event.Attendees {
+			if i > 0 {
+				attendees += ","
+			}
+			attendees += a.Email
+			if a.Status != "" {
+				attendees += "=" + a.Status
+			}
+		}
+
+		source := e.Source.Path
+		if e.Source.Offset > 0 {
+			source = fmt.Sprintf("%s@%d", source, e.Source.Offset)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Event.ID,
+			recurrenceID,
+			e.Event.Sequence,
+			e.Method,
+			e.Event.Start.Format(time.RFC3339),
+			attendees,
+			e.Source.Date.Format(time.RFC3339),
+			e.Source.From,
+			source,
+		)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if output == "" {
+		return nil
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	cal, _ := t.Calendar()
+	if _, err := cal.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
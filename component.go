@@ -0,0 +1,215 @@
+package ics
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Component is a generic iCalendar component, such as VCALENDAR, VEVENT or
+// VALARM, with all of its properties and nested components in the order
+// they appeared. Properties and components unknown to this package,
+// including vendor extensions, are kept as well.
+type Component struct {
+	Name       string
+	Properties []*Property
+	Children   []*Component
+
+	// raw is the exact text the component was decoded from, begin and end
+	// are its BEGIN and END lines, and props and children are the
+	// properties and components it had at that moment.
+	raw        string
+	begin, end *Property
+	props      []*Property
+	children   []*Component
+
+	// typed is the component generated from the typed entity, such as an
+	// Event, right after it was parsed from this component. It is used to
+	// know which properties changed in the entity when writing it back.
+	typed *Component
+
+	// origin is the decoded component a component generated from a typed
+	// entity, such as an Alarm, comes from.
+	origin *Component
+}
+
+// unchanged reports whether the component was decoded and neither it nor
+// any of its properties and nested components have been modified since.
+func (c *Component) unchanged() bool {
+	if c.raw == "" || !strings.EqualFold(c.begin.Value, c.Name) {
+		return false
+	}
+
+	if len(c.props) != len(c.Properties) || len(c.children) != len(c.Children) {
+		return false
+	}
+
+	for i, p := range c.Properties {
+		if p != c.props[i] || !p.unchanged() {
+			return false
+		}
+	}
+
+	for i, child := range c.Children {
+		if child != c.children[i] || !child.unchanged() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// delimiter returns the BEGIN or END property of the component, which is
+// the decoded one if the component was decoded with the same name.
+func (c *Component) delimiter(decoded *Property, name string) *Property {
+	if decoded != nil && strings.EqualFold(decoded.Value, c.Name) {
+		return decoded
+	}
+	return &Property{Name: name, Value: c.Name}
+}
+
+// NewComponent returns a new empty component with the given name.
+func NewComponent(name string) *Component {
+	return &Component{Name: strings.ToUpper(name)}
+}
+
+// Property returns the first property with the given name or nil if the
+// component has no such property.
+func (c *Component) Property(name string) *Property {
+	for _, p := range c.Properties {
+		if strings.EqualFold(p.Name, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// PropertiesNamed returns all the properties with the given name.
+func (c *Component) PropertiesNamed(name string) []*Property {
+	var result []*Property
+	for _, p := range c.Properties {
+		if strings.EqualFold(p.Name, name) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// Value returns the value of the first property with the given name or an
+// empty string if there is none.
+func (c *Component) Value(name string) string {
+	if p := c.Property(name); p != nil {
+		return p.Value
+	}
+	return ""
+}
+
+// Add appends a new property to the component.
+func (c *Component) Add(prop *Property) {
+	c.Properties = append(c.Properties, prop)
+}
+
+// Set replaces all the properties with the same name as the given one with
+// it. The property keeps the position of the first replaced property or is
+// appended if there was none.
+func (c *Component) Set(prop *Property) {
+	var (
+		result   []*Property
+		replaced bool
+	)
+
+	for _, p := range c.Properties {
+		if !strings.EqualFold(p.Name, prop.Name) {
+			result = append(result, p)
+		} else if !replaced {
+			result = append(result, prop)
+			replaced = true
+		}
+	}
+
+	if !replaced {
+		result = append(result, prop)
+	}
+	c.Properties = result
+}
+
+// Del removes all the properties with the given name.
+func (c *Component) Del(name string) {
+	var result []*Property
+	for _, p := range c.Properties {
+		if !strings.EqualFold(p.Name, name) {
+			result = append(result, p)
+		}
+	}
+	c.Properties = result
+}
+
+// ChildrenNamed returns all the nested components with the given name.
+func (c *Component) ChildrenNamed(name string) []*Component {
+	var result []*Component
+	for _, child := range c.Children {
+		if strings.EqualFold(child.Name, name) {
+			result = append(result, child)
+		}
+	}
+	return result
+}
+
+// Decode reads the next complete component of the stream, including all of
+// its nested components. It returns io.EOF when there are no more components.
+func (d *Decoder) Decode() (*Component, error) {
+	var (
+		stack []*Component
+		raw   []*strings.Builder
+	)
+
+	for {
+		prop, err := d.ReadProperty()
+		if err == io.EOF {
+			if len(stack) > 0 {
+				return nil, &SyntaxError{Line: d.line, Msg: fmt.Sprintf("missing END:%s", stack[len(stack)-1].Name)}
+			}
+			return nil, io.EOF
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch prop.Name {
+		case "BEGIN":
+			c := NewComponent(prop.Value)
+			c.begin = prop
+			stack = append(stack, c)
+			raw = append(raw, &strings.Builder{})
+			raw[len(raw)-1].WriteString(prop.raw)
+		case "END":
+			if len(stack) == 0 || !strings.EqualFold(stack[len(stack)-1].Name, prop.Value) {
+				return nil, &SyntaxError{Line: d.line, Msg: fmt.Sprintf("unexpected END:%s", prop.Value)}
+			}
+
+			c := stack[len(stack)-1]
+			c.end = prop
+			raw[len(raw)-1].WriteString(prop.raw)
+			c.raw = raw[len(raw)-1].String()
+			c.props = append([]*Property(nil), c.Properties...)
+			c.children = append([]*Component(nil), c.Children...)
+
+			stack = stack[:len(stack)-1]
+			raw = raw[:len(raw)-1]
+			if len(stack) == 0 {
+				return c, nil
+			}
+
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, c)
+			raw[len(raw)-1].WriteString(c.raw)
+		default:
+			if len(stack) == 0 {
+				return nil, &SyntaxError{Line: d.line, Msg: fmt.Sprintf("property %s outside of a component", prop.Name)}
+			}
+
+			c := stack[len(stack)-1]
+			c.Properties = append(c.Properties, prop)
+			raw[len(raw)-1].WriteString(prop.raw)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package ics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalendarComponent(t *testing.T) {
+	calendar, err := ParseCalendar("testCalendars/2eventsCal.ics", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comp := calendar.Component
+	if comp == nil || comp.Name != "VCALENDAR" {
+		t.Fatalf("expected a VCALENDAR component, got %v", comp)
+	}
+
+	if v := comp.Value("PRODID"); v != "-//Google Inc//Google Calendar 70.9054//EN" {
+		t.Errorf("expected PRODID to be kept, got %q", v)
+	}
+
+	if v := comp.Value("CALSCALE"); v != "GREGORIAN" {
+		t.Errorf("expected CALSCALE %q, got %q", "GREGORIAN", v)
+	}
+
+	tzs := comp.ChildrenNamed("VTIMEZONE")
+	if len(tzs) != 1 {
+		t.Fatalf("expected %d VTIMEZONE, got %d", 1, len(tzs))
+	}
+
+	if v := tzs[0].Value("X-LIC-LOCATION"); v != "Europe/Madrid" {
+		t.Errorf("expected X-LIC-LOCATION %q, got %q", "Europe/Madrid", v)
+	}
+
+	if len(tzs[0].Children) != 2 {
+		t.Errorf("expected %d observances, got %d", 2, len(tzs[0].Children))
+	}
+
+	for _, e := range calendar.Events {
+		if e.Component == nil || e.Component.Value("TRANSP") != "OPAQUE" {
+			t.Errorf("expected event %q to keep its raw component", e.Summary)
+		}
+	}
+}
+
+func TestDecodeNestedComponents(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:1\r\n" +
+		"X-GOOGLE-CONFERENCE:https://meet.example.com/abc\r\n" +
+		"BEGIN:VALARM\r\n" +
+		"ACTION:DISPLAY\r\n" +
+		"TRIGGER:-PT10M\r\n" +
+		"END:VALARM\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	comp, err := NewDecoder(strings.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := comp.ChildrenNamed("VEVENT")
+	if len(events) != 1 {
+		t.Fatalf("expected %d event, got %d", 1, len(events))
+	}
+
+	if v := events[0].Value("x-google-conference"); v != "https://meet.example.com/abc" {
+		t.Errorf("expected vendor property to be kept, got %q", v)
+	}
+
+	alarms := events[0].ChildrenNamed("VALARM")
+	if len(alarms) != 1 || alarms[0].Value("TRIGGER") != "-PT10M" {
+		t.Errorf("expected VALARM to be kept, got %v", alarms)
+	}
+}
+
+func TestDecodeUnbalancedComponents(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VCALENDAR\r\n"
+	if _, err := NewDecoder(strings.NewReader(data)).Decode(); err == nil {
+		t.Errorf("expected an error decoding unbalanced components")
+	}
+}
+
+func TestComponentSet(t *testing.T) {
+	c := NewComponent("vevent")
+	c.Add(&Property{Name: "SUMMARY", Value: "a"})
+	c.Add(&Property{Name: "ATTENDEE", Value: "mailto:a@example.com"})
+	c.Add(&Property{Name: "ATTENDEE", Value: "mailto:b@example.com"})
+	c.Set(&Property{Name: "ATTENDEE", Value: "mailto:c@example.com"})
+
+	if len(c.Properties) != 2 || c.Properties[1].Value != "mailto:c@example.com" {
+		t.Errorf("expected attendees to be replaced, got %v", c.Properties)
+	}
+
+	c.Del("summary")
+	if c.Property("SUMMARY") != nil {
+		t.Errorf("expected SUMMARY to be deleted")
+	}
+}
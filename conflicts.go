@@ -0,0 +1,170 @@
+package ics
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Conflict is a pair of occurrences that overlap, First being the one that
+// starts first. Start and End are the time in which both take place.
+type Conflict struct {
+	First  Occurrence
+	Second Occurrence
+	Start  time.Time
+	End    time.Time
+}
+
+// ConflictDetector finds the occurrences of the events of some calendars
+// that overlap. Transparent and cancelled events never conflict, and
+// occurrences that end when another one starts do not overlap. Whole day
+// events take the whole day in the timezone of their calendar.
+type ConflictDetector struct {
+	tree intervalTree
+}
+
+// NewConflictDetector returns a detector of the conflicts between the
+// occurrences of the events of the given calendars that overlap with the
+// time window between from and to, which must have an end.
+func NewConflictDetector(from, to time.Time, calendars ...*Calendar) *ConflictDetector {
+	var occurrences []Occurrence
+	for _, cal := range calendars {
+		for o := range cal.Between(from, to) {
+			if o.Event.Transparent || strings.EqualFold(o.Event.Status, "CANCELLED") || !o.Start.Before(o.End) {
+				continue
+			}
+			occurrences = append(occurrences, o)
+		}
+	}
+
+	return &ConflictDetector{tree: newIntervalTree(occurrences)}
+}
+
+// Overlapping returns the occurrences that overlap with the time between
+// start and end, such as a new booking, ordered by their start.
+func (d *ConflictDetector) Overlapping(start, end time.Time) []Occurrence {
+	var result []Occurrence
+	d.tree.query(start, end, func(i int) {
+		result = append(result, d.tree.items[i])
+	})
+	return result
+}
+
+// Conflicts returns all the pairs of occurrences that overlap, ordered by
+// the start of their first occurrence.
+func (d *ConflictDetector) Conflicts() []Conflict {
+	var result []Conflict
+	for i, o := range d.tree.items {
+		d.tree.query(o.Start, o.End, func(j int) {
+			if j <= i {
+				return
+			}
+
+			second := d.tree.items[j]
+			c := Conflict{First: o, Second: second, Start: second.Start, End: o.End}
+			if second.End.Before(c.End) {
+				c.End = second.End
+			}
+			result = append(result, c)
+		})
+	}
+	return result
+}
+
+// Clusters returns the groups of occurrences that conflict with each other,
+// directly or through other occurrences of the group, ordered by their
+// start. Occurrences without conflicts are left out.
+func (d *ConflictDetector) Clusters() [][]Occurrence {
+	var result [][]Occurrence
+	var cluster []Occurrence
+	var end time.Time
+	for _, o := range d.tree.items {
+		if len(cluster) > 0 && o.Start.Before(end) {
+			cluster = append(cluster, o)
+			if o.End.After(end) {
+				end = o.End
+			}
+			continue
+		}
+
+		if len(cluster) > 1 {
+			result = append(result, cluster)
+		}
+		cluster, end = []Occurrence{o}, o.End
+	}
+
+	if len(cluster) > 1 {
+		result = append(result, cluster)
+	}
+	return result
+}
+
+// intervalTree is a static interval tree of occurrences. The occurrences
+// are sorted by their start and form an implicit balanced binary search
+// tree, in which the root of the items between lo and hi is the one in the
+// middle. Each node keeps the maximum end of its subtree, so the subtrees
+// that end before a time window can be skipped.
+type intervalTree struct {
+	items  []Occurrence
+	maxEnd []time.Time
+}
+
+func newIntervalTree(items []Occurrence) intervalTree {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Start.Equal(items[j].Start) {
+			return items[i].End.Before(items[j].End)
+		}
+		return items[i].Start.Before(items[j].Start)
+	})
+
+	t := intervalTree{items: items, maxEnd: make([]time.Time, len(items))}
+	t.build(0, len(items))
+	return t
+}
+
+// build computes the maximum end of the subtree with the items between lo,
+// inclusive, and hi and returns it.
+func (t *intervalTree) build(lo, hi int) time.Time {
+	if lo >= hi {
+		return time.Time{}
+	}
+
+	mid := (lo + hi) / 2
+	end := t.items[mid].End
+	for _, e := range []time.Time{t.build(lo, mid), t.build(mid+1, hi)} {
+		if e.After(end) {
+			end = e
+		}
+	}
+
+	t.maxEnd[mid] = end
+	return end
+}
+
+// query calls fn with the index of every item that overlaps with the time
+// between start and end, in order.
+func (t *intervalTree) query(start, end time.Time, fn func(int)) {
+	t.queryRange(0, len(t.items), start, end, fn)
+}
+
+func (t *intervalTree) queryRange(lo, hi int, start, end time.Time, fn func(int)) {
+	if lo >= hi {
+		return
+	}
+
+	mid := (lo + hi) / 2
+	if !t.maxEnd[mid].After(start) {
+		return
+	}
+
+	t.queryRange(lo, mid, start, end, fn)
+	if !t.items[mid].Start.Before(end) {
+		// the items after it start even later
+		return
+	}
+
+	if t.items[mid].End.After(start) {
+		fn(mid)
+	}
+	t.queryRange(mid+1, hi, start, end, fn)
+}
@@ -0,0 +1,148 @@
+package ics
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConflictDetector(t *testing.T) {
+	room, err := ParseICalContent(strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"DTSTART:20160704T090000Z",
+		"DTEND:20160704T093000Z",
+		"RRULE:FREQ=DAILY;COUNT=5",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:planning",
+		"DTSTART:20160705T091500Z",
+		"DTEND:20160705T100000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:retro",
+		"DTSTART:20160705T095000Z",
+		"DTEND:20160705T103000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:adjacent",
+		"DTSTART:20160706T093000Z",
+		"DTEND:20160706T100000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:cancelled",
+		"DTSTART:20160706T090000Z",
+		"DTEND:20160706T100000Z",
+		"STATUS:CANCELLED",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:reminder",
+		"DTSTART:20160707T090000Z",
+		"DTEND:20160707T100000Z",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n"), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleaning, err := ParseICalContent(strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:cleaning",
+		"DTSTART;VALUE=DATE:20160708",
+		"DTEND;VALUE=DATE:20160709",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n"), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := func(day, hour, min int) time.Time {
+		return time.Date(2016, time.July, day, hour, min, 0, 0, time.UTC)
+	}
+
+	d := NewConflictDetector(date(4, 0, 0), date(11, 0, 0), &room, &cleaning)
+	conflicts := d.Conflicts()
+
+	expected := []struct {
+		first, second string
+		start, end    time.Time
+	}{
+		{"standup", "planning", date(5, 9, 15), date(5, 9, 30)},
+		{"planning", "retro", date(5, 9, 50), date(5, 10, 0)},
+		{"cleaning", "standup", date(8, 9, 0), date(8, 9, 30)},
+	}
+
+	if len(conflicts) != len(expected) {
+		t.Fatalf("expected %d conflicts, got %v", len(expected), conflicts)
+	}
+
+	for i, c := range conflicts {
+		e := expected[i]
+		if c.First.Event.ID != e.first || c.Second.Event.ID != e.second || !c.Start.Equal(e.start) || !c.End.Equal(e.end) {
+			t.Errorf("expected conflict %d between %s and %s from %s to %s, got %s and %s from %s to %s",
+				i, e.first, e.second, e.start, e.end, c.First.Event.ID, c.Second.Event.ID, c.Start, c.End)
+		}
+	}
+
+	clusters := d.Clusters()
+	if len(clusters) != 2 || len(clusters[0]) != 3 || len(clusters[1]) != 2 {
+		t.Errorf("expected clusters of 3 and 2 occurrences, got %v", clusters)
+	}
+
+	overlapping := d.Overlapping(date(6, 9, 20), date(6, 9, 40))
+	if len(overlapping) != 2 || overlapping[0].Event.ID != "standup" || overlapping[1].Event.ID != "adjacent" {
+		t.Errorf("expected booking to overlap with the standup and the adjacent event, got %v", overlapping)
+	}
+
+	if o := d.Overlapping(date(7, 9, 30), date(7, 10, 0)); len(o) != 0 {
+		t.Errorf("expected no overlapping occurrences, got %v", o)
+	}
+}
+
+func TestIntervalTree(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	base := time.Date(2016, time.July, 4, 0, 0, 0, 0, time.UTC)
+	event := &Event{ID: "random"}
+
+	occurrences := make([]Occurrence, 20000)
+	for i := range occurrences {
+		start := base.Add(time.Duration(r.Intn(365*24*60)) * time.Minute)
+		occurrences[i] = Occurrence{
+			Event: event,
+			Start: start,
+			End:   start.Add(time.Duration(1+r.Intn(3*60)) * time.Minute),
+		}
+	}
+
+	d := &ConflictDetector{tree: newIntervalTree(occurrences)}
+	items := d.tree.items
+
+	var expected int
+	for i := range items {
+		for j := i + 1; j < len(items) && items[j].Start.Before(items[i].End); j++ {
+			expected++
+		}
+	}
+
+	if conflicts := d.Conflicts(); len(conflicts) != expected {
+		t.Errorf("expected %d conflicts, got %d", expected, len(conflicts))
+	}
+
+	start, end := base.Add(100*24*time.Hour), base.Add(101*24*time.Hour)
+	var overlapping int
+	for _, o := range items {
+		if o.Start.Before(end) && o.End.After(start) {
+			overlapping++
+		}
+	}
+
+	if o := d.Overlapping(start, end); len(o) != overlapping {
+		t.Errorf("expected %d overlapping occurrences, got %d", overlapping, len(o))
+	}
+}
@@ -0,0 +1,314 @@
+package ics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateKind is the kind of a date or date-time value of a calendar.
+type DateKind int
+
+const (
+	// UTC is a date-time in UTC, such as 20160704T100000Z.
+	UTC DateKind = iota
+	// Zoned is a date-time in the time zone of its TZID parameter.
+	Zoned
+	// Floating is a date-time without time zone, which happens at the
+	// same wall clock time wherever it is observed.
+	Floating
+	// Date is a whole day, with VALUE=DATE.
+	Date
+)
+
+var dateKindNames = []string{"UTC", "Zoned", "Floating", "Date"}
+
+func (k DateKind) String() string {
+	if k < UTC || k > Date {
+		return fmt.Sprintf("DateKind(%d)", int(k))
+	}
+	return dateKindNames[k]
+}
+
+// DateTime is a date or date-time value as it is in the calendar. For UTC
+// and Zoned values Time is the exact instant. Floating and Date values do
+// not have one until they are resolved with In, so Time only holds their
+// wall clock, in UTC.
+type DateTime struct {
+	Time time.Time
+	Kind DateKind
+	// TZID is the TZID parameter of Zoned values.
+	TZID string
+}
+
+// IsZero reports whether the value is not set.
+func (d DateTime) IsZero() bool {
+	return d.Time.IsZero()
+}
+
+// In returns the instant of the value, resolving Floating and Date values
+// as a wall clock time in the given location.
+func (d DateTime) In(loc *time.Location) time.Time {
+	if d.IsZero() || !d.floating() {
+		return d.Time
+	}
+	return inLocation(d.Time, loc)
+}
+
+// floating reports whether the value is Floating or a Date, which do not
+// have an exact instant.
+func (d DateTime) floating() bool {
+	return d.Kind == Floating || d.Kind == Date
+}
+
+// inLocation returns the time with the same wall clock as t in loc.
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// parsePropertyDateTime parses the given value of a date or date-time
+// property, taking into account its VALUE and TZID parameters. TZIDs are
+// resolved with the given timezones.
+func parsePropertyDateTime(prop *Property, value string, tz Timezones) (DateTime, error) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(prop.Params.Get("VALUE"), "DATE") || len(value) == len(icsFormatWholeDay) {
+		t, err := parseDate(value)
+		return DateTime{Time: t, Kind: Date}, err
+	}
+
+	return parseDatetime(value, prop.Params.Get("TZID"), tz)
+}
+
+// parseDatetime parses a date-time value. If tzid is not empty the time is
+// interpreted as a wall clock time in the location it has in tz. Values
+// without TZID nor a trailing Z are floating.
+func parseDatetime(value, tzid string, tz Timezones) (DateTime, error) {
+	utc := strings.HasSuffix(value, "Z")
+	t, err := time.Parse("20060102T150405", strings.TrimSuffix(value, "Z"))
+	if err != nil {
+		return DateTime{}, err
+	}
+
+	// a TZID takes precedence over a trailing Z, which some producers add
+	// to all their values
+	if tzid != "" {
+		timezone, err := tz.Location(tzid)
+		if err != nil {
+			return DateTime{}, err
+		}
+
+		return DateTime{Time: inLocation(t, timezone), Kind: Zoned, TZID: tzid}, nil
+	}
+
+	if utc {
+		return DateTime{Time: t, Kind: UTC}, nil
+	}
+	return DateTime{Time: t, Kind: Floating}, nil
+}
+
+// resolveDates returns the instants of all the given values, resolving the
+// Floating and Date ones in the given location.
+func resolveDates(values []DateTime, loc *time.Location) []time.Time {
+	var result []time.Time
+	for _, v := range values {
+		result = append(result, v.In(loc))
+	}
+	return result
+}
+
+// ResolveFloating resolves again all the floating and whole day times of
+// the events, todos and journals of the calendar as wall clock times in the given location,
+// which becomes the timezone of the calendar. By default they are resolved
+// in the timezone of the calendar, given by its X-WR-TIMEZONE property.
+func (c *Calendar) ResolveFloating(loc *time.Location) {
+	c.Timezone = loc
+	for i := range c.Events {
+		e := &c.Events[i]
+		if !e.DTStart.floating() {
+			continue
+		}
+
+		e.Start = inLocation(e.Start, loc)
+		if e.DTEnd.floating() || e.DTEnd.IsZero() {
+			e.End = inLocation(e.End, loc)
+		}
+
+		if !e.RecurrenceID.IsZero() {
+			e.RecurrenceID = inLocation(e.RecurrenceID, loc)
+		}
+
+		for j := range e.RDates {
+			e.RDates[j] = inLocation(e.RDates[j], loc)
+		}
+
+		for j := range e.ExDates {
+			e.ExDates[j] = inLocation(e.ExDates[j], loc)
+		}
+	}
+
+	for i := range c.Todos {
+		t := &c.Todos[i]
+		if t.DTStart.floating() {
+			t.Start = inLocation(t.Start, loc)
+		}
+
+		if t.DTDue.floating() {
+			t.Due = inLocation(t.Due, loc)
+		}
+
+		// the recurrence of todos without start is anchored to their due
+		anchor := t.DTStart
+		if anchor.IsZero() {
+			anchor = t.DTDue
+		}
+
+		if !anchor.floating() {
+			continue
+		}
+
+		if !t.RecurrenceID.IsZero() {
+			t.RecurrenceID = inLocation(t.RecurrenceID, loc)
+		}
+
+		for j := range t.RDates {
+			t.RDates[j] = inLocation(t.RDates[j], loc)
+		}
+
+		for j := range t.ExDates {
+			t.ExDates[j] = inLocation(t.ExDates[j], loc)
+		}
+	}
+
+	for i := range c.Journals {
+		j := &c.Journals[i]
+		if !j.DTStart.floating() {
+			continue
+		}
+
+		j.Start = inLocation(j.Start, loc)
+		if !j.RecurrenceID.IsZero() {
+			j.RecurrenceID = inLocation(j.RecurrenceID, loc)
+		}
+
+		for k := range j.RDates {
+			j.RDates[k] = inLocation(j.RDates[k], loc)
+		}
+
+		for k := range j.ExDates {
+			j.ExDates[k] = inLocation(j.ExDates[k], loc)
+		}
+	}
+}
+
+// parseDuration parses a DURATION value, such as -PT15M or P1DT12H, as
+// described in RFC 5545 section 3.3.6.
+func parseDuration(value string) (time.Duration, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	var (
+		result time.Duration
+		n      int64
+		digits bool
+		inTime bool
+	)
+
+	for _, r := range s[1:] {
+		if r >= '0' && r <= '9' {
+			n = n*10 + int64(r-'0')
+			digits = true
+			continue
+		}
+
+		if r == 'T' && !inTime && !digits {
+			inTime = true
+			continue
+		}
+
+		var unit time.Duration
+		switch {
+		case r == 'W' && !inTime:
+			unit = 7 * 24 * time.Hour
+		case r == 'D' && !inTime:
+			unit = 24 * time.Hour
+		case r == 'H' && inTime:
+			unit = time.Hour
+		case r == 'M' && inTime:
+			unit = time.Minute
+		case r == 'S' && inTime:
+			unit = time.Second
+		}
+
+		if unit == 0 || !digits {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+
+		result += time.Duration(n) * unit
+		n, digits = 0, false
+	}
+
+	if digits {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	return sign * result, nil
+}
+
+// formatDuration formats a duration as a DURATION value. Fractions of a
+// second are ignored.
+func formatDuration(d time.Duration) string {
+	var buf strings.Builder
+	if d < 0 {
+		buf.WriteByte('-')
+		d = -d
+	}
+	buf.WriteByte('P')
+
+	day := 24 * time.Hour
+	if d >= 7*day && d%(7*day) == 0 {
+		fmt.Fprintf(&buf, "%dW", d/(7*day))
+		return buf.String()
+	}
+
+	if days := d / day; days > 0 {
+		fmt.Fprintf(&buf, "%dD", days)
+	}
+
+	h, m, s := int64(d%day/time.Hour), int64(d%time.Hour/time.Minute), int64(d%time.Minute/time.Second)
+	if h == 0 && m == 0 && s == 0 {
+		if d < day {
+			buf.WriteString("T0S")
+		}
+		return buf.String()
+	}
+
+	// every unit is written from the first one that is not zero until the
+	// last one that is not zero
+	buf.WriteByte('T')
+	if h > 0 {
+		fmt.Fprintf(&buf, "%dH", h)
+	}
+
+	if m > 0 || (h > 0 && s > 0) {
+		fmt.Fprintf(&buf, "%dM", m)
+	}
+
+	if s > 0 {
+		fmt.Fprintf(&buf, "%dS", s)
+	}
+
+	return buf.String()
+}
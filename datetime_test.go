@@ -0,0 +1,155 @@
+package ics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testDateKinds = strings.Join([]string{
+	"BEGIN:VCALENDAR",
+	"X-WR-TIMEZONE:America/New_York",
+	"BEGIN:VEVENT",
+	"UID:floating",
+	"DTSTART:20160704T100000",
+	"DTEND:20160704T110000",
+	"EXDATE:20160711T100000",
+	"RRULE:FREQ=WEEKLY;COUNT=3",
+	"END:VEVENT",
+	"BEGIN:VEVENT",
+	"UID:utc",
+	"DTSTART:20160704T100000Z",
+	"DTEND:20160704T110000Z",
+	"END:VEVENT",
+	"BEGIN:VEVENT",
+	"UID:zoned",
+	"DTSTART;TZID=Europe/Madrid:20160704T000000",
+	"DTEND;TZID=Europe/Madrid:20160705T000000",
+	"END:VEVENT",
+	"BEGIN:VEVENT",
+	"UID:date",
+	"DTSTART;VALUE=DATE:20160704",
+	"DTEND;VALUE=DATE:20160705",
+	"END:VEVENT",
+	"END:VCALENDAR",
+}, "\r\n")
+
+func TestParseDateKinds(t *testing.T) {
+	cal, err := ParseICalContent(testDateKinds, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.FailNow()
+	}
+
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.FailNow()
+	}
+
+	expected := map[string]struct {
+		kind     DateKind
+		start    time.Time
+		wholeDay bool
+	}{
+		"floating": {Floating, time.Date(2016, time.July, 4, 10, 0, 0, 0, newYork), false},
+		"utc":      {UTC, time.Date(2016, time.July, 4, 10, 0, 0, 0, time.UTC), false},
+		"zoned":    {Zoned, time.Date(2016, time.July, 4, 0, 0, 0, 0, madrid), false},
+		"date":     {Date, time.Date(2016, time.July, 4, 0, 0, 0, 0, newYork), true},
+	}
+
+	for _, e := range cal.Events {
+		ex := expected[e.ID]
+		if e.DTStart.Kind != ex.kind || e.DTEnd.Kind != ex.kind {
+			t.Errorf("%s: expected values of kind %s, got %s and %s", e.ID, ex.kind, e.DTStart.Kind, e.DTEnd.Kind)
+		}
+
+		if !e.Start.Equal(ex.start) {
+			t.Errorf("%s: expected start %s, got %s", e.ID, ex.start, e.Start)
+		}
+
+		if e.WholeDayEvent != ex.wholeDay {
+			t.Errorf("%s: expected whole day to be %v", e.ID, ex.wholeDay)
+		}
+
+		if e.ID == "zoned" && e.DTStart.TZID != "Europe/Madrid" {
+			t.Errorf("expected TZID Europe/Madrid, got %q", e.DTStart.TZID)
+		}
+	}
+}
+
+func TestCalendarResolveFloating(t *testing.T) {
+	cal, err := ParseICalContent(testDateKinds, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.FailNow()
+	}
+
+	cal.ResolveFloating(tokyo)
+	if cal.Timezone != tokyo {
+		t.Errorf("expected calendar timezone to be %s, got %s", tokyo, cal.Timezone)
+	}
+
+	expected := map[string]time.Time{
+		"floating": time.Date(2016, time.July, 4, 10, 0, 0, 0, tokyo),
+		"utc":      time.Date(2016, time.July, 4, 10, 0, 0, 0, time.UTC),
+		"date":     time.Date(2016, time.July, 4, 0, 0, 0, 0, tokyo),
+	}
+
+	for _, e := range cal.Events {
+		if ex, ok := expected[e.ID]; ok && !e.Start.Equal(ex) {
+			t.Errorf("%s: expected start %s, got %s", e.ID, ex, e.Start)
+		}
+
+		if e.ID == "floating" && !e.ExDates[0].Equal(time.Date(2016, time.July, 11, 10, 0, 0, 0, tokyo)) {
+			t.Errorf("expected excluded date to be resolved again, got %s", e.ExDates[0])
+		}
+	}
+
+	var starts []time.Time
+	for o := range cal.Between(time.Time{}, time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		if o.Event.ID == "floating" {
+			starts = append(starts, o.Start)
+		}
+	}
+
+	if len(starts) != 2 || !starts[1].Equal(time.Date(2016, time.July, 18, 10, 0, 0, 0, tokyo)) {
+		t.Errorf("expected floating occurrences in the new location, got %v", starts)
+	}
+}
+
+func TestEncodeDateKinds(t *testing.T) {
+	cal, err := ParseICalContent(testDateKinds, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := cal.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	expected := []string{
+		"DTSTART:20160704T100000\r\n",
+		"EXDATE:20160711T100000\r\n",
+		"DTSTART:20160704T100000Z\r\n",
+		"DTSTART;TZID=Europe/Madrid:20160704T000000\r\n",
+		"DTSTART;VALUE=DATE:20160704\r\n",
+		"DTEND;VALUE=DATE:20160705\r\n",
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("expected output to contain %q:\n%s", e, out)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package ics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// SyntaxError is returned by the Decoder when a content line can not be
+// split into name, parameters and value.
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Property is a single unfolded content line of an iCalendar stream, as
+// defined in RFC 5545 section 3.1.
+type Property struct {
+	Name   string
+	Params Params
+	Value  string
+
+	// raw is the exact text the property was decoded from, including
+	// folding and line breaks, and formatted is the property as it would
+	// have been encoded right after decoding it. Both are used to write
+	// back unchanged properties as they were read.
+	raw       string
+	formatted string
+
+	// zoned is the time of a date-time property that was generated with a
+	// TZID, whose location is the one the TZID refers to.
+	zoned time.Time
+}
+
+// unchanged reports whether the property was decoded and has not been
+// modified since.
+func (p *Property) unchanged() bool {
+	return p.raw != "" && formatProperty(p) == p.formatted
+}
+
+// Param is a property parameter with all of its values.
+type Param struct {
+	Name   string
+	Values []string
+}
+
+// Params is the list of parameters of a property, in the order they appeared.
+type Params []Param
+
+// Get returns the first value of the parameter with the given name or an
+// empty string if there is no such parameter. Names are case insensitive.
+func (p Params) Get(name string) string {
+	if values := p.Values(name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Values returns all the values of the parameter with the given name.
+func (p Params) Values(name string) []string {
+	for _, param := range p {
+		if strings.EqualFold(param.Name, name) {
+			return param.Values
+		}
+	}
+	return nil
+}
+
+// Set replaces the values of the parameter with the given name, adding it
+// if it did not exist.
+func (p *Params) Set(name string, values ...string) {
+	for i, param := range *p {
+		if strings.EqualFold(param.Name, name) {
+			(*p)[i].Values = values
+			return
+		}
+	}
+	*p = append(*p, Param{Name: strings.ToUpper(name), Values: values})
+}
+
+// Del removes the parameter with the given name.
+func (p *Params) Del(name string) {
+	for i, param := range *p {
+		if strings.EqualFold(param.Name, name) {
+			*p = append((*p)[:i], (*p)[i+1:]...)
+			return
+		}
+	}
+}
+
+// Decoder reads the content lines of an iCalendar stream, unfolding them
+// as described in RFC 5545 section 3.1.
+type Decoder struct {
+	r    *bufio.Reader
+	line int
+
+	// next is the physical line that was read ahead while looking for
+	// folded continuations of the previous one.
+	next    physicalLine
+	hasNext bool
+	err     error
+
+	// blank holds the empty lines read before the next content line, so
+	// they can be kept in its raw text.
+	blank string
+}
+
+type physicalLine struct {
+	text string
+	raw  string
+	num  int
+}
+
+// NewDecoder returns a new Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// ReadProperty returns the next content line of the stream. It returns
+// io.EOF when there are no more content lines to read.
+func (d *Decoder) ReadProperty() (*Property, error) {
+	for {
+		first, err := d.readPhysicalLine()
+		if err != nil {
+			return nil, err
+		}
+
+		line, raw := first.text, first.raw
+		for {
+			next, err := d.readPhysicalLine()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+
+			if next.text == "" || (next.text[0] != ' ' && next.text[0] != '\t') {
+				d.unread(next)
+				break
+			}
+			line += next.text[1:]
+			raw += next.raw
+		}
+
+		if strings.TrimSpace(line) == "" {
+			d.blank += raw
+			continue
+		}
+
+		prop, err := parseContentLine(line)
+		if err != nil {
+			return nil, &SyntaxError{Line: first.num, Msg: err.Error()}
+		}
+
+		prop.raw = d.blank + raw
+		prop.formatted = formatProperty(prop)
+		d.blank = ""
+		return prop, nil
+	}
+}
+
+func (d *Decoder) readPhysicalLine() (physicalLine, error) {
+	if d.hasNext {
+		d.hasNext = false
+		return d.next, nil
+	}
+
+	if d.err != nil {
+		return physicalLine{}, d.err
+	}
+
+	line, err := d.r.ReadString('\n')
+	if err != nil {
+		if err != io.EOF || line == "" {
+			d.err = err
+			return physicalLine{}, err
+		}
+		d.err = io.EOF
+	}
+
+	d.line++
+	return physicalLine{
+		text: strings.TrimRight(line, "\r\n"),
+		raw:  line,
+		num:  d.line,
+	}, nil
+}
+
+func (d *Decoder) unread(line physicalLine) {
+	d.next = line
+	d.hasNext = true
+}
+
+func parseContentLine(line string) (*Property, error) {
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return nil, fmt.Errorf("missing property name or value in %q", line)
+	}
+
+	prop := &Property{Name: strings.ToUpper(line[:i])}
+	if !isValidName(prop.Name) {
+		return nil, fmt.Errorf("invalid property name %q", prop.Name)
+	}
+
+	for line[i] == ';' {
+		name, values, n, err := parseParam(line[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		prop.Params = append(prop.Params, Param{Name: name, Values: values})
+
+		i += n + 1
+		if i >= len(line) {
+			return nil, fmt.Errorf("missing value for property %s", prop.Name)
+		}
+	}
+
+	prop.Value = line[i+1:]
+	return prop, nil
+}
+
+// parseParam parses a single parameter at the start of s and returns its
+// name, values and the number of bytes consumed, up to but not including
+// the ';' or ':' that follows it.
+func parseParam(s string) (string, []string, int, error) {
+	eq := strings.IndexByte(s, '=')
+	if eq <= 0 {
+		return "", nil, 0, fmt.Errorf("invalid parameter in %q", s)
+	}
+
+	name := strings.ToUpper(s[:eq])
+	if !isValidName(name) {
+		return "", nil, 0, fmt.Errorf("invalid parameter name %q", name)
+	}
+
+	var values []string
+	i := eq + 1
+	for {
+		var value string
+		if i < len(s) && s[i] == '"' {
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return "", nil, 0, fmt.Errorf("unterminated quoted value for parameter %s", name)
+			}
+			value = s[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			end := strings.IndexAny(s[i:], ",;:")
+			if end < 0 {
+				return "", nil, 0, fmt.Errorf("missing value after parameter %s", name)
+			}
+			value = s[i : i+end]
+			i += end
+		}
+
+		values = append(values, unescapeParamValue(value))
+		if i >= len(s) {
+			return "", nil, 0, fmt.Errorf("missing value after parameter %s", name)
+		}
+
+		if s[i] != ',' {
+			break
+		}
+		i++
+	}
+
+	if s[i] != ';' && s[i] != ':' {
+		return "", nil, 0, fmt.Errorf("unexpected character %q after parameter %s", s[i], name)
+	}
+
+	return name, values, i, nil
+}
+
+// unescapeParamValue decodes the caret escapes defined in RFC 6868.
+func unescapeParamValue(v string) string {
+	if !strings.Contains(v, "^") {
+		return v
+	}
+
+	var buf strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] == '^' && i+1 < len(v) {
+			switch v[i+1] {
+			case 'n':
+				buf.WriteByte('\n')
+				i++
+				continue
+			case '\'':
+				buf.WriteByte('"')
+				i++
+				continue
+			case '^':
+				buf.WriteByte('^')
+				i++
+				continue
+			}
+		}
+		buf.WriteByte(v[i])
+	}
+	return buf.String()
+}
+
+func isValidName(name string) bool {
+	for _, r := range name {
+		if !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '-' {
+			return false
+		}
+	}
+	return name != ""
+}
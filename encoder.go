@@ -0,0 +1,829 @@
+package ics
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultProdID = "-//erizocosmico//go-ics//EN"
+
+	// maxLineLength is the maximum length in octets of a content line, not
+	// including the line break.
+	maxLineLength = 75
+)
+
+// Encoder writes iCalendar streams. Lines are folded at 75 octets and end
+// with CRLF as required by RFC 5545.
+type Encoder struct {
+	w         *bufio.Writer
+	n         int64
+	roundTrip bool
+	now       func() time.Time
+}
+
+// NewEncoder returns a new Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w), now: time.Now}
+}
+
+// SetClock sets the function the encoder uses to tell the current time,
+// which is the DTSTAMP written for the entities that were not parsed and
+// have no DTSTAMP yet. By default it is time.Now.
+func (e *Encoder) SetClock(now func() time.Time) {
+	e.now = now
+}
+
+// SetRoundTrip enables or disables the round-trip mode of the encoder. In
+// round-trip mode every component and property that was decoded and has
+// not been modified since is written exactly as it was read, keeping its
+// folding, line breaks and parameters. For parsed calendars this includes
+// the properties and components that are not mapped to any field, and
+// only the properties of the events that were actually changed are
+// written again.
+func (e *Encoder) SetRoundTrip(enabled bool) {
+	e.roundTrip = enabled
+}
+
+// Encode writes the given calendar with all its events as a VCALENDAR
+// component. Calendars with events expanded from repetition rules should
+// be parsed with maxRepeats set to 0 before being written back, as every
+// generated repetition would be written as an event otherwise.
+func (e *Encoder) Encode(cal *Calendar) error {
+	if e.roundTrip && cal.Component != nil {
+		return e.EncodeComponent(roundTripCalendarComponent(cal))
+	}
+	return e.EncodeComponent(calendarComponent(cal))
+}
+
+// EncodeComponent writes the given component and all of its nested
+// components.
+func (e *Encoder) EncodeComponent(c *Component) error {
+	if err := e.encodeComponent(c); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+func (e *Encoder) encodeComponent(c *Component) error {
+	if e.roundTrip && c.unchanged() {
+		return e.writeString(c.raw)
+	}
+
+	if err := e.writeProperty(c.delimiter(c.begin, "BEGIN")); err != nil {
+		return err
+	}
+
+	stamp := e.newStamp(c)
+	if stamp != nil && c.Property("UID") == nil {
+		if err := e.writeProperty(stamp); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range c.Properties {
+		if err := e.writeProperty(p); err != nil {
+			return err
+		}
+
+		// the DTSTAMP goes right after the UID, as in parsed components
+		if stamp != nil && strings.EqualFold(p.Name, "UID") {
+			if err := e.writeProperty(stamp); err != nil {
+				return err
+			}
+			stamp = nil
+		}
+	}
+
+	for _, child := range c.Children {
+		if err := e.encodeComponent(child); err != nil {
+			return err
+		}
+	}
+
+	return e.writeProperty(c.delimiter(c.end, "END"))
+}
+
+// stampedComponents are the names of the components that must have a
+// DTSTAMP property.
+var stampedComponents = map[string]bool{
+	"VEVENT":        true,
+	"VTODO":         true,
+	"VJOURNAL":      true,
+	"VFREEBUSY":     true,
+	"VAVAILABILITY": true,
+	"AVAILABLE":     true,
+}
+
+// newStamp returns the DTSTAMP property to write for a component that needs
+// one and has none because it was neither decoded nor generated from a
+// parsed entity, or nil if it does not need one.
+func (e *Encoder) newStamp(c *Component) *Property {
+	if !stampedComponents[c.Name] || c.begin != nil || c.origin != nil || c.Property("DTSTAMP") != nil {
+		return nil
+	}
+	return &Property{Name: "DTSTAMP", Value: e.now().UTC().Format(icsFormat)}
+}
+
+func (e *Encoder) writeProperty(p *Property) error {
+	if e.roundTrip && p.unchanged() {
+		return e.writeString(p.raw)
+	}
+	return e.writeLine(formatProperty(p))
+}
+
+// writeLine writes a content line, folding it so that no line is longer
+// than maxLineLength octets. Multi-octet characters are never split.
+func (e *Encoder) writeLine(line string) error {
+	limit := maxLineLength
+	for len(line) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(line[i]) {
+			i--
+		}
+
+		if err := e.writeString(line[:i] + "\r\n "); err != nil {
+			return err
+		}
+		line = line[i:]
+		// continuation lines start with a space, which counts towards
+		// the limit
+		limit = maxLineLength - 1
+	}
+
+	return e.writeString(line + "\r\n")
+}
+
+func (e *Encoder) writeString(s string) error {
+	n, err := e.w.WriteString(s)
+	e.n += int64(n)
+	return err
+}
+
+// WriteTo writes the calendar in iCalendar format to w. See Encoder.Encode
+// for more details.
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	enc := NewEncoder(w)
+	err := enc.Encode(c)
+	return enc.n, err
+}
+
+func formatProperty(p *Property) string {
+	var buf strings.Builder
+	buf.WriteString(p.Name)
+	for _, param := range p.Params {
+		buf.WriteByte(';')
+		buf.WriteString(param.Name)
+		buf.WriteByte('=')
+		for i, v := range param.Values {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(formatParamValue(v))
+		}
+	}
+	buf.WriteByte(':')
+	buf.WriteString(p.Value)
+	return buf.String()
+}
+
+// formatParamValue escapes the parameter value as described in RFC 6868
+// and quotes it if needed.
+func formatParamValue(v string) string {
+	if strings.ContainsAny(v, "^\n\"") {
+		v = strings.NewReplacer("^", "^^", "\n", "^n", "\"", "^'").Replace(v)
+	}
+
+	if strings.ContainsAny(v, ";:,") {
+		return `"` + v + `"`
+	}
+	return v
+}
+
+var (
+	textEscaper   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+// escapeText escapes a TEXT value as described in RFC 5545 section 3.3.11.
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// unescapeText reverts the escaping of a TEXT value.
+func unescapeText(s string) string {
+	return textUnescaper.Replace(s)
+}
+
+func textProperty(name, value string) *Property {
+	return &Property{Name: name, Value: escapeText(value)}
+}
+
+// timeProperty returns a date or date-time property for the given value.
+// UTC values are written in UTC form, Zoned values with their TZID and
+// Floating values without any time zone.
+func timeProperty(name string, v DateTime) *Property {
+	prop := &Property{Name: name}
+	switch v.Kind {
+	case Date:
+		prop.Params.Set("VALUE", "DATE")
+		prop.Value = v.Time.Format(icsFormatWholeDay)
+	case Floating:
+		prop.Value = v.Time.Format("20060102T150405")
+	case Zoned:
+		prop.Params.Set("TZID", v.TZID)
+		prop.Value = v.Time.Format("20060102T150405")
+		prop.zoned = v.Time
+	default:
+		prop.Value = v.Time.UTC().Format(icsFormat)
+	}
+	return prop
+}
+
+// dateTimeValue returns the value to write for a time of an event, which
+// keeps the kind of v, the value the time had in the calendar, if it can.
+// Otherwise times in UTC and in the local location are written in UTC
+// form and times in any other named location with a TZID parameter. If
+// date is true the value is a date.
+func dateTimeValue(t time.Time, v DateTime, date bool) DateTime {
+	switch {
+	case date && (v.Kind == Date || timezoneID(t) == ""):
+		return DateTime{Time: t, Kind: Date}
+	case !date && v.Kind == Floating:
+		return DateTime{Time: t, Kind: Floating}
+	case v.Kind == Zoned && t.Location().String() == v.Time.Location().String():
+		return DateTime{Time: t, Kind: Zoned, TZID: v.TZID}
+	case timezoneID(t) != "":
+		// whole day events in a named location that were not parsed from
+		// DATE values are kept as date-times so they keep their location
+		return DateTime{Time: t, Kind: Zoned, TZID: timezoneID(t)}
+	default:
+		return DateTime{Time: t, Kind: UTC}
+	}
+}
+
+func timezoneID(t time.Time) string {
+	loc := t.Location()
+	if loc == time.UTC || loc == time.Local || loc.String() == "UTC" || loc.String() == "" {
+		return ""
+	}
+	return loc.String()
+}
+
+func mailto(email string) string {
+	return "mailto:" + email
+}
+
+func calendarComponent(cal *Calendar) *Component {
+	c := calendarHeader(cal)
+	if cal.Component != nil {
+		// the times of the events may refer to the timezones the calendar
+		// defined
+		c.Children = append(c.Children, cal.Component.ChildrenNamed("VTIMEZONE")...)
+	}
+
+	for _, entity := range cal.typedEntities() {
+		c.Children = append(c.Children, entity.generate())
+	}
+
+	addTimezones(c)
+	return withoutReplyStamps(c, cal.Method)
+}
+
+// withoutReplyStamps returns the calendar component without the
+// ReplyStampParam of its attendees if it is a message with the given
+// method, which are not sent to others. Components and properties are
+// copied before being changed, as they may be the parsed ones.
+func withoutReplyStamps(c *Component, method string) *Component {
+	if method = strings.ToUpper(method); method != "REQUEST" && method != "REPLY" {
+		return c
+	}
+
+	var strip func(*Component) *Component
+	strip = func(comp *Component) *Component {
+		var copied *Component
+		for i, p := range comp.Properties {
+			if p.Name != "ATTENDEE" || p.Params.Get(ReplyStampParam) == "" {
+				continue
+			}
+
+			if copied == nil {
+				clone := *comp
+				clone.Properties = append([]*Property(nil), comp.Properties...)
+				copied = &clone
+			}
+
+			prop := *p
+			prop.Params = append(Params(nil), p.Params...)
+			prop.Params.Del(ReplyStampParam)
+			copied.Properties[i] = &prop
+		}
+
+		var children []*Component
+		for i, child := range comp.Children {
+			stripped := strip(child)
+			if stripped != child && children == nil {
+				children = append([]*Component(nil), comp.Children...)
+			}
+			if children != nil {
+				children[i] = stripped
+			}
+		}
+
+		if children != nil {
+			if copied == nil {
+				clone := *comp
+				copied = &clone
+			}
+			copied.Children = children
+		}
+
+		if copied == nil {
+			return comp
+		}
+		return copied
+	}
+	return strip(c)
+}
+
+// addTimezones adds to the calendar component a VTIMEZONE for every TZID of
+// the properties generated for its components that it does not define, as
+// every TZID must be defined in the calendar.
+func addTimezones(c *Component) {
+	defined := make(map[string]bool)
+	for _, tz := range c.ChildrenNamed("VTIMEZONE") {
+		defined[tz.Value("TZID")] = true
+	}
+
+	// the definitions start at the first time they are used for
+	first := make(map[string]time.Time)
+	var tzids []string
+	var walk func(*Component)
+	walk = func(comp *Component) {
+		for _, p := range comp.Properties {
+			tzid := p.Params.Get("TZID")
+			if tzid == "" || p.zoned.IsZero() || defined[tzid] {
+				continue
+			}
+
+			if t, ok := first[tzid]; !ok {
+				tzids = append(tzids, tzid)
+				first[tzid] = p.zoned
+			} else if p.zoned.Before(t) {
+				first[tzid] = p.zoned
+			}
+		}
+
+		for _, child := range comp.Children {
+			walk(child)
+		}
+	}
+
+	for _, child := range c.Children {
+		if child.Name != "VTIMEZONE" {
+			walk(child)
+		}
+	}
+
+	var timezones []*Component
+	for _, tzid := range tzids {
+		timezones = append(timezones, TimezoneComponent(tzid, first[tzid].Location(), first[tzid]))
+	}
+	c.Children = append(timezones, c.Children...)
+}
+
+// ToComponent returns the VCALENDAR component of the calendar, with the
+// components of all of its entities and a VTIMEZONE for every TZID they
+// refer to, as WriteTo would write it. The only difference is that the
+// components of new entities have no DTSTAMP, which the encoder adds when
+// they are written.
+func (c *Calendar) ToComponent() *Component {
+	return calendarComponent(c)
+}
+
+// typedEntity is an entity of a calendar, such as an Event or a Todo, with
+// the component it was parsed from, if any, and a function to generate the
+// component of its current state. Repetitions generated from a repeating
+// entity share its component, but are never the source of it.
+type typedEntity struct {
+	component  *Component
+	generate   func() *Component
+	repetition bool
+}
+
+// typedComponents are the names of the components that are parsed into
+// typed entities.
+var typedComponents = map[string]bool{
+	"VEVENT":        true,
+	"VTODO":         true,
+	"VJOURNAL":      true,
+	"VFREEBUSY":     true,
+	"VAVAILABILITY": true,
+}
+
+// typedEntities returns all the typed entities of the calendar.
+func (c *Calendar) typedEntities() []typedEntity {
+	var result []typedEntity
+	for i := range c.Events {
+		e := &c.Events[i]
+		result = append(result, typedEntity{e.Component, func() *Component { return eventComponent(e) }, e.Repetition > 0})
+	}
+
+	for i := range c.Todos {
+		t := &c.Todos[i]
+		result = append(result, typedEntity{t.Component, func() *Component { return todoComponent(t) }, false})
+	}
+
+	for i := range c.Journals {
+		j := &c.Journals[i]
+		result = append(result, typedEntity{j.Component, func() *Component { return journalComponent(j) }, false})
+	}
+
+	for i := range c.FreeBusies {
+		fb := &c.FreeBusies[i]
+		result = append(result, typedEntity{fb.Component, func() *Component { return freeBusyComponent(fb) }, false})
+	}
+
+	for i := range c.Availabilities {
+		a := &c.Availabilities[i]
+		result = append(result, typedEntity{a.Component, func() *Component { return availabilityComponent(a) }, false})
+	}
+
+	return result
+}
+
+// calendarHeader returns the VCALENDAR component for the calendar without
+// any nested component.
+func calendarHeader(cal *Calendar) *Component {
+	c := NewComponent("VCALENDAR")
+
+	prodID := defaultProdID
+	if cal.Component != nil && cal.Component.Value("PRODID") != "" {
+		prodID = cal.Component.Value("PRODID")
+	}
+	c.Add(&Property{Name: "PRODID", Value: prodID})
+
+	version := "2.0"
+	if cal.Version != 0 {
+		version = strconv.FormatFloat(cal.Version, 'f', 1, 64)
+	}
+	c.Add(&Property{Name: "VERSION", Value: version})
+
+	if cal.Method != "" {
+		c.Add(&Property{Name: "METHOD", Value: cal.Method})
+	}
+
+	if cal.Name != "" {
+		c.Add(textProperty("X-WR-CALNAME", cal.Name))
+	}
+
+	if cal.Description != "" {
+		c.Add(textProperty("X-WR-CALDESC", cal.Description))
+	}
+
+	if cal.Timezone != nil && cal.Timezone != time.Local && cal.Timezone.String() != "UTC" {
+		c.Add(&Property{Name: "X-WR-TIMEZONE", Value: cal.Timezone.String()})
+	}
+
+	return c
+}
+
+func eventComponent(e *Event) *Component {
+	c := NewComponent("VEVENT")
+	c.origin = e.Component
+	c.Add(&Property{Name: "UID", Value: e.ID})
+	addStamp(c, e.Component)
+
+	c.Add(timeProperty("DTSTART", dateTimeValue(e.Start, e.DTStart, e.WholeDayEvent)))
+	switch {
+	case e.End.IsZero():
+	case e.Duration != 0 && e.DTEnd.IsZero():
+		c.Add(&Property{Name: "DURATION", Value: formatDuration(e.End.Sub(e.Start))})
+	case e.DTEnd.IsZero() && !e.DTStart.IsZero() && e.End.Equal(defaultEnd(e.Start)):
+		// the event was parsed without DTEND nor DURATION, and the end it
+		// was given is the default one
+	default:
+		end := e.DTEnd
+		if end.IsZero() {
+			end = e.DTStart
+		}
+
+		value := dateTimeValue(e.End, end, e.WholeDayEvent)
+		if value.Kind == Date && !dayAfter(e.End, e.Start) {
+			// the end of all-day events is the day after their last day
+			value.Time = e.Start.AddDate(0, 0, 1)
+		}
+		c.Add(timeProperty("DTEND", value))
+	}
+
+	if !e.RecurrenceID.IsZero() {
+		prop := timeProperty("RECURRENCE-ID", dateTimeValue(e.RecurrenceID, e.DTStart, e.WholeDayEvent))
+		if e.ThisAndFuture {
+			prop.Params.Set("RANGE", "THISANDFUTURE")
+		}
+		c.Add(prop)
+	}
+
+	if e.RRule != "" {
+		c.Add(&Property{Name: "RRULE", Value: e.RRule})
+	}
+
+	for _, t := range e.RDates {
+		c.Add(timeProperty("RDATE", dateTimeValue(t, e.DTStart, e.WholeDayEvent)))
+	}
+
+	for _, t := range e.ExDates {
+		c.Add(timeProperty("EXDATE", dateTimeValue(t, e.DTStart, e.WholeDayEvent)))
+	}
+
+	if !e.Created.IsZero() {
+		c.Add(&Property{Name: "CREATED", Value: e.Created.UTC().Format(icsFormat)})
+	}
+
+	if !e.Modified.IsZero() {
+		c.Add(&Property{Name: "LAST-MODIFIED", Value: e.Modified.UTC().Format(icsFormat)})
+	}
+
+	if e.Sequence != 0 {
+		c.Add(&Property{Name: "SEQUENCE", Value: strconv.Itoa(e.Sequence)})
+	}
+
+	if e.Status != "" {
+		c.Add(&Property{Name: "STATUS", Value: e.Status})
+	}
+
+	if e.Class != "" {
+		c.Add(&Property{Name: "CLASS", Value: e.Class})
+	}
+
+	if e.Transparent {
+		c.Add(&Property{Name: "TRANSP", Value: "TRANSPARENT"})
+	}
+
+	if e.Summary != "" {
+		c.Add(textProperty("SUMMARY", e.Summary))
+	}
+
+	if e.Description != "" {
+		c.Add(textProperty("DESCRIPTION", e.Description))
+	}
+
+	if e.Location != "" {
+		c.Add(textProperty("LOCATION", e.Location))
+	}
+
+	if e.Organizer.Email != "" || e.Organizer.Name != "" {
+		c.Add(attendeeProperty("ORGANIZER", e.Organizer))
+	}
+
+	for _, a := range e.Attendees {
+		c.Add(attendeeProperty("ATTENDEE", a))
+	}
+
+	for i := range e.Alarms {
+		c.Children = append(c.Children, alarmComponent(&e.Alarms[i]))
+	}
+
+	return c
+}
+
+// todoComponent returns the VTODO component for the todo.
+// dayAfter reports whether the date of t is after the date of start.
+func dayAfter(t, start time.Time) bool {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, start.Location()).After(start)
+}
+
+func todoComponent(t *Todo) *Component {
+	c := NewComponent("VTODO")
+	c.origin = t.Component
+	c.Add(&Property{Name: "UID", Value: t.ID})
+	addStamp(c, t.Component)
+
+	date := t.DTStart.Kind == Date || (t.DTStart.IsZero() && t.DTDue.Kind == Date)
+	if !t.Start.IsZero() {
+		c.Add(timeProperty("DTSTART", dateTimeValue(t.Start, t.DTStart, date)))
+	}
+
+	if !t.Due.IsZero() {
+		due := t.DTDue
+		if due.IsZero() {
+			due = t.DTStart
+		}
+		c.Add(timeProperty("DUE", dateTimeValue(t.Due, due, date)))
+	}
+
+	if !t.RecurrenceID.IsZero() {
+		c.Add(timeProperty("RECURRENCE-ID", dateTimeValue(t.RecurrenceID, t.DTStart, date)))
+	}
+
+	if t.RRule != "" {
+		c.Add(&Property{Name: "RRULE", Value: t.RRule})
+	}
+
+	for _, rdate := range t.RDates {
+		c.Add(timeProperty("RDATE", dateTimeValue(rdate, t.DTStart, date)))
+	}
+
+	for _, exdate := range t.ExDates {
+		c.Add(timeProperty("EXDATE", dateTimeValue(exdate, t.DTStart, date)))
+	}
+
+	if !t.Completed.IsZero() {
+		c.Add(&Property{Name: "COMPLETED", Value: t.Completed.UTC().Format(icsFormat)})
+	}
+
+	if t.PercentComplete != 0 {
+		c.Add(&Property{Name: "PERCENT-COMPLETE", Value: strconv.Itoa(t.PercentComplete)})
+	}
+
+	if t.Priority != 0 {
+		c.Add(&Property{Name: "PRIORITY", Value: strconv.Itoa(t.Priority)})
+	}
+
+	if !t.Created.IsZero() {
+		c.Add(&Property{Name: "CREATED", Value: t.Created.UTC().Format(icsFormat)})
+	}
+
+	if !t.Modified.IsZero() {
+		c.Add(&Property{Name: "LAST-MODIFIED", Value: t.Modified.UTC().Format(icsFormat)})
+	}
+
+	if t.Sequence != 0 {
+		c.Add(&Property{Name: "SEQUENCE", Value: strconv.Itoa(t.Sequence)})
+	}
+
+	if t.Status != "" {
+		c.Add(&Property{Name: "STATUS", Value: t.Status})
+	}
+
+	if t.Class != "" {
+		c.Add(&Property{Name: "CLASS", Value: t.Class})
+	}
+
+	if t.Summary != "" {
+		c.Add(textProperty("SUMMARY", t.Summary))
+	}
+
+	if t.Description != "" {
+		c.Add(textProperty("DESCRIPTION", t.Description))
+	}
+
+	if t.Location != "" {
+		c.Add(textProperty("LOCATION", t.Location))
+	}
+
+	if t.Organizer.Email != "" || t.Organizer.Name != "" {
+		c.Add(attendeeProperty("ORGANIZER", t.Organizer))
+	}
+
+	for _, a := range t.Attendees {
+		c.Add(attendeeProperty("ATTENDEE", a))
+	}
+
+	for i := range t.Alarms {
+		c.Children = append(c.Children, alarmComponent(&t.Alarms[i]))
+	}
+
+	return c
+}
+
+// journalComponent returns the VJOURNAL component for the journal.
+func journalComponent(j *Journal) *Component {
+	c := NewComponent("VJOURNAL")
+	c.origin = j.Component
+	c.Add(&Property{Name: "UID", Value: j.ID})
+	addStamp(c, j.Component)
+
+	date := j.DTStart.Kind == Date
+	if !j.Start.IsZero() {
+		c.Add(timeProperty("DTSTART", dateTimeValue(j.Start, j.DTStart, date)))
+	}
+
+	if !j.RecurrenceID.IsZero() {
+		c.Add(timeProperty("RECURRENCE-ID", dateTimeValue(j.RecurrenceID, j.DTStart, date)))
+	}
+
+	if j.RRule != "" {
+		c.Add(&Property{Name: "RRULE", Value: j.RRule})
+	}
+
+	for _, rdate := range j.RDates {
+		c.Add(timeProperty("RDATE", dateTimeValue(rdate, j.DTStart, date)))
+	}
+
+	for _, exdate := range j.ExDates {
+		c.Add(timeProperty("EXDATE", dateTimeValue(exdate, j.DTStart, date)))
+	}
+
+	if !j.Created.IsZero() {
+		c.Add(&Property{Name: "CREATED", Value: j.Created.UTC().Format(icsFormat)})
+	}
+
+	if !j.Modified.IsZero() {
+		c.Add(&Property{Name: "LAST-MODIFIED", Value: j.Modified.UTC().Format(icsFormat)})
+	}
+
+	if j.Sequence != 0 {
+		c.Add(&Property{Name: "SEQUENCE", Value: strconv.Itoa(j.Sequence)})
+	}
+
+	if j.Status != "" {
+		c.Add(&Property{Name: "STATUS", Value: j.Status})
+	}
+
+	if j.Class != "" {
+		c.Add(&Property{Name: "CLASS", Value: j.Class})
+	}
+
+	if j.Summary != "" {
+		c.Add(textProperty("SUMMARY", j.Summary))
+	}
+
+	for _, d := range j.Descriptions {
+		c.Add(textProperty("DESCRIPTION", d))
+	}
+
+	if len(j.Categories) > 0 {
+		c.Add(categoriesProperty(j.Categories))
+	}
+
+	for _, a := range j.Attachments {
+		c.Add(attachmentProperty(a))
+	}
+
+	if j.Organizer.Email != "" || j.Organizer.Name != "" {
+		c.Add(attendeeProperty("ORGANIZER", j.Organizer))
+	}
+
+	for _, a := range j.Attendees {
+		c.Add(attendeeProperty("ATTENDEE", a))
+	}
+
+	return c
+}
+
+func categoriesProperty(categories []string) *Property {
+	escaped := make([]string, len(categories))
+	for i, category := range categories {
+		escaped[i] = escapeText(category)
+	}
+	return &Property{Name: "CATEGORIES", Value: strings.Join(escaped, ",")}
+}
+
+// attachmentProperty returns the ATTACH property for the attachment, which
+// has its data encoded in base64 if it is inlined.
+func attachmentProperty(a Attachment) *Property {
+	prop := &Property{Name: "ATTACH", Value: a.URI}
+	if a.FormatType != "" {
+		prop.Params.Set("FMTTYPE", a.FormatType)
+	}
+
+	if a.Data != nil {
+		prop.Params.Set("ENCODING", "BASE64")
+		prop.Params.Set("VALUE", "BINARY")
+		prop.Value = base64.StdEncoding.EncodeToString(a.Data)
+	}
+	return prop
+}
+
+// addStamp adds to the generated component of an entity the DTSTAMP of the
+// component the entity was parsed from, if it had one. Entities that were
+// not parsed get theirs from the clock of the encoder when written.
+func addStamp(c, parsed *Component) {
+	if parsed == nil {
+		return
+	}
+
+	if p := parsed.Property("DTSTAMP"); p != nil {
+		c.Add(&Property{Name: "DTSTAMP", Value: p.Value})
+	}
+}
+
+func attendeeProperty(name string, a Attendee) *Property {
+	prop := &Property{Name: name, Value: mailto(a.Email)}
+	if a.Type != "" {
+		prop.Params.Set("CUTYPE", a.Type)
+	}
+	if a.Role != "" {
+		prop.Params.Set("ROLE", a.Role)
+	}
+	if a.Status != "" {
+		prop.Params.Set("PARTSTAT", a.Status)
+	}
+	if a.Name != "" {
+		prop.Params.Set("CN", a.Name)
+	}
+
+	for _, param := range a.Params {
+		if !attendeeParams[strings.ToUpper(param.Name)] {
+			prop.Params = append(prop.Params, param)
+		}
+	}
+	return prop
+}
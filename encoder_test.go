@@ -0,0 +1,378 @@
+package ics
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	files := []string{
+		"testCalendars/2eventsCal.ics",
+		"testCalendars/3eventsNoAttendee.ics",
+		"testCalendars/repetition.ics",
+	}
+
+	for _, f := range files {
+		calendar, err := ParseCalendar(f, 0, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", f, err)
+		}
+
+		var buf bytes.Buffer
+		if _, err := calendar.WriteTo(&buf); err != nil {
+			t.Fatalf("%s: %s", f, err)
+		}
+
+		result, err := ParseICalContent(buf.String(), calendar.URL, 0)
+		if err != nil {
+			t.Fatalf("%s: %s", f, err)
+		}
+
+		assertCalendarsEqual(t, calendar, result)
+	}
+}
+
+func TestEncodeEvent(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.FailNow()
+	}
+
+	cal := NewCalendar()
+	cal.Name = "Team, events; and more"
+	cal.Version = 2.0
+	cal.Events = append(cal.Events, Event{
+		ID:          "1@example.com",
+		Start:       time.Date(2016, time.April, 21, 10, 0, 0, 0, loc),
+		End:         time.Date(2016, time.April, 21, 11, 30, 0, 0, loc),
+		Created:     time.Date(2016, time.March, 29, 10, 38, 57, 0, time.UTC),
+		Summary:     "Weekly sync",
+		Description: strings.Repeat("Lorem ipsum dolor sit amet, ñandú. ", 5) + "\nSecond line",
+		RRule:       "FREQ=WEEKLY;BYDAY=TH",
+		ExDates:     []time.Time{time.Date(2016, time.April, 28, 10, 0, 0, 0, loc)},
+		Organizer:   Attendee{Name: "Doe, Jane", Email: "jane@example.com"},
+		Attendees: []Attendee{
+			{Name: "John Smith", Email: "john@example.com", Status: "ACCEPTED", Role: "REQ-PARTICIPANT", Type: "INDIVIDUAL"},
+		},
+	})
+
+	var buf bytes.Buffer
+	if _, err := cal.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, line := range strings.SplitAfter(out, "\r\n") {
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasSuffix(line, "\r\n") {
+			t.Errorf("expected line %q to end with CRLF", line)
+		}
+
+		if len(line)-2 > maxLineLength {
+			t.Errorf("expected line %q to be folded", line)
+		}
+	}
+
+	expected := []string{
+		"X-WR-CALNAME:Team\\, events\\; and more\r\n",
+		"DTSTART;TZID=Europe/Madrid:20160421T100000\r\n",
+		"EXDATE;TZID=Europe/Madrid:20160428T100000\r\n",
+		"RRULE:FREQ=WEEKLY;BYDAY=TH\r\n",
+		"ORGANIZER;CN=\"Doe, Jane\":mailto:jane@example.com\r\n",
+		// the timezone of the event is defined in the calendar
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Madrid\r\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("expected output to contain %q:\n%s", e, out)
+		}
+	}
+
+	result, err := ParseICalContent(out, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertCalendarsEqual(t, cal, result)
+
+	if _, ok := result.Timezones["Europe/Madrid"]; !ok || strings.Count(out, "BEGIN:VTIMEZONE") != 1 {
+		t.Errorf("expected a single VTIMEZONE for Europe/Madrid, got %v", result.Timezones)
+	}
+}
+
+func TestEncodeEventEnd(t *testing.T) {
+	content := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:duration@example.com",
+		"DTSTAMP:20160701T120000Z",
+		"DTSTART:20160704T100000Z",
+		"DURATION:PT1H30M",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:day@example.com",
+		"DTSTAMP:20160701T120000Z",
+		"DTSTART;VALUE=DATE:20160705",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	cal, err := ParseICalContent(content, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an all-day event built in code that ends when it starts
+	cal.Events = append(cal.Events, Event{
+		ID:            "built@example.com",
+		Start:         time.Date(2016, time.July, 6, 0, 0, 0, 0, time.UTC),
+		End:           time.Date(2016, time.July, 6, 0, 0, 0, 0, time.UTC),
+		WholeDayEvent: true,
+	})
+
+	var buf bytes.Buffer
+	if _, err := cal.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, expected := range []string{"DURATION:PT1H30M\r\n", "DTEND;VALUE=DATE:20160707\r\n"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain %q:\n%s", expected, out)
+		}
+	}
+
+	for _, unexpected := range []string{"DTEND:20160704", "DTEND;VALUE=DATE:20160705"} {
+		if strings.Contains(out, unexpected) {
+			t.Errorf("expected output not to contain %q:\n%s", unexpected, out)
+		}
+	}
+
+	result, err := ParseICalContent(out, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the end of the parsed events is the same once they are read again
+	for i, e := range result.Events[:2] {
+		if e.ID != cal.Events[i].ID || e.Duration != cal.Events[i].Duration || !e.End.Equal(cal.Events[i].End) {
+			t.Errorf("expected event %+v, got %+v", cal.Events[i], e)
+		}
+	}
+}
+
+func TestEncodeReplyStamps(t *testing.T) {
+	content := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:meeting@example.com",
+		"DTSTAMP:20160701T120000Z",
+		"DTSTART:20160704T100000Z",
+		"ATTENDEE;PARTSTAT=ACCEPTED;X-REPLY-DTSTAMP=20160701T130000Z:mailto:bob@example.com",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	for _, roundTrip := range []bool{false, true} {
+		for method, kept := range map[string]bool{"": true, "PUBLISH": true, "REQUEST": false, "reply": false} {
+			cal, err := ParseICalContent(content, "", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cal.Method = method
+
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf)
+			enc.SetRoundTrip(roundTrip)
+			if err := enc.Encode(&cal); err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(buf.String(), ReplyStampParam) != kept {
+				t.Errorf("round trip %v, method %q: expected the reply stamp to be kept %v:\n%s", roundTrip, method, kept, buf.String())
+			}
+
+			// the parsed component is never changed
+			if cal.Events[0].Component.Property("ATTENDEE").Params.Get(ReplyStampParam) == "" {
+				t.Errorf("round trip %v, method %q: the reply stamp was removed from the parsed event", roundTrip, method)
+			}
+		}
+	}
+}
+
+func TestEncodeThisAndFuture(t *testing.T) {
+	cal := NewCalendar()
+	cal.Events = append(cal.Events, Event{
+		ID:            "1@example.com",
+		Start:         time.Date(2016, time.April, 21, 12, 0, 0, 0, time.UTC),
+		End:           time.Date(2016, time.April, 21, 13, 0, 0, 0, time.UTC),
+		RecurrenceID:  time.Date(2016, time.April, 21, 10, 0, 0, 0, time.UTC),
+		ThisAndFuture: true,
+	})
+
+	var buf bytes.Buffer
+	if _, err := cal.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "RECURRENCE-ID;RANGE=THISANDFUTURE:20160421T100000Z\r\n") {
+		t.Errorf("expected RECURRENCE-ID with RANGE=THISANDFUTURE, got:\n%s", buf.String())
+	}
+
+	result, err := ParseICalContent(buf.String(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Events) != 1 || !result.Events[0].ThisAndFuture {
+		t.Errorf("expected override with RANGE=THISANDFUTURE, got %v", result.Events)
+	}
+}
+
+func TestEncodeStamp(t *testing.T) {
+	cal, err := ParseICalContent(strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"UID:parsed@example.com",
+		"DTSTAMP:20160401T080000Z",
+		"DTSTART:20160421T100000Z",
+		"LAST-MODIFIED:20160402T080000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:unstamped@example.com",
+		"DTSTART:20160422T100000Z",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")+"\r\n", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cal.Events = append(cal.Events, Event{
+		ID:       "new@example.com",
+		Start:    time.Date(2016, time.April, 23, 10, 0, 0, 0, time.UTC),
+		Modified: time.Date(2016, time.April, 3, 8, 0, 0, 0, time.UTC),
+	})
+
+	encode := func() string {
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf)
+		enc.SetClock(func() time.Time { return time.Date(2016, time.May, 1, 9, 0, 0, 0, time.UTC) })
+		if err := enc.Encode(&cal); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	out := encode()
+	for _, expected := range []string{
+		"UID:parsed@example.com\r\nDTSTAMP:20160401T080000Z\r\n",
+		"UID:unstamped@example.com\r\nDTSTART:20160422T100000Z\r\n",
+		"UID:new@example.com\r\nDTSTAMP:20160501T090000Z\r\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain %q:\n%s", expected, out)
+		}
+	}
+
+	if encode() != out {
+		t.Errorf("expected encoding to be deterministic")
+	}
+}
+
+func TestEncoderFoldsMultiByteCharacters(t *testing.T) {
+	var buf bytes.Buffer
+	comp := NewComponent("VEVENT")
+	comp.Add(&Property{Name: "SUMMARY", Value: strings.Repeat("ñ", 100)})
+	if err := NewEncoder(&buf).EncodeComponent(comp); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if !strings.Contains(line, "ñ") {
+			continue
+		}
+
+		if strings.ContainsRune(line, '\uFFFD') || !strings.HasSuffix(line, "ñ") {
+			t.Errorf("expected multi-byte characters not to be split in %q", line)
+		}
+	}
+
+	prop, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := prop.Value("SUMMARY"); v != strings.Repeat("ñ", 100) {
+		t.Errorf("expected unfolded summary, got %q", v)
+	}
+}
+
+func assertCalendarsEqual(t *testing.T, expected, result Calendar) {
+	t.Helper()
+	if expected.Name != result.Name || expected.Description != result.Description || expected.Version != result.Version {
+		t.Errorf("expected calendar %q %q %v, got %q %q %v", expected.Name, expected.Description, expected.Version, result.Name, result.Description, result.Version)
+	}
+
+	if expected.Timezone.String() != result.Timezone.String() {
+		t.Errorf("expected timezone %s, got %s", expected.Timezone, result.Timezone)
+	}
+
+	if len(expected.Events) != len(result.Events) {
+		t.Fatalf("expected %d events, got %d", len(expected.Events), len(result.Events))
+	}
+
+	sortEvents(expected.Events)
+	sortEvents(result.Events)
+	for i := range expected.Events {
+		e, r := expected.Events[i], result.Events[i]
+		times := [][2]time.Time{
+			{e.Start, r.Start}, {e.End, r.End}, {e.Created, r.Created},
+			{e.Modified, r.Modified}, {e.RecurrenceID, r.RecurrenceID},
+		}
+		for _, ts := range times {
+			if !ts[0].Equal(ts[1]) {
+				t.Errorf("event %q: expected time %s, got %s", e.Summary, ts[0], ts[1])
+			}
+		}
+
+		if len(e.ExDates) != len(r.ExDates) || len(e.RDates) != len(r.RDates) {
+			t.Errorf("event %q: expected %d excluded and %d recurrence dates, got %d and %d", e.Summary, len(e.ExDates), len(e.RDates), len(r.ExDates), len(r.RDates))
+		}
+
+		// events built by hand do not have the values they were parsed from
+		for _, dts := range [][2]*DateTime{{&e.DTStart, &r.DTStart}, {&e.DTEnd, &r.DTEnd}} {
+			if dts[0].IsZero() {
+				continue
+			}
+
+			if !dts[0].Time.Equal(dts[1].Time) || dts[0].Kind != dts[1].Kind || dts[0].TZID != dts[1].TZID {
+				t.Errorf("event %q: expected value %+v, got %+v", e.Summary, *dts[0], *dts[1])
+			}
+		}
+
+		e.DTStart, e.DTEnd = r.DTStart, r.DTEnd
+		e.Start, e.End, e.Created, e.Modified, e.RecurrenceID, e.Component = r.Start, r.End, r.Created, r.Modified, r.RecurrenceID, r.Component
+		e.ExDates, e.RDates = r.ExDates, r.RDates
+		if !reflect.DeepEqual(e, r) {
+			t.Errorf("expected event:\n%+v\ngot:\n%+v", e, r)
+		}
+	}
+}
+
+func sortEvents(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].Start.Equal(events[j].Start) {
+			return events[i].Start.Before(events[j].Start)
+		}
+		return events[i].Summary < events[j].Summary
+	})
+}
@@ -5,10 +5,20 @@ import (
 	"time"
 )
 
-// Event represents an event in the calendar
+// Event represents an event in the calendar. Events with a RecurrenceID
+// override an instance of the repeating event with the same ID, and if
+// ThisAndFuture is true (RANGE=THISANDFUTURE) all the following ones too.
+//
+// Start and End are the instants in which the event starts and ends, while
+// DTStart and DTEnd are the values of DTSTART and DTEND as they are in the
+// calendar, which tell whether they are floating, UTC, zoned or dates.
+// Transparent events (TRANSP:TRANSPARENT) do not take any time in the
+// free/busy time of the calendar.
 type Event struct {
 	Start         time.Time
 	End           time.Time
+	DTStart       DateTime
+	DTEnd         DateTime
 	Created       time.Time
 	Modified      time.Time
 	AlarmTime     time.Duration
@@ -18,12 +28,31 @@ type Event struct {
 	Location      string
 	Summary       string
 	RRule         string
+	RDates        []time.Time
+	ExDates       []time.Time
 	RecurrenceID  time.Time
+	ThisAndFuture bool
 	Class         string
 	Sequence      int
 	Attendees     []Attendee
 	Organizer     Attendee
 	WholeDayEvent bool
+	Transparent   bool
+	Alarms        []Alarm
+
+	// Duration is the value of DURATION for the events whose end is given
+	// by it instead of DTEND, and 0 for the rest.
+	Duration time.Duration
+
+	// Repetition is the number of the repetition of a repeating event this
+	// event was generated from, starting at 1, when the calendar is parsed
+	// with maxRepeats greater than 0. It is 0 for the events that are in
+	// the calendar.
+	Repetition int
+
+	// Component is the raw VEVENT component the event was parsed from. It
+	// is shared by all the occurrences generated from the same event.
+	Component *Component
 }
 
 type byDate []Event
@@ -57,48 +86,110 @@ func (e *Event) Equals(e2 *Event) bool {
 	return e.Start.Equal(e2.Start) && e.End.Equal(e2.End) && e.Summary == e2.Summary
 }
 
-// ExcludeRecurrences receives a list of events and removes the repetitions that
-// have been overriden
+// ExcludeRecurrences receives a list of events, in which repeating events
+// have already been expanded, and replaces the repetitions that have been
+// overridden by another event with the same ID and a RECURRENCE-ID matching
+// their start. Overrides with RANGE=THISANDFUTURE also replace all the
+// following repetitions, which are moved by the same amount of time and
+// get the duration of the override. If there are several overrides for the
+// same repetition the one with the highest sequence is used.
 func ExcludeRecurrences(evs []Event) []Event {
 	result := []Event{}
+	var ids []string
 	eventsByID := make(map[string][]Event)
 	for _, e := range evs {
 		if _, ok := eventsByID[e.ID]; !ok {
-			eventsByID[e.ID] = []Event{e}
-		} else {
-			eventsByID[e.ID] = append(eventsByID[e.ID], e)
+			ids = append(ids, e.ID)
 		}
+		eventsByID[e.ID] = append(eventsByID[e.ID], e)
 	}
 
-	for _, evs := range eventsByID {
-		if len(evs) == 1 {
-			result = append(result, evs[0])
-			continue
+	for _, id := range ids {
+		var instances, overrides []*Event
+		evs := eventsByID[id]
+		for i := range evs {
+			if evs[i].RecurrenceID.IsZero() {
+				instances = append(instances, &evs[i])
+			} else {
+				overrides = append(overrides, &evs[i])
+			}
 		}
 
-		for i := 0; i < len(evs); i++ {
-			if i+1 >= len(evs) {
-				result = append(result, evs[i])
+		byID, ranges := indexOverrides(overrides)
+		for _, e := range instances {
+			if _, ok := byID[e.Start.UnixNano()]; ok {
 				continue
 			}
 
-			event := evs[i]
-			nextEvent := evs[i+1]
-
-			if event.ID == nextEvent.ID {
-				if event.RecurrenceID.Equal(nextEvent.Start) {
-					i++
-				} else if nextEvent.RecurrenceID.Equal(event.Start) {
-					i++
-					result = append(result, nextEvent)
-					continue
-				}
+			if r := rangeOverride(ranges, e.Start); r != nil {
+				shifted := r.shifted(e.Start)
+				shifted.Repetition = e.Repetition
+				result = append(result, *shifted)
+				continue
 			}
 
-			result = append(result, event)
+			result = append(result, *e)
+		}
+
+		for _, e := range overrides {
+			if byID[e.RecurrenceID.UnixNano()] == e {
+				result = append(result, *e)
+			}
 		}
 	}
 
-	sort.Sort(byDate(result))
+	sort.Stable(byDate(result))
 	return result
 }
+
+// indexOverrides returns the given overrides by the start of the instance
+// they override, keeping only the one with the highest sequence for each
+// instance, and the ones with RANGE=THISANDFUTURE among them sorted by
+// the start of the instance they override.
+func indexOverrides(overrides []*Event) (map[int64]*Event, []*Event) {
+	byID := make(map[int64]*Event)
+	for _, e := range overrides {
+		key := e.RecurrenceID.UnixNano()
+		if prev, ok := byID[key]; !ok || e.Sequence > prev.Sequence {
+			byID[key] = e
+		}
+	}
+
+	var ranges []*Event
+	for _, e := range byID {
+		if e.ThisAndFuture {
+			ranges = append(ranges, e)
+		}
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].RecurrenceID.Before(ranges[j].RecurrenceID)
+	})
+
+	return byID, ranges
+}
+
+// rangeOverride returns the override with RANGE=THISANDFUTURE that applies
+// to the instance starting at the given time, which is the last one
+// overriding an instance before it.
+func rangeOverride(ranges []*Event, start time.Time) *Event {
+	var result *Event
+	for _, r := range ranges {
+		if !r.RecurrenceID.Before(start) {
+			break
+		}
+		result = r
+	}
+	return result
+}
+
+// shifted returns the instance starting at the given time of a repeating
+// event overridden by the current event with RANGE=THISANDFUTURE.
+func (e *Event) shifted(start time.Time) *Event {
+	newEvent := e.Clone()
+	newEvent.Start = start.Add(e.Start.Sub(e.RecurrenceID))
+	newEvent.End = newEvent.Start.Add(e.End.Sub(e.Start))
+	newEvent.RecurrenceID = start
+	newEvent.ThisAndFuture = false
+	return newEvent
+}
@@ -59,6 +59,62 @@ func TestExcludeRecurrences(t *testing.T) {
 	}
 }
 
+func TestExcludeRecurrencesHighestSequence(t *testing.T) {
+	eventList := []Event{
+		{ID: "1", Start: d("20150830T103000Z"), End: d("20150830T113000Z")},
+		{ID: "1", Summary: "new", Sequence: 2, Start: d("20150830T143000Z"), End: d("20150830T153000Z"), RecurrenceID: d("20150830T103000Z")},
+		{ID: "1", Summary: "old", Sequence: 1, Start: d("20150830T123000Z"), End: d("20150830T133000Z"), RecurrenceID: d("20150830T103000Z")},
+	}
+
+	result := ExcludeRecurrences(eventList)
+	if len(result) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(result))
+	}
+
+	if result[0].Summary != "new" {
+		t.Errorf("expected override with the highest sequence, got %q", result[0].Summary)
+	}
+}
+
+func TestExcludeRecurrencesThisAndFuture(t *testing.T) {
+	eventList := []Event{
+		{ID: "1", Summary: "b", ThisAndFuture: true, Start: d("20150902T120000Z"), End: d("20150902T123000Z"), RecurrenceID: d("20150902T100000Z")},
+		{ID: "1", Start: d("20150901T100000Z"), End: d("20150901T110000Z")},
+		{ID: "1", Start: d("20150902T100000Z"), End: d("20150902T110000Z")},
+		{ID: "1", Start: d("20150903T100000Z"), End: d("20150903T110000Z")},
+		{ID: "1", Summary: "c", Start: d("20150903T080000Z"), End: d("20150903T090000Z"), RecurrenceID: d("20150903T100000Z")},
+		{ID: "1", Start: d("20150904T100000Z"), End: d("20150904T110000Z")},
+		{ID: "2", Start: d("20150904T100000Z"), End: d("20150904T110000Z")},
+	}
+
+	result := ExcludeRecurrences(eventList)
+	expected := []struct {
+		id, summary string
+		start, end  time.Time
+	}{
+		{"1", "", d("20150901T100000Z"), d("20150901T110000Z")},
+		{"1", "b", d("20150902T120000Z"), d("20150902T123000Z")},
+		{"1", "c", d("20150903T080000Z"), d("20150903T090000Z")},
+		{"2", "", d("20150904T100000Z"), d("20150904T110000Z")},
+		{"1", "b", d("20150904T120000Z"), d("20150904T123000Z")},
+	}
+
+	if len(result) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %v", len(expected), len(result), result)
+	}
+
+	for i, e := range expected {
+		r := result[i]
+		if r.ID != e.id || r.Summary != e.summary || !r.Start.Equal(e.start) || !r.End.Equal(e.end) {
+			t.Errorf("expected event %d to be %s %q at %s-%s, got %s %q at %s-%s", i, e.id, e.summary, e.start, e.end, r.ID, r.Summary, r.Start, r.End)
+		}
+	}
+
+	if shifted := result[4]; shifted.ThisAndFuture || !shifted.RecurrenceID.Equal(d("20150904T100000Z")) {
+		t.Errorf("expected shifted instance to override only itself, got %v", shifted)
+	}
+}
+
 func d(t string) time.Time {
 	tm, _ := time.Parse(icsFormat, t)
 	return tm
@@ -0,0 +1,258 @@
+package ics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Types of the periods of free/busy time.
+const (
+	FreeBusyFree        = "FREE"
+	FreeBusyBusy        = "BUSY"
+	FreeBusyTentative   = "BUSY-TENTATIVE"
+	FreeBusyUnavailable = "BUSY-UNAVAILABLE"
+)
+
+// FreeBusy is the free/busy time of someone in a time window, a VFREEBUSY
+// component. It can be a request of free/busy time as well as a reply to
+// it or the published free/busy time of a calendar.
+type FreeBusy struct {
+	Start     time.Time
+	End       time.Time
+	ID        string
+	URL       string
+	Comment   string
+	Organizer Attendee
+	Attendees []Attendee
+	Periods   []Period
+
+	// Component is the raw VFREEBUSY component the free/busy time was
+	// parsed from.
+	Component *Component
+}
+
+// Period is a time window, a PERIOD value. In free/busy time Type is one
+// of the types of free/busy time, BUSY if it is not defined.
+type Period struct {
+	Start time.Time
+	End   time.Time
+	Type  string
+}
+
+// NewFreeBusy returns a new empty FreeBusy entity
+func NewFreeBusy() *FreeBusy {
+	return &FreeBusy{
+		Attendees: []Attendee{},
+	}
+}
+
+// FreeBusy returns the busy time of the calendar between from and to,
+// built from the occurrences of its events, which are clipped to the time
+// window, and from its availabilities. Overlapping occurrences are merged
+// in a single period. Tentative events are BUSY-TENTATIVE and transparent
+// and cancelled events do not take any time. The time outside of the
+// available time of the availabilities is busy with the type they define.
+// If to is zero the window has no end.
+func (c *Calendar) FreeBusy(from, to time.Time) *FreeBusy {
+	fb := NewFreeBusy()
+	fb.Start, fb.End = from, to
+
+	var periods []Period
+	for o := range c.Between(from, to) {
+		if o.Event.Transparent || strings.EqualFold(o.Event.Status, "CANCELLED") {
+			continue
+		}
+
+		p := Period{Start: o.Start, End: o.End, Type: FreeBusyBusy}
+		if strings.EqualFold(o.Event.Status, "TENTATIVE") {
+			p.Type = FreeBusyTentative
+		}
+
+		if p.Start.Before(from) {
+			p.Start = from
+		}
+
+		if !to.IsZero() && p.End.After(to) {
+			p.End = to
+		}
+
+		periods = append(periods, p)
+	}
+
+	periods = append(periods, c.unavailable(from, to)...)
+	fb.Periods = mergePeriods(periods)
+	return fb
+}
+
+// mergePeriods returns the given periods ordered by their start, with the
+// ones of the same type that overlap or are adjacent merged.
+func mergePeriods(periods []Period) []Period {
+	sort.SliceStable(periods, func(i, j int) bool {
+		return periods[i].Start.Before(periods[j].Start)
+	})
+
+	var result []Period
+	last := make(map[string]int)
+	for _, p := range periods {
+		if i, ok := last[p.Type]; ok && !p.Start.After(result[i].End) {
+			if p.End.After(result[i].End) {
+				result[i].End = p.End
+			}
+			continue
+		}
+
+		last[p.Type] = len(result)
+		result = append(result, p)
+	}
+	return result
+}
+
+func parseFreeBusies(cal *Calendar, freeBusiesData []*Component) error {
+	for _, fbData := range freeBusiesData {
+		fb := NewFreeBusy()
+		fb.Component = fbData
+
+		start, err := parseDateProperty("DTSTART", fbData, cal.Timezones)
+		if err != nil {
+			return err
+		}
+
+		end, err := parseDateProperty("DTEND", fbData, cal.Timezones)
+		if err != nil {
+			return err
+		}
+
+		fb.Periods, err = parseFreeBusyPeriods(fbData, cal.Timezones, cal.Timezone)
+		if err != nil {
+			return err
+		}
+
+		fb.Start = start.In(cal.Timezone)
+		fb.End = end.In(cal.Timezone)
+		fb.ID = parseUID(fbData)
+		fb.URL = fbData.Value("URL")
+		fb.Comment = unescapeText(fbData.Value("COMMENT"))
+		fb.Attendees = parseAttendees(fbData)
+		fb.Organizer = parseOrganizer(fbData)
+		fbData.typed = freeBusyComponent(fb)
+		cal.FreeBusies = append(cal.FreeBusies, *fb)
+	}
+
+	return nil
+}
+
+func parseFreeBusyPeriods(data *Component, tz Timezones, loc *time.Location) ([]Period, error) {
+	var periods []Period
+	for _, prop := range data.PropertiesNamed("FREEBUSY") {
+		fbType := strings.ToUpper(prop.Params.Get("FBTYPE"))
+		if fbType == "" {
+			fbType = FreeBusyBusy
+		}
+
+		for _, v := range strings.Split(prop.Value, ",") {
+			p, err := parsePeriod(v, tz, loc)
+			if err != nil {
+				return nil, err
+			}
+
+			p.Type = fbType
+			periods = append(periods, p)
+		}
+	}
+	return periods, nil
+}
+
+// parsePeriod parses a PERIOD value, which is either a start and an end or
+// a start and a duration separated by a slash. Floating times are resolved
+// in the given location.
+func parsePeriod(value string, tz Timezones, loc *time.Location) (Period, error) {
+	i := strings.IndexByte(value, '/')
+	if i < 0 {
+		return Period{}, fmt.Errorf("invalid period %q", value)
+	}
+
+	start, err := parseDatetime(value[:i], "", tz)
+	if err != nil {
+		return Period{}, err
+	}
+
+	p := Period{Start: start.In(loc)}
+	if v := value[i+1:]; strings.HasPrefix(v, "P") || strings.HasPrefix(v, "+P") || strings.HasPrefix(v, "-P") {
+		d, err := parseDuration(v)
+		if err != nil {
+			return Period{}, err
+		}
+		p.End = p.Start.Add(d)
+	} else {
+		end, err := parseDatetime(v, "", tz)
+		if err != nil {
+			return Period{}, err
+		}
+		p.End = end.In(loc)
+	}
+
+	return p, nil
+}
+
+// formatPeriod returns the PERIOD value for the period, with its start and
+// end in UTC.
+func formatPeriod(p Period) string {
+	return p.Start.UTC().Format(icsFormat) + "/" + p.End.UTC().Format(icsFormat)
+}
+
+// freeBusyComponent returns the VFREEBUSY component for the free/busy time.
+// Consecutive periods of the same type are written in the same FREEBUSY
+// property.
+func freeBusyComponent(fb *FreeBusy) *Component {
+	c := NewComponent("VFREEBUSY")
+	c.origin = fb.Component
+	if fb.ID != "" {
+		c.Add(&Property{Name: "UID", Value: fb.ID})
+	}
+	addStamp(c, fb.Component)
+
+	if !fb.Start.IsZero() {
+		c.Add(&Property{Name: "DTSTART", Value: fb.Start.UTC().Format(icsFormat)})
+	}
+
+	if !fb.End.IsZero() {
+		c.Add(&Property{Name: "DTEND", Value: fb.End.UTC().Format(icsFormat)})
+	}
+
+	if fb.URL != "" {
+		c.Add(&Property{Name: "URL", Value: fb.URL})
+	}
+
+	if fb.Comment != "" {
+		c.Add(textProperty("COMMENT", fb.Comment))
+	}
+
+	if fb.Organizer.Email != "" || fb.Organizer.Name != "" {
+		c.Add(attendeeProperty("ORGANIZER", fb.Organizer))
+	}
+
+	for _, a := range fb.Attendees {
+		c.Add(attendeeProperty("ATTENDEE", a))
+	}
+
+	var prop *Property
+	for _, p := range fb.Periods {
+		fbType := p.Type
+		if fbType == "" {
+			fbType = FreeBusyBusy
+		}
+
+		if prop != nil && strings.EqualFold(prop.Params.Get("FBTYPE"), fbType) {
+			prop.Value += "," + formatPeriod(p)
+			continue
+		}
+
+		prop = &Property{Name: "FREEBUSY", Value: formatPeriod(p)}
+		prop.Params.Set("FBTYPE", fbType)
+		c.Add(prop)
+	}
+
+	return c
+}
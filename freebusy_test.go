@@ -0,0 +1,193 @@
+package ics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testFreeBusy = strings.Join([]string{
+	"BEGIN:VCALENDAR",
+	"VERSION:2.0",
+	"PRODID:-//Example Corp.//CalDAV Server//EN",
+	"METHOD:REPLY",
+	"BEGIN:VFREEBUSY",
+	"UID:19970901T095957Z-76A912@example.com",
+	"DTSTAMP:19970901T100000Z",
+	"DTSTART:19971015T050000Z",
+	"DTEND:19971016T050000Z",
+	"ORGANIZER;CN=Jane:mailto:jane@example.com",
+	"ATTENDEE:mailto:john@example.com",
+	"COMMENT:Busy\\, sorry",
+	"FREEBUSY:19971015T050000Z/PT8H30M,19971015T160000Z/PT5H30M",
+	"FREEBUSY;FBTYPE=BUSY-TENTATIVE:19971015T223000Z/19971016T030000Z",
+	"FREEBUSY;FBTYPE=FREE:19971016T030000Z/PT2H",
+	"END:VFREEBUSY",
+	"END:VCALENDAR",
+	"",
+}, "\r\n")
+
+func TestParseFreeBusy(t *testing.T) {
+	cal, err := ParseICalContent(testFreeBusy, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cal.FreeBusies) != 1 {
+		t.Fatalf("expected 1 free/busy time, got %d", len(cal.FreeBusies))
+	}
+
+	date := func(day, hour, min int) time.Time {
+		return time.Date(1997, time.October, day, hour, min, 0, 0, time.UTC)
+	}
+
+	fb := cal.FreeBusies[0]
+	if !fb.Start.Equal(date(15, 5, 0)) || !fb.End.Equal(date(16, 5, 0)) {
+		t.Errorf("expected free/busy time from %s to %s, got %s to %s", date(15, 5, 0), date(16, 5, 0), fb.Start, fb.End)
+	}
+
+	if fb.Organizer.Email != "jane@example.com" || len(fb.Attendees) != 1 || fb.Comment != "Busy, sorry" {
+		t.Errorf("unexpected free/busy time %+v", fb)
+	}
+
+	expected := []Period{
+		{date(15, 5, 0), date(15, 13, 30), FreeBusyBusy},
+		{date(15, 16, 0), date(15, 21, 30), FreeBusyBusy},
+		{date(15, 22, 30), date(16, 3, 0), FreeBusyTentative},
+		{date(16, 3, 0), date(16, 5, 0), FreeBusyFree},
+	}
+
+	assertPeriodsEqual(t, expected, fb.Periods)
+}
+
+func TestParsePeriod(t *testing.T) {
+	for _, v := range []string{"19971015T050000Z", "19971015T050000Z/", "19971015T050000Z/PX", "1997/PT1H"} {
+		if _, err := parsePeriod(v, nil, time.UTC); err == nil {
+			t.Errorf("%q: expected an error", v)
+		}
+	}
+}
+
+func TestCalendarFreeBusy(t *testing.T) {
+	cal, err := ParseICalContent(strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"DTSTART:20160704T090000Z",
+		"DTEND:20160704T093000Z",
+		"RRULE:FREQ=DAILY;COUNT=3",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:review",
+		"DTSTART:20160704T092000Z",
+		"DTEND:20160704T100000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:lunch",
+		"DTSTART:20160705T120000Z",
+		"DTEND:20160705T130000Z",
+		"STATUS:TENTATIVE",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:holiday",
+		"DTSTART;VALUE=DATE:20160705",
+		"DTEND;VALUE=DATE:20160706",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:cancelled",
+		"DTSTART:20160705T150000Z",
+		"DTEND:20160705T160000Z",
+		"STATUS:CANCELLED",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:late",
+		"DTSTART:20160705T230000Z",
+		"DTEND:20160706T010000Z",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n"), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := func(day, hour, min int) time.Time {
+		return time.Date(2016, time.July, day, hour, min, 0, 0, time.UTC)
+	}
+
+	fb := cal.FreeBusy(date(4, 9, 10), date(6, 0, 0))
+	if !fb.Start.Equal(date(4, 9, 10)) || !fb.End.Equal(date(6, 0, 0)) {
+		t.Errorf("unexpected time window %s to %s", fb.Start, fb.End)
+	}
+
+	expected := []Period{
+		{date(4, 9, 10), date(4, 10, 0), FreeBusyBusy},
+		{date(5, 9, 0), date(5, 9, 30), FreeBusyBusy},
+		{date(5, 12, 0), date(5, 13, 0), FreeBusyTentative},
+		{date(5, 23, 0), date(6, 0, 0), FreeBusyBusy},
+	}
+
+	assertPeriodsEqual(t, expected, fb.Periods)
+}
+
+func TestEncodeFreeBusy(t *testing.T) {
+	cal, err := ParseICalContent(testFreeBusy, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := cal.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []string{
+		"FREEBUSY;FBTYPE=BUSY:19971015T050000Z/19971015T133000Z,19971015T160000Z/199\r\n 71015T213000Z\r\n",
+		"FREEBUSY;FBTYPE=BUSY-TENTATIVE:19971015T223000Z/19971016T030000Z\r\n",
+		"DTSTART:19971015T050000Z\r\n",
+		"ORGANIZER;CN=Jane:mailto:jane@example.com\r\n",
+	} {
+		if !strings.Contains(buf.String(), e) {
+			t.Errorf("expected output to contain %q:\n%s", e, buf.String())
+		}
+	}
+
+	result, err := ParseICalContent(buf.String(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertPeriodsEqual(t, cal.FreeBusies[0].Periods, result.FreeBusies[0].Periods)
+}
+
+func TestRoundTripFreeBusy(t *testing.T) {
+	cal, err := ParseICalContent(testFreeBusy, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out := encodeRoundTrip(t, &cal); out != testFreeBusy {
+		t.Errorf("expected output to be identical to the input, got:\n%s", out)
+	}
+
+	cal.FreeBusies[0].Periods = cal.FreeBusies[0].Periods[2:]
+	out := encodeRoundTrip(t, &cal)
+	if strings.Contains(out, "PT8H30M") || !strings.Contains(out, "COMMENT:Busy\\, sorry\r\nFREEBUSY;FBTYPE=BUSY-TENTATIVE") {
+		t.Errorf("expected modified periods to be written, got:\n%s", out)
+	}
+}
+
+func assertPeriodsEqual(t *testing.T, expected, periods []Period) {
+	t.Helper()
+	if len(periods) != len(expected) {
+		t.Fatalf("expected %d periods, got %v", len(expected), periods)
+	}
+
+	for i, p := range periods {
+		e := expected[i]
+		if !p.Start.Equal(e.Start) || !p.End.Equal(e.End) || p.Type != e.Type {
+			t.Errorf("expected period %d to be %v, got %v", i, e, p)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/erizocosmico/go-ics
+
+go 1.23
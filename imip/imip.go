@@ -0,0 +1,341 @@
+// Package imip implements the iCalendar Message-Based Interoperability
+// Protocol (iMIP), as defined in RFC 6047, which sends iTIP messages by
+// email.
+//
+// Parse extracts the calendars that come in an email, such as an
+// invitation:
+//
+//	msg, err := imip.Parse(r)
+//	if err != nil {
+//		// handle error
+//	}
+//
+//	for _, cal := range msg.Calendars {
+//		// cal.Method is REQUEST, REPLY, ...
+//	}
+//
+// And Write writes an email with an iTIP message built by the itip package.
+package imip
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/erizocosmico/go-ics"
+	"github.com/erizocosmico/go-ics/itip"
+)
+
+// Message is an email with the calendars it carries.
+type Message struct {
+	Header mail.Header
+	// Calendars are the calendars of the text/calendar and application/ics
+	// parts of the email, in the order in which they appear. Calendars
+	// that are repeated, such as the ones of invitations that come both
+	// as an alternative to the text and as an attachment, are only
+	// included once.
+	Calendars []ics.Calendar
+	// Errors are the errors of the parts of the email that could not be
+	// read, such as calendars in an unsupported charset or that can not be
+	// parsed, which are skipped.
+	Errors []error
+}
+
+// Parse reads an email and parses the calendars it carries, which can be
+// in any of its parts, including the ones of forwarded emails. The method
+// of the calendars is the one in their METHOD property or, if they have
+// none, the one in the method parameter of the content type of their
+// part, and both must be the same. Parts that can not be read, decoded or
+// parsed are skipped, and their errors are kept in the Errors of the
+// message, so only an email that can not be read at all is an error.
+func Parse(r io.Reader) (*Message, error) {
+	m, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{Header: m.Header}
+	seen := make(map[string]bool)
+	msg.Errors = walk(textproto.MIMEHeader(m.Header), m.Body, func(data []byte, charset, method string) error {
+		content, err := decodeCharset(charset, data)
+		if err != nil {
+			return err
+		}
+
+		key := contentKey(content)
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+
+		cal, err := ics.ParseICalContent(content, "", 0)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case cal.Method == "":
+			cal.Method = method
+		case method != "" && cal.Method != method:
+			return fmt.Errorf("calendar with method %s in a part with method %s", cal.Method, method)
+		}
+
+		msg.Calendars = append(msg.Calendars, cal)
+		return nil
+	})
+
+	return msg, nil
+}
+
+// walk calls fn with the content, charset and method of every calendar in
+// the entity with the given header and body, and returns the errors of the
+// parts that could not be read and the ones returned by fn.
+func walk(header textproto.MIMEHeader, body io.Reader, fn func(content []byte, charset, method string) error) []error {
+	mediaType, params := "text/plain", map[string]string{}
+	if ct := header.Get("Content-Type"); ct != "" {
+		var err error
+		mediaType, params, err = mime.ParseMediaType(ct)
+		if err != nil {
+			return []error{fmt.Errorf("invalid content type %q: %s", ct, err)}
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		var errs []error
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := r.NextRawPart()
+			if err == io.EOF {
+				return errs
+			}
+			if err != nil {
+				return append(errs, err)
+			}
+
+			errs = append(errs, walk(part.Header, part, fn)...)
+		}
+	case mediaType == "message/rfc822":
+		m, err := mail.ReadMessage(body)
+		if err != nil {
+			return []error{err}
+		}
+		return walk(textproto.MIMEHeader(m.Header), m.Body, fn)
+	case mediaType == "text/calendar" || mediaType == "application/ics":
+		// only the parts with calendars are decoded, so the encodings of
+		// the rest do not matter
+		decoded, err := decodeTransfer(header.Get("Content-Transfer-Encoding"), body)
+		if err != nil {
+			return []error{err}
+		}
+
+		content, err := io.ReadAll(decoded)
+		if err != nil {
+			return []error{err}
+		}
+
+		if err := fn(content, params["charset"], strings.ToUpper(params["method"])); err != nil {
+			return []error{err}
+		}
+	}
+
+	return nil
+}
+
+func decodeTransfer(encoding string, body io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "7bit", "8bit", "binary":
+		return body, nil
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body), nil
+	case "quoted-printable":
+		return quotedprintable.NewReader(body), nil
+	}
+	return nil, fmt.Errorf("unsupported content transfer encoding %q", encoding)
+}
+
+func decodeCharset(charset string, content []byte) (string, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii":
+		if !utf8.Valid(content) {
+			return "", fmt.Errorf("calendar is not valid UTF-8")
+		}
+		return string(content), nil
+	case "iso-8859-1", "latin1":
+		return decodeSingleByte(content, nil), nil
+	case "iso-8859-15", "latin9", "latin-9":
+		return decodeSingleByte(content, latin9), nil
+	case "windows-1252", "cp1252":
+		return decodeSingleByte(content, windows1252), nil
+	}
+	return "", fmt.Errorf("unsupported charset %q", charset)
+}
+
+// decodeSingleByte decodes content in a charset with a single byte per
+// character, which are the same as in ISO-8859-1 except for the ones in
+// the given table.
+func decodeSingleByte(content []byte, table map[byte]rune) string {
+	runes := make([]rune, len(content))
+	for i, b := range content {
+		if r, ok := table[b]; ok {
+			runes[i] = r
+		} else {
+			runes[i] = rune(b)
+		}
+	}
+	return string(runes)
+}
+
+// latin9 are the characters of ISO-8859-15 that are not the ones of
+// ISO-8859-1.
+var latin9 = map[byte]rune{
+	0xa4: '€', 0xa6: 'Š', 0xa8: 'š', 0xb4: 'Ž',
+	0xb8: 'ž', 0xbc: 'Œ', 0xbd: 'œ', 0xbe: 'Ÿ',
+}
+
+// windows1252 are the characters of windows-1252 that are not the ones of
+// ISO-8859-1. The bytes that are not defined are decoded as the control
+// characters of ISO-8859-1.
+var windows1252 = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž',
+	0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+	0x98: '˜', 0x99: '™', 0x9a: 'š', 0x9b: '›', 0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+}
+
+// contentKey returns the content of a calendar without the differences in
+// line endings and folding that it can have in each part it is in.
+func contentKey(content string) string {
+	content = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(content)
+	content = strings.NewReplacer("\n ", "", "\n\t", "").Replace(content)
+	return strings.TrimSpace(content)
+}
+
+// Envelope is the data of an email other than the iTIP message it sends.
+type Envelope struct {
+	From    mail.Address
+	To      []mail.Address
+	Subject string
+	// Body is the text of the email, shown by the clients that do not
+	// understand the message.
+	Body string
+	// Filename is the name of the attachment with the message. It is
+	// invite.ics if empty.
+	Filename string
+}
+
+// Write writes an email with the iTIP message to the given writer. The
+// message is both an alternative to the text of the email, which clients
+// use to show the invitation, and an attachment, as most clients send it.
+func Write(w io.Writer, env Envelope, m *itip.Message) error {
+	var calendar bytes.Buffer
+	if _, err := m.WriteTo(&calendar); err != nil {
+		return err
+	}
+
+	to := make([]string, len(env.To))
+	for i, a := range env.To {
+		to[i] = a.String()
+	}
+
+	filename := env.Filename
+	if filename == "" {
+		filename = "invite.ics"
+	}
+
+	mixed := multipart.NewWriter(w)
+	header := []string{
+		"From: " + env.From.String(),
+		"To: " + strings.Join(to, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", env.Subject),
+		"Date: " + m.Stamp.Format(rfc5322Date),
+		"MIME-Version: 1.0",
+		"Content-Type: " + mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mixed.Boundary()}),
+	}
+	if _, err := io.WriteString(w, strings.Join(header, "\r\n")+"\r\n\r\n"); err != nil {
+		return err
+	}
+
+	alternative := multipart.NewWriter(nil)
+	part, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": alternative.Boundary()})},
+	})
+	if err != nil {
+		return err
+	}
+
+	boundary := alternative.Boundary()
+	alternative = multipart.NewWriter(part)
+	if err := alternative.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	part, err = alternative.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	if _, err := io.WriteString(qp, env.Body); err != nil {
+		return err
+	}
+	if err := qp.Close(); err != nil {
+		return err
+	}
+
+	err = writeBase64(alternative, textproto.MIMEHeader{
+		"Content-Type": {mime.FormatMediaType("text/calendar", map[string]string{"method": m.Method, "charset": "utf-8"})},
+	}, calendar.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if err := alternative.Close(); err != nil {
+		return err
+	}
+
+	err = writeBase64(mixed, textproto.MIMEHeader{
+		"Content-Type":        {mime.FormatMediaType("application/ics", map[string]string{"name": filename})},
+		"Content-Disposition": {mime.FormatMediaType("attachment", map[string]string{"filename": filename})},
+	}, calendar.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return mixed.Close()
+}
+
+// rfc5322Date is the format of the Date header of emails.
+const rfc5322Date = "Mon, 02 Jan 2006 15:04:05 -0700"
+
+// base64LineLength is the maximum length of the lines of base64 content.
+const base64LineLength = 76
+
+func writeBase64(w *multipart.Writer, header textproto.MIMEHeader, content []byte) error {
+	header.Set("Content-Transfer-Encoding", "base64")
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 0 {
+		n := min(base64LineLength, len(encoded))
+		if _, err := io.WriteString(part, encoded[:n]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package imip
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erizocosmico/go-ics"
+	"github.com/erizocosmico/go-ics/itip"
+)
+
+var testCalendar = strings.Join([]string{
+	"BEGIN:VCALENDAR",
+	"VERSION:2.0",
+	"PRODID:-//example.com//iCalendar 2.0//EN",
+	"METHOD:REQUEST",
+	"BEGIN:VEVENT",
+	"UID:meeting@example.com",
+	"DTSTAMP:20160701T120000Z",
+	"DTSTART:20160704T100000Z",
+	"DTEND:20160704T110000Z",
+	"SUMMARY:R\xe9union",
+	"ORGANIZER;CN=Alice:mailto:alice@example.com",
+	"ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:bob@example.com",
+	"END:VEVENT",
+	"END:VCALENDAR",
+	"",
+}, "\r\n")
+
+// testEmail is an invitation as sent by most clients, with the calendar
+// both as an alternative to the text and as an attachment.
+var testEmail = strings.Join([]string{
+	"From: Alice <alice@example.com>",
+	"To: bob@example.com",
+	"Subject: Invitation",
+	"MIME-Version: 1.0",
+	`Content-Type: multipart/mixed; boundary="mixed"`,
+	"",
+	"--mixed",
+	`Content-Type: multipart/alternative; boundary="alternative"`,
+	"",
+	"--alternative",
+	"Content-Type: text/plain; charset=utf-8",
+	"",
+	"You have been invited.",
+	"--alternative",
+	`Content-Type: text/calendar; method=REQUEST; charset="ISO-8859-1"`,
+	"Content-Transfer-Encoding: quoted-printable",
+	"",
+	strings.Replace(strings.Replace(strings.Replace(testCalendar, "=", "=3D", -1), "\xe9", "=E9", -1), "ORGANIZER;", "ORGANIZER;=\r\n", 1),
+	"--alternative--",
+	"--mixed",
+	`Content-Type: application/ics; name="invite.ics"; charset=latin1`,
+	"Content-Disposition: attachment; filename=invite.ics",
+	"Content-Transfer-Encoding: base64",
+	"",
+	base64.StdEncoding.EncodeToString([]byte(testCalendar)),
+	"--mixed--",
+	"",
+}, "\r\n")
+
+func TestParse(t *testing.T) {
+	msg, err := Parse(strings.NewReader(testEmail))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Header.Get("Subject") != "Invitation" {
+		t.Errorf("unexpected header %v", msg.Header)
+	}
+
+	if len(msg.Calendars) != 1 {
+		t.Fatalf("expected the calendar to be read once, got %d", len(msg.Calendars))
+	}
+
+	cal := msg.Calendars[0]
+	if cal.Method != itip.MethodRequest || len(cal.Events) != 1 {
+		t.Fatalf("unexpected calendar %+v", cal)
+	}
+
+	e := cal.Events[0]
+	if e.Summary != "Réunion" || e.Organizer.Email != "alice@example.com" || len(e.Attendees) != 1 {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	calendar := func(contentType, content string) string {
+		return "Content-Type: " + contentType + "\r\n\r\n" + content
+	}
+
+	for _, email := range []string{
+		calendar("text/calendar; method=CANCEL", strings.Replace(testCalendar, "\xe9", "e", 1)),
+		calendar("text/calendar; method=REQUEST", "BEGIN:VCALENDAR\r\n"),
+		calendar("text/calendar; charset", testCalendar),
+		"Content-Transfer-Encoding: x-uuencode\r\n" + calendar("text/calendar", testCalendar),
+	} {
+		msg, err := Parse(strings.NewReader(email))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(msg.Calendars) != 0 || len(msg.Errors) != 1 {
+			t.Errorf("expected the calendar of %q to be skipped with an error, got %+v and errors %v", email, msg.Calendars, msg.Errors)
+		}
+	}
+
+	if _, err := Parse(strings.NewReader("not an email")); err == nil {
+		t.Errorf("expected an error parsing something that is not an email")
+	}
+
+	// the parts that can not be read do not keep the rest from being read
+	email := strings.Join([]string{
+		`Content-Type: multipart/mixed; boundary="mixed"`,
+		"",
+		"--mixed",
+		"Content-Type: application/octet-stream",
+		"Content-Transfer-Encoding: x-uuencode",
+		"",
+		"begin 644 file",
+		"--mixed",
+		"Content-Type: image/png; name",
+		"",
+		"--mixed",
+		"Content-Type: text/calendar; method=CANCEL",
+		"",
+		strings.Replace(testCalendar, "\xe9", "e", 1),
+		"--mixed",
+		"Content-Type: text/calendar; charset=latin1",
+		"",
+		testCalendar,
+		"--mixed--",
+		"",
+	}, "\r\n")
+
+	msg, err := Parse(strings.NewReader(email))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msg.Calendars) != 1 || len(msg.Errors) != 2 {
+		t.Errorf("expected a calendar and 2 errors, got %+v and errors %v", msg.Calendars, msg.Errors)
+	}
+
+	msg, err = Parse(strings.NewReader(calendar("text/calendar; method=reply", strings.NewReplacer("METHOD:REQUEST\r\n", "", "\xe9", "e").Replace(testCalendar))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msg.Calendars) != 1 || msg.Calendars[0].Method != itip.MethodReply {
+		t.Errorf("expected method of the part to be used, got %+v", msg.Calendars)
+	}
+}
+
+func TestParseCharsets(t *testing.T) {
+	calendar := func(charset, summary string) string {
+		return "Content-Type: text/calendar; charset=" + charset + "\r\n\r\n" + strings.Replace(testCalendar, "R\xe9union", summary, 1)
+	}
+
+	cases := map[string]string{
+		calendar("windows-1252", "\x93R\xe9union\x94 \x80"): "“Réunion” €",
+		calendar("ISO-8859-15", "R\xe9union \xa4"):          "Réunion €",
+		calendar("latin1", "R\xe9union \xa4"):               "Réunion ¤",
+	}
+
+	for email, expected := range cases {
+		msg, err := Parse(strings.NewReader(email))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(msg.Calendars) != 1 || msg.Calendars[0].Events[0].Summary != expected {
+			t.Errorf("expected summary %q, got %+v", expected, msg.Calendars)
+		}
+	}
+
+	// parts that can not be decoded are skipped
+	for _, email := range []string{
+		calendar("koi8-r", "R\xe9union"),
+		calendar("utf-8", "R\xe9union"),
+	} {
+		msg, err := Parse(strings.NewReader(email))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(msg.Calendars) != 0 || len(msg.Errors) != 1 {
+			t.Errorf("expected the calendar to be skipped, got %+v and errors %v", msg.Calendars, msg.Errors)
+		}
+	}
+}
+
+func TestParseRepeatedCalendar(t *testing.T) {
+	// the attachment has other line endings and is folded in another way
+	attachment := strings.Replace(strings.Replace(testCalendar, "\r\n", "\n", -1), "ORGANIZER;", "ORGANIZER;\n ", 1)
+	email := strings.Join([]string{
+		`Content-Type: multipart/mixed; boundary="mixed"`,
+		"",
+		"--mixed",
+		"Content-Type: text/calendar; method=REQUEST; charset=latin1",
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		strings.Replace(strings.Replace(testCalendar, "=", "=3D", -1), "\xe9", "=E9", -1),
+		"--mixed",
+		"Content-Type: application/ics; charset=latin1",
+		"Content-Transfer-Encoding: base64",
+		"",
+		base64.StdEncoding.EncodeToString([]byte(attachment)),
+		"--mixed--",
+		"",
+	}, "\r\n")
+
+	msg, err := Parse(strings.NewReader(email))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msg.Calendars) != 1 {
+		t.Errorf("expected the calendar to be read once, got %d", len(msg.Calendars))
+	}
+}
+
+func TestWrite(t *testing.T) {
+	e := ics.NewEvent()
+	e.ID = "meeting@example.com"
+	e.Summary = "Réunion"
+	e.Start = time.Date(2016, time.July, 4, 10, 0, 0, 0, time.UTC)
+	e.End = e.Start.Add(time.Hour)
+	e.Organizer = ics.Attendee{Name: "Alice", Email: "alice@example.com"}
+	e.Attendees = []ics.Attendee{{Email: "bob@example.com", Status: itip.NeedsAction}}
+
+	m, err := itip.Request(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = Write(&buf, Envelope{
+		From:    mail.Address{Name: "Alice", Address: "alice@example.com"},
+		To:      []mail.Address{{Address: "bob@example.com"}},
+		Subject: "Invitation: Réunion",
+		Body:    "Alice has invited you to Réunion.",
+	}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, expected := range []string{
+		"From: \"Alice\" <alice@example.com>\r\n",
+		"To: <bob@example.com>\r\n",
+		"Subject: =?utf-8?q?Invitation:_R=C3=A9union?=\r\n",
+		"Content-Type: text/calendar; charset=utf-8; method=REQUEST\r\n",
+		"Content-Disposition: attachment; filename=invite.ics\r\n",
+		"Alice has invited you to R=C3=A9union.",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain %q:\n%s", expected, out)
+		}
+	}
+
+	msg, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msg.Calendars) != 1 {
+		t.Fatalf("expected the calendar to be read once, got %d", len(msg.Calendars))
+	}
+
+	cal := msg.Calendars[0]
+	if cal.Method != itip.MethodRequest || len(cal.Events) != 1 || cal.Events[0].Summary != "Réunion" {
+		t.Errorf("unexpected calendar %+v", cal)
+	}
+
+	if msg.Header.Get("Subject") != "=?utf-8?q?Invitation:_R=C3=A9union?=" {
+		t.Errorf("unexpected subject %q", msg.Header.Get("Subject"))
+	}
+}
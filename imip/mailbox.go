@@ -0,0 +1,318 @@
+package imip
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erizocosmico/go-ics"
+	"github.com/erizocosmico/go-ics/itip"
+)
+
+// Source is the email an event comes from.
+type Source struct {
+	// Path is the mbox file or the Maildir file of the email.
+	Path string
+	// Offset is the offset of the email in its mbox file.
+	Offset    int64
+	MessageID string
+	From      string
+	Subject   string
+	Date      time.Time
+}
+
+// Entry is a version of an event sent in an iTIP message, such as an
+// invitation or a reply to it.
+type Entry struct {
+	Method string
+	Event  ics.Event
+	Source Source
+}
+
+// Timeline is the history of the events sent in the emails of some
+// mailboxes. The same message is only included once, even if it is in
+// several emails, such as the copies of an invitation in the mailboxes of
+// the organizer and the attendees.
+type Timeline struct {
+	// Entries are ordered by the UID of their event, then by its SEQUENCE
+	// and then by the time it was sent.
+	Entries []Entry
+	// Errors are the errors of the emails, or of their calendars, that
+	// could not be read.
+	Errors []error
+	seen   map[string]bool
+}
+
+// NewTimeline returns a new empty timeline.
+func NewTimeline() *Timeline {
+	return &Timeline{seen: make(map[string]bool)}
+}
+
+// Add adds the events of the calendars of the email to the timeline.
+func (t *Timeline) Add(msg *Message, src Source) {
+	t.add(msg, src)
+	t.sort()
+}
+
+func (t *Timeline) add(msg *Message, src Source) {
+	if t.seen == nil {
+		t.seen = make(map[string]bool)
+	}
+
+	for _, cal := range msg.Calendars {
+		for _, e := range cal.Events {
+			key := entryKey(cal.Method, &e)
+			if t.seen[key] {
+				continue
+			}
+			t.seen[key] = true
+			t.Entries = append(t.Entries, Entry{Method: cal.Method, Event: e, Source: src})
+		}
+	}
+}
+
+func (t *Timeline) sort() {
+	sort.SliceStable(t.Entries, func(i, j int) bool {
+		a, b := &t.Entries[i].Event, &t.Entries[j].Event
+		switch {
+		case a.ID != b.ID:
+			return a.ID < b.ID
+		case a.Sequence != b.Sequence:
+			return a.Sequence < b.Sequence
+		case !itip.StampOf(a).Equal(itip.StampOf(b)):
+			return itip.StampOf(a).Before(itip.StampOf(b))
+		}
+		return t.Entries[i].Source.Date.Before(t.Entries[j].Source.Date)
+	})
+}
+
+// entryKey returns a key that is the same for the events of the same
+// message.
+func entryKey(method string, e *ics.Event) string {
+	parts := []string{
+		method,
+		e.ID,
+		e.RecurrenceID.UTC().Format(time.RFC3339),
+		strconv.Itoa(e.Sequence),
+		itip.StampOf(e).UTC().Format(time.RFC3339),
+	}
+	for _, a := range e.Attendees {
+		parts = append(parts, strings.ToLower(a.Email)+"="+a.Status)
+	}
+	return strings.Join(parts, "|")
+}
+
+// History returns the entries of the event with the given UID.
+func (t *Timeline) History(uid string) []Entry {
+	i := sort.Search(len(t.Entries), func(i int) bool { return t.Entries[i].Event.ID >= uid })
+	j := i
+	for j < len(t.Entries) && t.Entries[j].Event.ID == uid {
+		j++
+	}
+	return t.Entries[i:j]
+}
+
+// Calendar returns the calendar with the last version of every event, with
+// the messages applied in the order of the timeline, and the sources of the
+// messages that last changed each of its events, in the same order.
+// Messages that cannot be applied, such as replies to events whose
+// invitation is not in the timeline, are left out.
+func (t *Timeline) Calendar() (*ics.Calendar, []Source) {
+	cal := ics.NewCalendar()
+	var sources []Source
+	for i := 0; i < len(t.Entries); {
+		uid := t.Entries[i].Event.ID
+		entries := t.History(uid)
+		i += len(entries)
+
+		// the messages of every event are applied on their own, so the
+		// calendar they are applied to is small
+		events := ics.NewCalendar()
+		processor := itip.NewProcessor()
+		changedBy := make(map[time.Time]Source)
+		for _, e := range entries {
+			msg := &ics.Calendar{Method: e.Method, Events: []ics.Event{e.Event}}
+			if e.Method == itip.MethodPublish {
+				msg.Method = itip.MethodRequest
+			}
+
+			updated, changes, err := processor.Process(&events, msg)
+			if err != nil {
+				continue
+			}
+			events = *updated
+
+			for _, c := range changes {
+				switch {
+				case c.Kind == itip.ChangeCancelled && c.RecurrenceID.IsZero():
+					// the overrides of the event are cancelled with it
+					for _, event := range events.Events {
+						changedBy[event.RecurrenceID.UTC()] = e.Source
+					}
+				case c.Kind == itip.ChangeCancelled:
+					// the cancelled occurrence is excluded from the event
+					changedBy[time.Time{}] = e.Source
+				default:
+					changedBy[c.RecurrenceID.UTC()] = e.Source
+				}
+			}
+		}
+
+		for _, event := range events.Events {
+			sources = append(sources, changedBy[event.RecurrenceID.UTC()])
+		}
+		cal.Events = append(cal.Events, events.Events...)
+	}
+	return &cal, sources
+}
+
+// ScanMbox adds the events of the emails of the mbox file at the given
+// path to the timeline.
+func (t *Timeline) ScanMbox(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = readMbox(f, func(offset int64, email []byte) {
+		if err := t.addEmail(bytes.NewReader(email), Source{Path: path, Offset: offset}); err != nil {
+			t.Errors = append(t.Errors, fmt.Errorf("%s at offset %d: %s", path, offset, err))
+		}
+	})
+	t.sort()
+	return err
+}
+
+// readMbox calls fn with the offset and the content of every email of the
+// mbox file. The lines of the emails that start with From and were quoted
+// with > are unquoted.
+func readMbox(r io.Reader, fn func(offset int64, email []byte)) error {
+	br := bufio.NewReader(r)
+	var email bytes.Buffer
+	var offset, start int64 = 0, -1
+	blank := true
+	for {
+		line, err := br.ReadBytes('\n')
+		if n := len(line); n > 0 {
+			switch {
+			case blank && bytes.HasPrefix(line, []byte("From ")):
+				if start >= 0 {
+					fn(start, email.Bytes())
+				}
+				email = bytes.Buffer{}
+				start = offset
+			case start >= 0:
+				if quoted := bytes.TrimLeft(line, ">"); len(quoted) < len(line) && bytes.HasPrefix(quoted, []byte("From ")) {
+					line = line[1:]
+				}
+				email.Write(line)
+			}
+			// the offset counts the quotes that were removed
+			offset += int64(n)
+			blank = len(bytes.TrimRight(line, "\r\n")) == 0
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if start >= 0 {
+		fn(start, email.Bytes())
+	}
+	return nil
+}
+
+// ScanMaildir adds the events of the emails of the Maildir directory at
+// the given path, and the ones of its folders, to the timeline.
+func (t *Timeline) ScanMaildir(dir string) error {
+	err := t.scanMaildir(dir)
+	t.sort()
+	return err
+}
+
+func (t *Timeline) scanMaildir(dir string) error {
+	for _, sub := range []string{"cur", "new"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+
+			path := filepath.Join(dir, sub, e.Name())
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			if err := t.addEmail(f, Source{Path: path}); err != nil {
+				t.Errors = append(t.Errors, fmt.Errorf("%s: %s", path, err))
+			}
+			f.Close()
+		}
+	}
+
+	// folders of Maildir++ mailboxes are directories that start with a dot
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), ".") && e.Name() != "." && e.Name() != ".." {
+			if err := t.scanMaildir(filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Scan adds the events of the mailbox at the given path to the timeline,
+// which is a Maildir if it is a directory and an mbox file otherwise.
+func (t *Timeline) Scan(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return t.ScanMaildir(path)
+	}
+	return t.ScanMbox(path)
+}
+
+func (t *Timeline) addEmail(r io.Reader, src Source) error {
+	msg, err := Parse(r)
+	if err != nil {
+		return err
+	}
+
+	src.MessageID = msg.Header.Get("Message-Id")
+	src.From = msg.Header.Get("From")
+	src.Subject = msg.Header.Get("Subject")
+	if subject, err := new(mime.WordDecoder).DecodeHeader(src.Subject); err == nil {
+		src.Subject = subject
+	}
+	src.Date, _ = msg.Header.Date()
+	t.add(msg, src)
+
+	// the calendars that could be read are added even if others could not
+	return errors.Join(msg.Errors...)
+}
@@ -0,0 +1,206 @@
+package imip
+
+import (
+	"bytes"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erizocosmico/go-ics"
+	"github.com/erizocosmico/go-ics/itip"
+)
+
+// testEmails returns the emails of an invitation, the reply of an
+// attendee to it and the invitation after the event was moved.
+func testEmails(t *testing.T) []string {
+	t.Helper()
+	e := ics.NewEvent()
+	e.ID = "meeting@example.com"
+	e.Summary = "Meeting"
+	e.Start = time.Date(2016, time.July, 4, 10, 0, 0, 0, time.UTC)
+	e.End = e.Start.Add(time.Hour)
+	e.Organizer = ics.Attendee{Name: "Alice", Email: "alice@example.com"}
+	e.Attendees = []ics.Attendee{{Email: "bob@example.com", Status: itip.NeedsAction}}
+
+	moved := *e
+	moved.Start = moved.Start.Add(24 * time.Hour)
+	moved.End = moved.End.Add(24 * time.Hour)
+	itip.Revise(e, &moved)
+
+	request, err := itip.Request(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := itip.Reply(e, e.Attendees[0], itip.Accepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update, err := itip.Request(&moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := mail.Address{Name: "Alice", Address: "alice@example.com"}
+	bob := mail.Address{Address: "bob@example.com"}
+	var emails []string
+	for i, m := range []struct {
+		from, to mail.Address
+		msg      *itip.Message
+	}{
+		{alice, bob, request},
+		{bob, alice, reply},
+		{alice, bob, update},
+	} {
+		m.msg.Stamp = time.Date(2016, time.July, 1, 12+i, 0, 0, 0, time.UTC)
+		var buf bytes.Buffer
+		env := Envelope{From: m.from, To: []mail.Address{m.to}, Subject: "Meeting", Body: "From the organizer"}
+		if err := Write(&buf, env, m.msg); err != nil {
+			t.Fatal(err)
+		}
+		emails = append(emails, buf.String())
+	}
+	return emails
+}
+
+func writeMbox(t *testing.T, emails ...string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, e := range emails {
+		buf.WriteString("From someone@example.com Fri Jul  1 12:00:00 2016\n")
+		// quote the lines that could be taken as the start of an email
+		buf.WriteString(strings.Replace(e, "\nFrom ", "\n>From ", -1))
+		buf.WriteString("\n")
+	}
+
+	path := filepath.Join(t.TempDir(), "mbox")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestScanMbox(t *testing.T) {
+	emails := testEmails(t)
+	// the invitation is in the mailbox twice and an email is broken
+	path := writeMbox(t, emails[2], emails[0], emails[1], emails[0], "Content-Type: text/calendar\n\nBEGIN:VCALENDAR\n")
+
+	tl := NewTimeline()
+	if err := tl.Scan(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tl.Errors) != 1 || !strings.Contains(tl.Errors[0].Error(), path+" at offset ") {
+		t.Errorf("expected an error for the broken email, got %v", tl.Errors)
+	}
+
+	if len(tl.Entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(tl.Entries))
+	}
+
+	for i, method := range []string{itip.MethodRequest, itip.MethodReply, itip.MethodRequest} {
+		if tl.Entries[i].Method != method {
+			t.Errorf("expected entry %d to be a %s, got %s", i, method, tl.Entries[i].Method)
+		}
+	}
+
+	src := tl.Entries[0].Source
+	if src.Path != path || src.Offset == 0 || src.From != `"Alice" <alice@example.com>` || src.Subject != "Meeting" || src.Date.IsZero() {
+		t.Errorf("unexpected source %+v", src)
+	}
+
+	if tl.Entries[1].Source.From != "<bob@example.com>" || tl.Entries[2].Event.Sequence != 1 {
+		t.Errorf("unexpected entries %+v", tl.Entries[1:])
+	}
+
+	if len(tl.History("meeting@example.com")) != 3 || len(tl.History("other@example.com")) != 0 {
+		t.Errorf("unexpected history")
+	}
+
+	cal, sources := tl.Calendar()
+	if len(cal.Events) != 1 || len(sources) != 1 {
+		t.Fatalf("expected 1 event, got %d and sources %+v", len(cal.Events), sources)
+	}
+
+	if sources[0] != tl.Entries[2].Source {
+		t.Errorf("expected the source of the last request, got %+v", sources[0])
+	}
+
+	// the reply is to the previous version of the event
+	e := cal.Events[0]
+	if e.Sequence != 1 || e.Start.Day() != 5 || e.Attendees[0].Status != itip.NeedsAction {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func TestReadMbox(t *testing.T) {
+	second := "From bob@example.com Fri Jul  1 13:00:00 2016\nSubject: Second\n\nHi\n"
+	content := "From alice@example.com Fri Jul  1 12:00:00 2016\nSubject: First\n\n>From the organizer\n\n" + second
+
+	var offsets []int64
+	var emails []string
+	err := readMbox(strings.NewReader(content), func(offset int64, email []byte) {
+		offsets = append(offsets, offset)
+		emails = append(emails, string(email))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the quote of the first email is not in its content, but it is in the
+	// offset of the second one
+	expected := int64(len(content) - len(second))
+	if len(offsets) != 2 || offsets[0] != 0 || offsets[1] != expected {
+		t.Errorf("expected offsets 0 and %d, got %v", expected, offsets)
+	}
+
+	if len(emails) != 2 || !strings.Contains(emails[0], "\nFrom the organizer\n") {
+		t.Errorf("expected the line of the first email to be unquoted, got %q", emails)
+	}
+}
+
+func TestScanMaildir(t *testing.T) {
+	emails := testEmails(t)
+	dir := t.TempDir()
+	for path, email := range map[string]string{
+		"cur/1.example:2,S":       emails[0],
+		"new/2.example":           emails[1],
+		".Sent/cur/3.example:2,S": emails[0],
+		"tmp/4.example":           emails[2],
+	} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(email), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tl := NewTimeline()
+	if err := tl.Scan(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tl.Entries) != 2 || len(tl.Errors) != 0 {
+		t.Fatalf("expected 2 entries, got %d and errors %v", len(tl.Entries), tl.Errors)
+	}
+
+	if tl.Entries[0].Source.Path != filepath.Join(dir, "cur/1.example:2,S") {
+		t.Errorf("unexpected source %+v", tl.Entries[0].Source)
+	}
+
+	cal, sources := tl.Calendar()
+	e := cal.Events[0]
+	if e.Sequence != 0 || e.Attendees[0].Status != itip.Accepted {
+		t.Errorf("expected reply to be applied, got %+v", e)
+	}
+
+	if sources[0] != tl.Entries[1].Source {
+		t.Errorf("expected the source of the reply, got %+v", sources[0])
+	}
+}
@@ -0,0 +1,476 @@
+// Package itip implements the iCalendar Transport-Independent
+// Interoperability Protocol (iTIP), as defined in RFC 5546, to schedule
+// events between an organizer and its attendees.
+//
+// The organizer invites the attendees to an event with a REQUEST message,
+// and the attendees reply to it with a REPLY message:
+//
+//	msg, err := itip.Request(event)
+//	if err != nil {
+//		// handle error
+//	}
+//
+//	_, err = msg.WriteTo(w)
+//
+// Messages can be about a whole event or a single occurrence of a
+// repeating event, which is returned by Instance.
+//
+// Messages are stamped with the time they are built at. A Builder with a
+// clock of its own builds them with a different one:
+//
+//	b := itip.NewBuilder()
+//	b.SetClock(clock)
+//	msg, err := b.Request(event)
+package itip
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/erizocosmico/go-ics"
+)
+
+// Methods of the iTIP messages.
+const (
+	MethodPublish        = "PUBLISH"
+	MethodRequest        = "REQUEST"
+	MethodReply          = "REPLY"
+	MethodAdd            = "ADD"
+	MethodCancel         = "CANCEL"
+	MethodRefresh        = "REFRESH"
+	MethodCounter        = "COUNTER"
+	MethodDeclineCounter = "DECLINECOUNTER"
+)
+
+// Participation statuses of the attendees.
+const (
+	NeedsAction = "NEEDS-ACTION"
+	Accepted    = "ACCEPTED"
+	Declined    = "DECLINED"
+	Tentative   = "TENTATIVE"
+	Delegated   = "DELEGATED"
+)
+
+// stampFormat is the format of DTSTAMP values.
+const stampFormat = "20060102T150405Z"
+
+// Builder builds the iTIP messages of events, stamping them with the
+// current time of its clock.
+type Builder struct {
+	now func() time.Time
+}
+
+// NewBuilder returns a new Builder of messages.
+func NewBuilder() *Builder {
+	return &Builder{now: time.Now}
+}
+
+// SetClock sets the function the builder uses to tell the current time,
+// which is the DTSTAMP of the messages it builds. By default it is
+// time.Now.
+func (b *Builder) SetClock(now func() time.Time) {
+	b.now = now
+}
+
+// Message is an iTIP message, with the events it is about.
+type Message struct {
+	Method string
+	// Stamp is the time the message was created, which is the DTSTAMP of
+	// all of its events.
+	Stamp  time.Time
+	Events []ics.Event
+}
+
+// Calendar returns the calendar of the message, with its method and its
+// events.
+func (m *Message) Calendar() *ics.Calendar {
+	cal := ics.NewCalendar()
+	cal.Method = m.Method
+	cal.Events = m.Events
+	return &cal
+}
+
+// Component returns the VCALENDAR component of the message. Its events
+// only have the properties the method of the message allows, and there is
+// a VTIMEZONE for every TZID they refer to.
+func (m *Message) Component() *ics.Component {
+	c := m.Calendar().ToComponent()
+	for _, child := range c.ChildrenNamed("VEVENT") {
+		child.Set(&ics.Property{Name: "DTSTAMP", Value: m.Stamp.UTC().Format(stampFormat)})
+		if allowed, ok := allowedProperties[m.Method]; ok {
+			for _, p := range append([]*ics.Property(nil), child.Properties...) {
+				if !allowed[p.Name] {
+					child.Del(p.Name)
+				}
+			}
+		}
+	}
+	return c
+}
+
+// WriteTo writes the message as an ics file to the given writer.
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := ics.NewEncoder(cw).EncodeComponent(m.Component())
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// allowedProperties are the only properties the events of the messages of
+// some methods can have. The events of the rest of methods can have any
+// property.
+var allowedProperties = map[string]map[string]bool{
+	MethodReply: set(
+		"UID", "DTSTAMP", "SEQUENCE", "RECURRENCE-ID", "DTSTART", "DTEND",
+		"SUMMARY", "ORGANIZER", "ATTENDEE", "COMMENT", "REQUEST-STATUS",
+	),
+	MethodRefresh: set(
+		"UID", "DTSTAMP", "RECURRENCE-ID", "ORGANIZER", "ATTENDEE", "COMMENT",
+	),
+	MethodDeclineCounter: set(
+		"UID", "DTSTAMP", "SEQUENCE", "RECURRENCE-ID", "ORGANIZER", "ATTENDEE",
+		"COMMENT", "REQUEST-STATUS",
+	),
+	MethodCancel: set(
+		"UID", "DTSTAMP", "SEQUENCE", "RECURRENCE-ID", "DTSTART", "DTEND",
+		"SUMMARY", "STATUS", "ORGANIZER", "ATTENDEE", "COMMENT", "RRULE",
+		"RDATE", "EXDATE",
+	),
+}
+
+func set(names ...string) map[string]bool {
+	m := make(map[string]bool, len(names))
+	for _, n := range names {
+		m[n] = true
+	}
+	return m
+}
+
+// Instance returns the occurrence of the repeating event that originally
+// starts at recurrenceID as an event of its own, with the same ID and the
+// start as RecurrenceID, which can be used to send messages about that
+// occurrence only.
+func Instance(e *ics.Event, recurrenceID time.Time) *ics.Event {
+	instance := clone(e)
+	instance.Start = recurrenceID
+	instance.End = recurrenceID.Add(e.End.Sub(e.Start))
+	instance.RecurrenceID = recurrenceID
+	instance.ThisAndFuture = false
+	instance.RRule = ""
+	instance.RDates = nil
+	instance.ExDates = nil
+	return instance
+}
+
+// Revise updates the sequence of the current version of an event given the
+// previous one, which is needed before sending a REQUEST with the changes.
+// If the event has been rescheduled, because its start, end, recurrence or
+// status changed, its sequence is increased and the participation status
+// of all the attendees is reset to NEEDS-ACTION, as they need to reply to
+// it again. It reports whether the event was rescheduled.
+func Revise(previous, current *ics.Event) bool {
+	if current.Sequence < previous.Sequence {
+		current.Sequence = previous.Sequence
+	}
+
+	if !rescheduled(previous, current) {
+		return false
+	}
+
+	current.Sequence = previous.Sequence + 1
+	attendees := make([]ics.Attendee, len(current.Attendees))
+	for i, a := range current.Attendees {
+		if a.Status != "" {
+			a.Status = NeedsAction
+		}
+		attendees[i] = a
+	}
+	current.Attendees = attendees
+	return true
+}
+
+func rescheduled(previous, current *ics.Event) bool {
+	return !previous.Start.Equal(current.Start) ||
+		!previous.End.Equal(current.End) ||
+		previous.RRule != current.RRule ||
+		!equalTimes(previous.RDates, current.RDates) ||
+		!equalTimes(previous.ExDates, current.ExDates) ||
+		!strings.EqualFold(previous.Status, current.Status)
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Publish returns a PUBLISH message of the event stamped with the current
+// time. See Builder.Publish.
+func Publish(e *ics.Event) (*Message, error) {
+	return NewBuilder().Publish(e)
+}
+
+// Request returns a REQUEST message of the event stamped with the current
+// time. See Builder.Request.
+func Request(e *ics.Event) (*Message, error) {
+	return NewBuilder().Request(e)
+}
+
+// Add returns an ADD message of the event stamped with the current
+// time. See Builder.Add.
+func Add(e *ics.Event) (*Message, error) {
+	return NewBuilder().Add(e)
+}
+
+// Cancel returns a CANCEL message of the event stamped with the current
+// time. See Builder.Cancel.
+func Cancel(e *ics.Event, attendees ...ics.Attendee) (*Message, error) {
+	return NewBuilder().Cancel(e, attendees...)
+}
+
+// Reply returns a REPLY message of the event stamped with the current
+// time. See Builder.Reply.
+func Reply(e *ics.Event, attendee ics.Attendee, status string) (*Message, error) {
+	return NewBuilder().Reply(e, attendee, status)
+}
+
+// Refresh returns a REFRESH message of the event stamped with the current
+// time. See Builder.Refresh.
+func Refresh(e *ics.Event, attendee ics.Attendee) (*Message, error) {
+	return NewBuilder().Refresh(e, attendee)
+}
+
+// Counter returns a COUNTER message of the event stamped with the current
+// time. See Builder.Counter.
+func Counter(proposal *ics.Event, attendee ics.Attendee) (*Message, error) {
+	return NewBuilder().Counter(proposal, attendee)
+}
+
+// DeclineCounter returns a DECLINECOUNTER message of the event stamped with the current
+// time. See Builder.DeclineCounter.
+func DeclineCounter(counter *ics.Event, attendee ics.Attendee) (*Message, error) {
+	return NewBuilder().DeclineCounter(counter, attendee)
+}
+
+// Publish returns a PUBLISH message of the event, which only informs about
+// it and does not expect any reply.
+func (b *Builder) Publish(e *ics.Event) (*Message, error) {
+	if err := requireEvent(MethodPublish, e, true); err != nil {
+		return nil, err
+	}
+
+	return b.message(MethodPublish, clone(e)), nil
+}
+
+// Request returns a REQUEST message, sent by the organizer of the event to
+// its attendees to invite them to it or to update it. Revise needs to be
+// called first with updated events so their sequence is the right one.
+func (b *Builder) Request(e *ics.Event) (*Message, error) {
+	if err := requireAttendees(MethodRequest, e); err != nil {
+		return nil, err
+	}
+
+	return b.message(MethodRequest, clone(e)), nil
+}
+
+// Add returns an ADD message, sent by the organizer of a repeating event to
+// its attendees to add new instances to it. The event contains the new
+// instances, with the ID of the repeating event and its current sequence,
+// so it can not have a recurrence ID.
+func (b *Builder) Add(e *ics.Event) (*Message, error) {
+	if err := requireAttendees(MethodAdd, e); err != nil {
+		return nil, err
+	}
+
+	if !e.RecurrenceID.IsZero() {
+		return nil, fmt.Errorf("%s can not have a recurrence ID", MethodAdd)
+	}
+
+	return b.message(MethodAdd, clone(e)), nil
+}
+
+// Cancel returns a CANCEL message, sent by the organizer of the event to
+// cancel it or one of its occurrences, if it has a recurrence ID. If some
+// attendees are given, the message is sent to them only, to remove them
+// from the event, instead of cancelling it for everyone. The sequence of
+// the event in the message is the next one, which the organizer needs to
+// keep for the event from then on.
+func (b *Builder) Cancel(e *ics.Event, attendees ...ics.Attendee) (*Message, error) {
+	if err := requireAttendees(MethodCancel, e); err != nil {
+		return nil, err
+	}
+
+	event := clone(e)
+	event.Sequence++
+	if len(attendees) > 0 {
+		event.Attendees = append([]ics.Attendee(nil), attendees...)
+	} else {
+		event.Status = "CANCELLED"
+	}
+
+	return b.message(MethodCancel, event), nil
+}
+
+// Reply returns a REPLY message, sent by an attendee of the event to its
+// organizer with their participation status, which is one of ACCEPTED,
+// DECLINED, TENTATIVE or DELEGATED. It only contains that attendee.
+func (b *Builder) Reply(e *ics.Event, attendee ics.Attendee, status string) (*Message, error) {
+	if err := requireEvent(MethodReply, e, false); err != nil {
+		return nil, err
+	}
+
+	switch status = strings.ToUpper(status); status {
+	case Accepted, Declined, Tentative, Delegated:
+	default:
+		return nil, fmt.Errorf("invalid participation status %q in %s", status, MethodReply)
+	}
+
+	if attendee.Email == "" {
+		return nil, fmt.Errorf("%s without attendee", MethodReply)
+	}
+
+	event := clone(e)
+	attendee.Status = status
+	event.Attendees = []ics.Attendee{attendee}
+	return b.message(MethodReply, event), nil
+}
+
+// Refresh returns a REFRESH message, sent by an attendee of the event to
+// its organizer to ask for its latest version.
+func (b *Builder) Refresh(e *ics.Event, attendee ics.Attendee) (*Message, error) {
+	if err := requireEvent(MethodRefresh, e, false); err != nil {
+		return nil, err
+	}
+
+	if attendee.Email == "" {
+		return nil, fmt.Errorf("%s without attendee", MethodRefresh)
+	}
+
+	event := clone(e)
+	event.Attendees = []ics.Attendee{attendee}
+	return b.message(MethodRefresh, event), nil
+}
+
+// Counter returns a COUNTER message, sent by an attendee of the event to
+// its organizer to propose changes to it. The proposal is the event with
+// the changes, which keeps the sequence of the event it changes. The
+// attendee is added to the attendees of the proposal if they are not
+// already in it.
+func (b *Builder) Counter(proposal *ics.Event, attendee ics.Attendee) (*Message, error) {
+	if err := requireEvent(MethodCounter, proposal, true); err != nil {
+		return nil, err
+	}
+
+	if attendee.Email == "" {
+		return nil, fmt.Errorf("%s without attendee", MethodCounter)
+	}
+
+	event := clone(proposal)
+	found := false
+	for _, a := range event.Attendees {
+		found = found || strings.EqualFold(a.Email, attendee.Email)
+	}
+
+	if !found {
+		event.Attendees = append(event.Attendees, attendee)
+	}
+
+	return b.message(MethodCounter, event), nil
+}
+
+// DeclineCounter returns a DECLINECOUNTER message, sent by the organizer
+// of the event to the attendee that sent a COUNTER to reject its proposal.
+// The counter is the event of the COUNTER message.
+func (b *Builder) DeclineCounter(counter *ics.Event, attendee ics.Attendee) (*Message, error) {
+	if err := requireEvent(MethodDeclineCounter, counter, false); err != nil {
+		return nil, err
+	}
+
+	if attendee.Email == "" {
+		return nil, fmt.Errorf("%s without attendee", MethodDeclineCounter)
+	}
+
+	event := clone(counter)
+	event.Attendees = []ics.Attendee{attendee}
+	return b.message(MethodDeclineCounter, event), nil
+}
+
+// requireEvent returns an error if the event does not have the properties
+// all messages of the given method need: an ID and an organizer, and a
+// start if start is true.
+func requireEvent(method string, e *ics.Event, start bool) error {
+	if e.ID == "" {
+		return fmt.Errorf("%s of an event without UID", method)
+	}
+
+	if e.Organizer.Email == "" {
+		return fmt.Errorf("%s of an event without organizer", method)
+	}
+
+	if start && e.Start.IsZero() {
+		return fmt.Errorf("%s of an event without start", method)
+	}
+
+	return nil
+}
+
+// requireAttendees returns an error if the event does not have what the
+// messages of the given method, sent by the organizer to the attendees,
+// need: the properties all events need, a start and at least an attendee.
+func requireAttendees(method string, e *ics.Event) error {
+	if err := requireEvent(method, e, true); err != nil {
+		return err
+	}
+
+	if len(e.Attendees) == 0 {
+		return fmt.Errorf("%s of an event without attendees", method)
+	}
+
+	return nil
+}
+
+// clone returns a copy of the event that can be modified without changing
+// the original one. Alarms and the stamps of the last replies of the
+// attendees are only meaningful to the calendar of the event, so they are
+// never sent.
+func clone(e *ics.Event) *ics.Event {
+	event := e.Clone()
+	event.Attendees = append([]ics.Attendee(nil), e.Attendees...)
+	for i := range event.Attendees {
+		a := &event.Attendees[i]
+		if a.Params.Get(ReplyStampParam) != "" {
+			a.Params = append(ics.Params(nil), a.Params...)
+			a.Params.Del(ReplyStampParam)
+		}
+	}
+	event.Alarms = nil
+	event.Component = nil
+	return event
+}
+
+func (b *Builder) message(method string, events ...*ics.Event) *Message {
+	m := &Message{Method: method, Stamp: b.now().UTC()}
+	for _, e := range events {
+		m.Events = append(m.Events, *e)
+	}
+	return m
+}
@@ -0,0 +1,352 @@
+package itip
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erizocosmico/go-ics"
+)
+
+func testEvent() *ics.Event {
+	e := ics.NewEvent()
+	e.ID = "meeting@example.com"
+	e.Summary = "Weekly meeting"
+	e.Description = "Agenda to be defined"
+	e.Start = time.Date(2016, time.July, 4, 10, 0, 0, 0, time.UTC)
+	e.End = time.Date(2016, time.July, 4, 11, 0, 0, 0, time.UTC)
+	e.RRule = "FREQ=WEEKLY;COUNT=4"
+	e.Sequence = 1
+	e.Organizer = ics.Attendee{Name: "Alice", Email: "alice@example.com"}
+	e.Attendees = []ics.Attendee{
+		{Name: "Bob", Email: "bob@example.com", Status: Accepted, Role: "REQ-PARTICIPANT"},
+		{Name: "Carol", Email: "carol@example.com", Status: NeedsAction, Role: "OPT-PARTICIPANT"},
+	}
+	e.Alarms = []ics.Alarm{{Action: ics.AlarmDisplay, Trigger: -15 * time.Minute}}
+	return e
+}
+
+// encode returns the message as an ics file, with its lines unfolded.
+func encode(t *testing.T, m *Message) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Replace(buf.String(), "\r\n ", "", -1)
+}
+
+func assertContains(t *testing.T, out string, expected ...string) {
+	t.Helper()
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("expected output to contain %q:\n%s", e, out)
+		}
+	}
+}
+
+func assertNotContains(t *testing.T, out string, unexpected ...string) {
+	t.Helper()
+	for _, e := range unexpected {
+		if strings.Contains(out, e) {
+			t.Errorf("expected output not to contain %q:\n%s", e, out)
+		}
+	}
+}
+
+func TestRequest(t *testing.T) {
+	b := NewBuilder()
+	b.SetClock(func() time.Time { return time.Date(2016, time.July, 1, 12, 0, 0, 0, time.UTC) })
+
+	e := testEvent()
+	m, err := b.Request(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := encode(t, m)
+	assertContains(t, out,
+		"METHOD:REQUEST\r\n",
+		"UID:meeting@example.com\r\n",
+		"DTSTAMP:20160701T120000Z\r\n",
+		"DTSTART:20160704T100000Z\r\n",
+		"SEQUENCE:1\r\n",
+		"RRULE:FREQ=WEEKLY;COUNT=4\r\n",
+		"ORGANIZER;CN=Alice:mailto:alice@example.com\r\n",
+		"mailto:bob@example.com\r\n",
+		"mailto:carol@example.com\r\n",
+		"DESCRIPTION:Agenda to be defined\r\n",
+	)
+	assertNotContains(t, out, "BEGIN:VALARM")
+
+	if len(e.Alarms) != 1 {
+		t.Errorf("expected alarms of the event to be kept")
+	}
+
+	cal, err := ics.ParseICalContent(out, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cal.Method != MethodRequest || len(cal.Events) != 1 || cal.Events[0].ID != e.ID {
+		t.Errorf("expected message to be parsed as a request, got %+v", cal)
+	}
+
+	for _, e := range []*ics.Event{
+		{Start: e.Start, Organizer: e.Organizer, Attendees: e.Attendees},
+		{ID: "id", Start: e.Start, Attendees: e.Attendees},
+		{ID: "id", Start: e.Start, Organizer: e.Organizer},
+		{ID: "id", Organizer: e.Organizer, Attendees: e.Attendees},
+	} {
+		if _, err := Request(e); err == nil {
+			t.Errorf("expected an error for %+v", e)
+		}
+	}
+}
+
+func TestRequestTimezones(t *testing.T) {
+	cal, err := ics.ParseICalContent(strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:meeting@example.com",
+		`DTSTART;TZID="W. Europe Standard Time":20160704T100000`,
+		"DTEND;TZID=America/New_York:20160704T110000",
+		"RRULE:FREQ=MONTHLY;COUNT=12",
+		"ORGANIZER:mailto:alice@example.com",
+		"ATTENDEE:mailto:bob@example.com",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n"), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Request(&cal.Events[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := encode(t, m)
+	assertContains(t, out,
+		"BEGIN:VTIMEZONE\r\nTZID:W. Europe Standard Time\r\n",
+		"BEGIN:VTIMEZONE\r\nTZID:America/New_York\r\n",
+		"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU\r\n",
+	)
+
+	if strings.Count(out, "BEGIN:VTIMEZONE") != 2 {
+		t.Errorf("expected a VTIMEZONE for each TZID:\n%s", out)
+	}
+
+	result, err := ics.ParseICalContent(out, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := result.Timezones["W. Europe Standard Time"]; !ok || len(result.Events) != 1 {
+		t.Fatalf("expected the message to define its timezones, got %v", result.Timezones)
+	}
+
+	// the occurrence in winter has a different offset
+	e := result.Events[0]
+	expected := []time.Time{
+		time.Date(2016, time.July, 4, 8, 0, 0, 0, time.UTC),
+		time.Date(2016, time.December, 4, 9, 0, 0, 0, time.UTC),
+	}
+	var starts []time.Time
+	for o := range e.Occurrences(expected[0], expected[1].Add(time.Hour)) {
+		starts = append(starts, o.Start)
+	}
+
+	if len(starts) != 6 || !starts[0].Equal(expected[0]) || !starts[5].Equal(expected[1]) {
+		t.Errorf("expected occurrences from %s to %s, got %v", expected[0], expected[1], starts)
+	}
+}
+
+func TestRevise(t *testing.T) {
+	previous := testEvent()
+
+	current := testEvent()
+	current.Summary = "Weekly sync"
+	if Revise(previous, current) || current.Sequence != 1 || current.Attendees[0].Status != Accepted {
+		t.Errorf("expected changing the summary not to reschedule the event, got %+v", current)
+	}
+
+	current.Start = current.Start.Add(time.Hour)
+	current.End = current.End.Add(time.Hour)
+	if !Revise(previous, current) || current.Sequence != 2 {
+		t.Errorf("expected moving the event to increase the sequence, got %d", current.Sequence)
+	}
+
+	for _, a := range current.Attendees {
+		if a.Status != NeedsAction {
+			t.Errorf("expected attendee to need to reply again, got %+v", a)
+		}
+	}
+
+	if previous.Attendees[0].Status != Accepted {
+		t.Errorf("expected previous version not to be changed")
+	}
+
+	current = testEvent()
+	current.ExDates = []time.Time{time.Date(2016, time.July, 11, 10, 0, 0, 0, time.UTC)}
+	if !Revise(previous, current) || current.Sequence != 2 {
+		t.Errorf("expected excluding an occurrence to increase the sequence, got %d", current.Sequence)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	e := testEvent()
+	m, err := Cancel(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := encode(t, m)
+	assertContains(t, out,
+		"METHOD:CANCEL\r\n",
+		"SEQUENCE:2\r\n",
+		"STATUS:CANCELLED\r\n",
+		"mailto:bob@example.com\r\n",
+		"mailto:carol@example.com\r\n",
+	)
+	assertNotContains(t, out, "DESCRIPTION")
+
+	if e.Sequence != 1 {
+		t.Errorf("expected event not to be changed")
+	}
+
+	m, err = Cancel(Instance(e, time.Date(2016, time.July, 11, 10, 0, 0, 0, time.UTC)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out = encode(t, m)
+	assertContains(t, out,
+		"RECURRENCE-ID:20160711T100000Z\r\n",
+		"DTSTART:20160711T100000Z\r\n",
+		"DTEND:20160711T110000Z\r\n",
+	)
+	assertNotContains(t, out, "RRULE")
+
+	m, err = Cancel(e, e.Attendees[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out = encode(t, m)
+	assertContains(t, out, "mailto:carol@example.com\r\n")
+	assertNotContains(t, out, "mailto:bob@example.com", "STATUS:CANCELLED")
+}
+
+func TestAdd(t *testing.T) {
+	e := testEvent()
+	e.RRule = ""
+	e.Start = time.Date(2016, time.August, 1, 10, 0, 0, 0, time.UTC)
+	e.End = e.Start.Add(time.Hour)
+
+	m, err := Add(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, encode(t, m), "METHOD:ADD\r\n", "DTSTART:20160801T100000Z\r\n", "SEQUENCE:1\r\n")
+
+	if _, err := Add(Instance(testEvent(), e.Start)); err == nil {
+		t.Errorf("expected an error adding an instance with recurrence ID")
+	}
+}
+
+func TestReply(t *testing.T) {
+	e := testEvent()
+	m, err := Reply(e, e.Attendees[1], "accepted")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := encode(t, m)
+	assertContains(t, out,
+		"METHOD:REPLY\r\n",
+		"SEQUENCE:1\r\n",
+		"ORGANIZER;CN=Alice:mailto:alice@example.com\r\n",
+		"ATTENDEE;ROLE=OPT-PARTICIPANT;PARTSTAT=ACCEPTED;CN=Carol:mailto:carol@example.com\r\n",
+	)
+	assertNotContains(t, out, "bob@example.com", "DESCRIPTION", "RRULE")
+
+	if e.Attendees[1].Status != NeedsAction {
+		t.Errorf("expected event not to be changed")
+	}
+
+	if _, err := Reply(e, e.Attendees[1], NeedsAction); err == nil {
+		t.Errorf("expected an error replying without a decision")
+	}
+
+	if _, err := Reply(e, ics.Attendee{}, Accepted); err == nil {
+		t.Errorf("expected an error replying without attendee")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	e := testEvent()
+	m, err := Refresh(Instance(e, time.Date(2016, time.July, 11, 10, 0, 0, 0, time.UTC)), e.Attendees[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := encode(t, m)
+	assertContains(t, out,
+		"METHOD:REFRESH\r\n",
+		"UID:meeting@example.com\r\n",
+		"RECURRENCE-ID:20160711T100000Z\r\n",
+		"mailto:bob@example.com\r\n",
+	)
+	assertNotContains(t, out, "SEQUENCE", "DTSTART", "SUMMARY", "carol@example.com")
+}
+
+func TestCounter(t *testing.T) {
+	proposal := testEvent()
+	proposal.Start = proposal.Start.Add(2 * time.Hour)
+	proposal.End = proposal.End.Add(2 * time.Hour)
+
+	dave := ics.Attendee{Name: "Dave", Email: "dave@example.com"}
+	m, err := Counter(proposal, dave)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := encode(t, m)
+	assertContains(t, out,
+		"METHOD:COUNTER\r\n",
+		"DTSTART:20160704T120000Z\r\n",
+		"SEQUENCE:1\r\n",
+		"mailto:dave@example.com\r\n",
+		"mailto:bob@example.com\r\n",
+	)
+
+	if len(proposal.Attendees) != 2 {
+		t.Errorf("expected proposal not to be changed")
+	}
+
+	m, err = DeclineCounter(&m.Events[0], dave)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out = encode(t, m)
+	assertContains(t, out,
+		"METHOD:DECLINECOUNTER\r\n",
+		"SEQUENCE:1\r\n",
+		"mailto:dave@example.com\r\n",
+	)
+	assertNotContains(t, out, "DTSTART", "bob@example.com")
+}
+
+func TestPublish(t *testing.T) {
+	e := testEvent()
+	e.Attendees = nil
+	m, err := Publish(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertContains(t, encode(t, m), "METHOD:PUBLISH\r\n", "SUMMARY:Weekly meeting\r\n")
+}
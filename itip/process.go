@@ -0,0 +1,327 @@
+package itip
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/erizocosmico/go-ics"
+)
+
+// ErrStale is returned when a message is older than the version of the
+// event it is about, by its sequence or its DTSTAMP.
+var ErrStale = errors.New("stale message")
+
+// Kinds of changes applied by messages.
+const (
+	// ChangeAdded is an event that was not in the calendar.
+	ChangeAdded = "ADDED"
+	// ChangeUpdated is an event that was replaced by a new version.
+	ChangeUpdated = "UPDATED"
+	// ChangeCancelled is an event, or one of its occurrences, that was
+	// cancelled.
+	ChangeCancelled = "CANCELLED"
+	// ChangeRemoved is an attendee that was removed from an event.
+	ChangeRemoved = "REMOVED"
+	// ChangeStatus is the participation status of an attendee that changed.
+	ChangeStatus = "STATUS"
+)
+
+// Change is a change a message made in a calendar. Attendee, Previous and
+// Status are only set for changes of attendees, Previous being their
+// participation status before the change and Status the new one.
+type Change struct {
+	Kind         string
+	EventID      string
+	RecurrenceID time.Time
+	Attendee     string
+	Previous     string
+	Status       string
+}
+
+// ReplyStampParam is the parameter of the attendees of the stored events
+// with the DTSTAMP of their last reply, so replies that arrive out of order
+// can be rejected even if they are processed by a different Processor. It
+// is kept in the stored events and written with them, but never in the
+// messages sent to others.
+const ReplyStampParam = ics.ReplyStampParam
+
+// Processor applies the iTIP messages that are received to the calendar in
+// which the events they are about are stored.
+type Processor struct{}
+
+// NewProcessor returns a new processor of iTIP messages.
+func NewProcessor() *Processor {
+	return &Processor{}
+}
+
+// Process applies the message, a parsed calendar with a METHOD, to the
+// stored calendar, which must have been parsed without expanding its
+// repeating events. It returns a copy of the calendar with the changes
+// and a summary of them, leaving the stored calendar untouched.
+//
+// REPLY messages update the participation status of the attendee that
+// replied, CANCEL messages cancel events or some of their occurrences, or
+// remove attendees from them, and REQUEST and ADD messages add or replace
+// events. If the message is older than any of the events it is about, by
+// their SEQUENCE and then by their DTSTAMP, or than the last reply of the
+// attendee, nothing is applied and an error wrapping ErrStale is returned.
+func (p *Processor) Process(stored, msg *ics.Calendar) (*ics.Calendar, []Change, error) {
+	cal := *stored
+	cal.Events = append([]ics.Event(nil), stored.Events...)
+
+	var changes []Change
+	for i := range msg.Events {
+		e := &msg.Events[i]
+		if e.ID == "" {
+			return nil, nil, fmt.Errorf("%s of an event without UID", msg.Method)
+		}
+
+		var c []Change
+		var err error
+		switch strings.ToUpper(msg.Method) {
+		case MethodReply:
+			c, err = reply(&cal, e)
+		case MethodCancel:
+			c, err = cancel(&cal, e)
+		case MethodRequest, MethodAdd:
+			c, err = request(&cal, e, msg.Method)
+		default:
+			err = fmt.Errorf("unsupported method %q", msg.Method)
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, c...)
+	}
+
+	return &cal, changes, nil
+}
+
+// reply applies the REPLY of an event to the calendar. The DTSTAMP of the
+// reply is kept in the ReplyStampParam of the attendees that replied.
+func reply(cal *ics.Calendar, e *ics.Event) ([]Change, error) {
+	i, master := find(cal, e.ID, e.RecurrenceID)
+	if i < 0 && master < 0 {
+		return nil, fmt.Errorf("%s to unknown event %q", MethodReply, e.ID)
+	}
+
+	if i < 0 {
+		// replies to a single occurrence of a repeating event become an
+		// override of that occurrence
+		i = addInstance(cal, master, e.RecurrenceID)
+	}
+
+	stored := &cal.Events[i]
+	if e.Sequence < stored.Sequence {
+		return nil, fmt.Errorf("%w: %s of %q with sequence %d, expected %d", ErrStale, MethodReply, e.ID, e.Sequence, stored.Sequence)
+	}
+
+	stored.Attendees = append([]ics.Attendee(nil), stored.Attendees...)
+	stamp := StampOf(e)
+	var changes []Change
+	for _, a := range e.Attendees {
+		change := Change{Kind: ChangeStatus, EventID: e.ID, RecurrenceID: e.RecurrenceID, Attendee: a.Email, Status: a.Status}
+		j := attendeeIndex(stored.Attendees, a.Email)
+		if j < 0 {
+			// attendees that were not invited can reply too
+			stored.Attendees = append(stored.Attendees, a)
+			j = len(stored.Attendees) - 1
+		} else {
+			last, err := time.Parse(stampFormat, stored.Attendees[j].Params.Get(ReplyStampParam))
+			if err == nil && stamp.Before(last) {
+				return nil, fmt.Errorf("%w: %s of %q by %s sent before the last one", ErrStale, MethodReply, e.ID, a.Email)
+			}
+
+			change.Previous = stored.Attendees[j].Status
+			stored.Attendees[j].Status = a.Status
+		}
+
+		if !stamp.IsZero() {
+			params := append(ics.Params(nil), stored.Attendees[j].Params...)
+			params.Set(ReplyStampParam, stamp.UTC().Format(stampFormat))
+			stored.Attendees[j].Params = params
+		}
+
+		if change.Previous != change.Status {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+// addInstance adds an override of the occurrence of the repeating event at
+// the given index that originally starts at recurrenceID to the calendar
+// and returns its index.
+func addInstance(cal *ics.Calendar, master int, recurrenceID time.Time) int {
+	cal.Events = append(cal.Events, *Instance(&cal.Events[master], recurrenceID))
+	i := len(cal.Events) - 1
+	cal.Events[i].Alarms = cal.Events[master].Alarms
+	return i
+}
+
+// cancel applies the CANCEL of an event to the calendar.
+func cancel(cal *ics.Calendar, e *ics.Event) ([]Change, error) {
+	i, master := find(cal, e.ID, e.RecurrenceID)
+	if i < 0 && master < 0 {
+		return nil, fmt.Errorf("%s of unknown event %q", MethodCancel, e.ID)
+	}
+
+	current := i
+	if current < 0 {
+		current = master
+	}
+
+	if err := checkSequence(MethodCancel, &cal.Events[current], e); err != nil {
+		return nil, err
+	}
+
+	// the attendees that are not in the event any more are the only ones
+	// in the message
+	if !strings.EqualFold(e.Status, "CANCELLED") && len(e.Attendees) > 0 {
+		if i < 0 {
+			// the attendees are removed from a single occurrence, which
+			// becomes an override of it
+			i = addInstance(cal, master, e.RecurrenceID)
+		}
+
+		stored := &cal.Events[i]
+		var attendees []ics.Attendee
+		var changes []Change
+		for _, a := range stored.Attendees {
+			if attendeeIndex(e.Attendees, a.Email) < 0 {
+				attendees = append(attendees, a)
+				continue
+			}
+			changes = append(changes, Change{Kind: ChangeRemoved, EventID: e.ID, RecurrenceID: e.RecurrenceID, Attendee: a.Email})
+		}
+
+		stored.Attendees = attendees
+		stored.Sequence = e.Sequence
+		return changes, nil
+	}
+
+	change := Change{Kind: ChangeCancelled, EventID: e.ID, RecurrenceID: e.RecurrenceID}
+	if e.RecurrenceID.IsZero() {
+		// the overrides of the occurrences of the event are cancelled too
+		for j := range cal.Events {
+			if cal.Events[j].ID == e.ID {
+				cal.Events[j].Status = "CANCELLED"
+				cal.Events[j].Sequence = e.Sequence
+			}
+		}
+		return []Change{change}, nil
+	}
+
+	// cancelled occurrences are excluded from the repeating event and their
+	// overrides are removed
+	if master >= 0 {
+		m := &cal.Events[master]
+		m.ExDates = append(append([]time.Time(nil), m.ExDates...), e.RecurrenceID)
+	}
+
+	if i >= 0 {
+		cal.Events = append(cal.Events[:i:i], cal.Events[i+1:]...)
+	}
+
+	return []Change{change}, nil
+}
+
+// request applies the REQUEST or ADD of an event to the calendar.
+func request(cal *ics.Calendar, e *ics.Event, method string) ([]Change, error) {
+	// the component of the message is kept, as its DTSTAMP is the one of
+	// the version of the event in the calendar
+	event := *e
+
+	i, master := find(cal, e.ID, e.RecurrenceID)
+	if i < 0 {
+		if master >= 0 {
+			if err := checkSequence(method, &cal.Events[master], e); err != nil {
+				return nil, err
+			}
+		}
+
+		cal.Events = append(cal.Events, event)
+		return []Change{{Kind: ChangeAdded, EventID: e.ID, RecurrenceID: e.RecurrenceID}}, nil
+	}
+
+	stored := &cal.Events[i]
+	if err := checkSequence(method, stored, e); err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(method, MethodAdd) {
+		// the new instance is added to the RDATEs of the event
+		stored.RDates = append(append([]time.Time(nil), stored.RDates...), e.Start)
+		stored.Sequence = e.Sequence
+		return []Change{{Kind: ChangeUpdated, EventID: e.ID}}, nil
+	}
+
+	// alarms are personal, so they are kept
+	event.Alarms = stored.Alarms
+	*stored = event
+	return []Change{{Kind: ChangeUpdated, EventID: e.ID, RecurrenceID: e.RecurrenceID}}, nil
+}
+
+// checkSequence returns an error wrapping ErrStale if the message of the
+// event is older than the stored event.
+func checkSequence(method string, stored, e *ics.Event) error {
+	if e.Sequence < stored.Sequence {
+		return fmt.Errorf("%w: %s of %q with sequence %d, expected %d", ErrStale, method, e.ID, e.Sequence, stored.Sequence)
+	}
+
+	if e.Sequence == stored.Sequence {
+		stamp, storedStamp := StampOf(e), StampOf(stored)
+		if !stamp.IsZero() && stamp.Before(storedStamp) {
+			return fmt.Errorf("%w: %s of %q sent before the stored version", ErrStale, method, e.ID)
+		}
+	}
+
+	return nil
+}
+
+// find returns the index of the event with the given ID and recurrence ID
+// in the calendar, and the index of the repeating event with that ID, or
+// -1 if there is none.
+func find(cal *ics.Calendar, id string, recurrenceID time.Time) (int, int) {
+	index, master := -1, -1
+	for i := range cal.Events {
+		e := &cal.Events[i]
+		if e.ID != id {
+			continue
+		}
+
+		if e.RecurrenceID.IsZero() && master < 0 {
+			master = i
+		}
+
+		if e.RecurrenceID.Equal(recurrenceID) && index < 0 {
+			index = i
+		}
+	}
+	return index, master
+}
+
+func attendeeIndex(attendees []ics.Attendee, email string) int {
+	for i, a := range attendees {
+		if strings.EqualFold(a.Email, email) {
+			return i
+		}
+	}
+	return -1
+}
+
+// StampOf returns the DTSTAMP of the event, which is the one of the
+// component it was parsed from or, for events that were not parsed, the
+// time they were last modified.
+func StampOf(e *ics.Event) time.Time {
+	if e.Component != nil {
+		if t, err := time.Parse(stampFormat, e.Component.Value("DTSTAMP")); err == nil {
+			return t
+		}
+	}
+	return e.Modified
+}
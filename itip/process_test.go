@@ -0,0 +1,294 @@
+package itip
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/erizocosmico/go-ics"
+)
+
+// parse returns the message as the calendar it is parsed to when received.
+func parse(t *testing.T, m *Message) *ics.Calendar {
+	t.Helper()
+	cal, err := ics.ParseICalContent(encode(t, m), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &cal
+}
+
+func storedCalendar(events ...*ics.Event) *ics.Calendar {
+	cal := ics.NewCalendar()
+	for _, e := range events {
+		cal.Events = append(cal.Events, *e)
+	}
+	return &cal
+}
+
+func TestProcessReply(t *testing.T) {
+	e := testEvent()
+	stored := storedCalendar(e)
+
+	m, err := Reply(e, e.Attendees[1], Accepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProcessor()
+	cal, changes, err := p.Process(stored, parse(t, m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Change{Kind: ChangeStatus, EventID: e.ID, Attendee: "carol@example.com", Previous: NeedsAction, Status: Accepted}
+	if len(changes) != 1 || changes[0] != expected {
+		t.Errorf("expected change %+v, got %+v", expected, changes)
+	}
+
+	if cal.Events[0].Attendees[1].Status != Accepted {
+		t.Errorf("expected attendee to have accepted, got %+v", cal.Events[0].Attendees[1])
+	}
+
+	if stored.Events[0].Attendees[1].Status != NeedsAction {
+		t.Errorf("expected stored calendar not to be changed")
+	}
+
+	if len(cal.Events[0].Alarms) != 1 {
+		t.Errorf("expected alarms to be kept")
+	}
+
+	// a reply sent before the last one arrives later
+	old, err := Reply(e, e.Attendees[1], Declined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Stamp = old.Stamp.Add(-time.Hour)
+
+	if _, _, err := p.Process(cal, parse(t, old)); !errors.Is(err, ErrStale) {
+		t.Errorf("expected reply to be stale, got %v", err)
+	}
+
+	// the stamp of the last reply is kept in the stored calendar, so it is
+	// known by other processors once the calendar is written and read again
+	var buf bytes.Buffer
+	if err := ics.NewEncoder(&buf).Encode(cal); err != nil {
+		t.Fatal(err)
+	}
+	reread, err := ics.ParseICalContent(buf.String(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := NewProcessor().Process(&reread, parse(t, old)); !errors.Is(err, ErrStale) {
+		t.Errorf("expected reply to be stale after reading the calendar again, got %v", err)
+	}
+
+	// but it is never sent to the attendees
+	request, err := Request(&reread.Events[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNotContains(t, encode(t, request), ReplyStampParam)
+
+	// replies to a previous version of the event
+	revised := cal.Events[0]
+	revised.Sequence = 2
+	cal.Events[0] = revised
+	if _, _, err := p.Process(cal, parse(t, m)); !errors.Is(err, ErrStale) {
+		t.Errorf("expected reply to be stale, got %v", err)
+	}
+}
+
+func TestProcessReplyInstance(t *testing.T) {
+	e := testEvent()
+	stored := storedCalendar(e)
+	recurrenceID := time.Date(2016, time.July, 11, 10, 0, 0, 0, time.UTC)
+
+	m, err := Reply(Instance(e, recurrenceID), e.Attendees[0], Declined)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cal, changes, err := NewProcessor().Process(stored, parse(t, m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 1 || changes[0].Previous != Accepted || changes[0].Status != Declined || !changes[0].RecurrenceID.Equal(recurrenceID) {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+
+	if len(cal.Events) != 2 {
+		t.Fatalf("expected an override of the occurrence, got %d events", len(cal.Events))
+	}
+
+	override := cal.Events[1]
+	if !override.RecurrenceID.Equal(recurrenceID) || override.Attendees[0].Status != Declined {
+		t.Errorf("unexpected override %+v", override)
+	}
+
+	if cal.Events[0].Attendees[0].Status != Accepted {
+		t.Errorf("expected other occurrences not to be changed")
+	}
+}
+
+func TestProcessCancel(t *testing.T) {
+	e := testEvent()
+	stored := storedCalendar(e)
+	recurrenceID := time.Date(2016, time.July, 11, 10, 0, 0, 0, time.UTC)
+	stored.Events = append(stored.Events, *Instance(e, recurrenceID))
+
+	m, err := Cancel(Instance(e, recurrenceID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProcessor()
+	cal, changes, err := p.Process(stored, parse(t, m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 1 || changes[0].Kind != ChangeCancelled || !changes[0].RecurrenceID.Equal(recurrenceID) {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+
+	if len(cal.Events) != 1 || len(cal.Events[0].ExDates) != 1 || !cal.Events[0].ExDates[0].Equal(recurrenceID) {
+		t.Errorf("expected occurrence to be excluded, got %+v", cal.Events)
+	}
+
+	if len(stored.Events) != 2 || len(stored.Events[0].ExDates) != 0 {
+		t.Errorf("expected stored calendar not to be changed")
+	}
+
+	m, err = Cancel(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cal, changes, err = p.Process(cal, parse(t, m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 1 || cal.Events[0].Status != "CANCELLED" || cal.Events[0].Sequence != 2 {
+		t.Errorf("expected event to be cancelled, got %+v", cal.Events[0])
+	}
+
+	// the overrides of the event are cancelled with it
+	other := time.Date(2016, time.July, 18, 10, 0, 0, 0, time.UTC)
+	cal, _, err = p.Process(storedCalendar(e, Instance(e, other)), parse(t, m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, event := range cal.Events {
+		if event.Status != "CANCELLED" {
+			t.Errorf("expected every event to be cancelled, got %+v", event)
+		}
+	}
+
+	m, err = Cancel(e, e.Attendees[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Events[0].Sequence = 3
+
+	cal, changes, err = p.Process(storedCalendar(e), parse(t, m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 1 || changes[0].Kind != ChangeRemoved || changes[0].Attendee != "carol@example.com" {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+
+	if len(cal.Events[0].Attendees) != 1 || cal.Events[0].Status == "CANCELLED" {
+		t.Errorf("expected attendee to be removed, got %+v", cal.Events[0])
+	}
+
+	// attendees removed from a single occurrence are removed from an
+	// override of it, and the occurrence is not excluded
+	m, err = Cancel(Instance(e, recurrenceID), e.Attendees[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cal, changes, err = p.Process(storedCalendar(e), parse(t, m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 1 || changes[0].Kind != ChangeRemoved || !changes[0].RecurrenceID.Equal(recurrenceID) {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+
+	if len(cal.Events) != 2 || len(cal.Events[0].ExDates) != 0 || len(cal.Events[0].Attendees) != 2 {
+		t.Fatalf("expected an override of the occurrence, got %+v", cal.Events)
+	}
+
+	override := cal.Events[1]
+	if !override.RecurrenceID.Equal(recurrenceID) || len(override.Attendees) != 1 || override.Status == "CANCELLED" {
+		t.Errorf("unexpected override %+v", override)
+	}
+}
+
+func TestProcessRequest(t *testing.T) {
+	e := testEvent()
+	m, err := Request(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProcessor()
+	cal, changes, err := p.Process(storedCalendar(), parse(t, m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 1 || changes[0].Kind != ChangeAdded || len(cal.Events) != 1 {
+		t.Fatalf("expected event to be added, got %+v", changes)
+	}
+	cal.Events[0].Alarms = e.Alarms
+
+	rescheduled := testEvent()
+	rescheduled.Start = rescheduled.Start.Add(time.Hour)
+	rescheduled.End = rescheduled.End.Add(time.Hour)
+	Revise(e, rescheduled)
+
+	update, err := Request(rescheduled)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, changes, err := p.Process(cal, parse(t, update))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 1 || changes[0].Kind != ChangeUpdated {
+		t.Errorf("expected event to be updated, got %+v", changes)
+	}
+
+	event := updated.Events[0]
+	if !event.Start.Equal(rescheduled.Start) || event.Sequence != 2 || len(event.Alarms) != 1 {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	// the first request arrives after the update
+	if _, _, err := p.Process(updated, parse(t, m)); !errors.Is(err, ErrStale) {
+		t.Errorf("expected request to be stale, got %v", err)
+	}
+
+	// same sequence, sent earlier
+	m.Stamp = m.Stamp.Add(-time.Hour)
+	if _, _, err := p.Process(cal, parse(t, m)); !errors.Is(err, ErrStale) {
+		t.Errorf("expected request to be stale, got %v", err)
+	}
+
+	if _, _, err := p.Process(cal, &ics.Calendar{Method: MethodCounter, Events: cal.Events}); err == nil {
+		t.Errorf("expected an error processing an unsupported method")
+	}
+}
@@ -0,0 +1,91 @@
+package ics
+
+import (
+	"iter"
+	"time"
+)
+
+// Statuses of a journal.
+const (
+	JournalDraft     = "DRAFT"
+	JournalFinal     = "FINAL"
+	JournalCancelled = "CANCELLED"
+)
+
+// Journal represents a journal entry in the calendar, a VJOURNAL
+// component, such as the notes of a meeting. Like events, journals with a
+// RecurrenceID override an instance of the repeating journal with the same
+// ID.
+//
+// Start is the instant the journal is associated with, while DTStart is
+// the value of DTSTART as it is in the calendar. A journal can have
+// several descriptions, each one of them from a DESCRIPTION property.
+type Journal struct {
+	Start        time.Time
+	DTStart      DateTime
+	Created      time.Time
+	Modified     time.Time
+	ID           string
+	Status       string
+	Summary      string
+	Descriptions []string
+	Categories   []string
+	Attachments  []Attachment
+	Class        string
+	Sequence     int
+	RRule        string
+	RDates       []time.Time
+	ExDates      []time.Time
+	RecurrenceID time.Time
+	Attendees    []Attendee
+	Organizer    Attendee
+
+	// Component is the raw VJOURNAL component the journal was parsed from.
+	Component *Component
+}
+
+// Attachment is a document associated with a calendar component, an ATTACH
+// property. It is either referenced by its URI or its Data is inlined.
+type Attachment struct {
+	URI string
+	// FormatType is the media type of the document, such as
+	// application/pdf. It may be empty.
+	FormatType string
+	Data       []byte
+}
+
+// NewJournal returns a new empty Journal entity
+func NewJournal() *Journal {
+	return &Journal{
+		Attendees: []Attendee{},
+	}
+}
+
+// Clone returns an identical clone of the current Journal entity
+func (j *Journal) Clone() *Journal {
+	newJournal := *j
+	return &newJournal
+}
+
+// Occurrences returns an iterator over the start of all the occurrences of
+// the journal between from, inclusive, and to, in order. If to is zero
+// there is no end. Journals without start have no occurrences.
+func (j *Journal) Occurrences(from, to time.Time) iter.Seq[time.Time] {
+	return func(yield func(time.Time) bool) {
+		if j.Start.IsZero() {
+			return
+		}
+
+		next := recurrenceStarts(j.Start, j.RRule, j.RDates, j.ExDates)
+		for {
+			start, ok := next()
+			if !ok || (!to.IsZero() && !start.Before(to)) {
+				return
+			}
+
+			if !start.Before(from) && !yield(start) {
+				return
+			}
+		}
+	}
+}
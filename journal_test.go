@@ -0,0 +1,139 @@
+package ics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJournals(t *testing.T) {
+	calendar, err := ParseCalendar("testCalendars/journals.ics", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calendar.Events) != 1 || len(calendar.Journals) != 2 {
+		t.Fatalf("expected 1 event and 2 journals, got %d and %d", len(calendar.Events), len(calendar.Journals))
+	}
+
+	notes := calendar.Journals[0]
+	if notes.Summary != "Stand-up notes" || notes.Status != JournalFinal || notes.Class != "PRIVATE" {
+		t.Errorf("unexpected journal %+v", notes)
+	}
+
+	if !notes.Start.Equal(time.Date(2016, time.July, 4, 0, 0, 0, 0, calendar.Timezone)) || notes.DTStart.Kind != Date {
+		t.Errorf("expected journal on 2016-07-04, got %s", notes.Start)
+	}
+
+	descriptions := []string{"Release moved to Friday.", "Ana to review the migration, Luis on support."}
+	if !reflect.DeepEqual(notes.Descriptions, descriptions) {
+		t.Errorf("expected descriptions %q, got %q", descriptions, notes.Descriptions)
+	}
+
+	categories := []string{"Meetings", "Project X", "Notes"}
+	if !reflect.DeepEqual(notes.Categories, categories) {
+		t.Errorf("expected categories %q, got %q", categories, notes.Categories)
+	}
+
+	attachments := []Attachment{
+		{URI: "https://example.com/minutes.pdf", FormatType: "application/pdf"},
+		{FormatType: "text/plain", Data: []byte("Hello, world!")},
+	}
+	if !reflect.DeepEqual(notes.Attachments, attachments) {
+		t.Errorf("expected attachments %+v, got %+v", attachments, notes.Attachments)
+	}
+
+	var starts []time.Time
+	for start := range calendar.Journals[1].Occurrences(time.Date(2016, time.July, 2, 0, 0, 0, 0, time.UTC), time.Time{}) {
+		starts = append(starts, start)
+	}
+
+	if len(starts) != 2 || !starts[1].Equal(time.Date(2016, time.July, 15, 17, 0, 0, 0, calendar.Timezone)) {
+		t.Errorf("expected 2 floating occurrences, got %v", starts)
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	cases := map[string][]string{
+		"a":           {"a"},
+		"a,b":         {"a", "b"},
+		`a\,b,c`:      {"a,b", "c"},
+		`a\\,b`:       {`a\`, "b"},
+		`one\;two,,x`: {"one;two", "", "x"},
+	}
+
+	for value, expected := range cases {
+		if result := splitText(value); !reflect.DeepEqual(result, expected) {
+			t.Errorf("expected %q to be split into %q, got %q", value, expected, result)
+		}
+	}
+}
+
+func TestEncodeJournals(t *testing.T) {
+	calendar, err := ParseCalendar("testCalendars/journals.ics", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := calendar.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []string{
+		"DTSTART;VALUE=DATE:20160704\r\n",
+		"DESCRIPTION:Ana to review the migration\\, Luis on support.\r\n",
+		"CATEGORIES:Meetings,Project X,Notes\r\n",
+		"ATTACH;FMTTYPE=text/plain;ENCODING=BASE64;VALUE=BINARY:SGVsbG8sIHdvcmxkIQ==\r\n",
+		"DTSTART:20160701T170000\r\n",
+	} {
+		if !strings.Contains(buf.String(), e) {
+			t.Errorf("expected output to contain %q:\n%s", e, buf.String())
+		}
+	}
+
+	result, err := ParseICalContent(buf.String(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range calendar.Journals {
+		e, r := calendar.Journals[i], result.Journals[i]
+		if !e.Start.Equal(r.Start) {
+			t.Errorf("expected start %s, got %s", e.Start, r.Start)
+		}
+
+		e.Start, e.DTStart, e.Component = r.Start, r.DTStart, r.Component
+		if !reflect.DeepEqual(e, r) {
+			t.Errorf("expected journal:\n%+v\ngot:\n%+v", e, r)
+		}
+	}
+}
+
+func TestRoundTripJournals(t *testing.T) {
+	content, err := ioutil.ReadFile("testCalendars/journals.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calendar, err := ParseICalContent(string(content), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out := encodeRoundTrip(t, &calendar); out != string(content) {
+		t.Errorf("expected output to be identical to the input, got:\n%s", out)
+	}
+
+	calendar.Journals[0].Descriptions = append(calendar.Journals[0].Descriptions, "Next: demo")
+	out := encodeRoundTrip(t, &calendar)
+	expected := strings.Replace(string(content),
+		"DESCRIPTION:Ana to review the migration\\, Luis on support.\r\n",
+		"DESCRIPTION:Ana to review the migration\\, Luis on support.\r\nDESCRIPTION:Next: demo\r\n", 1)
+	if out != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
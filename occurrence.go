@@ -0,0 +1,289 @@
+package ics
+
+import (
+	"container/heap"
+	"iter"
+	"sort"
+	"time"
+
+	"github.com/erizocosmico/go-ics/recurrence"
+)
+
+// Occurrence is a single instance of an event. For events that do not
+// repeat there is only one occurrence, with the start and end of the event.
+type Occurrence struct {
+	// Event is the event the occurrence belongs to. For instances that
+	// have been overridden it is the overriding event.
+	Event *Event
+	Start time.Time
+	End   time.Time
+	// RecurrenceID is the start the occurrence originally had according
+	// to the recurrence of its event.
+	RecurrenceID time.Time
+}
+
+// overlaps reports whether the occurrence overlaps with the time window
+// between from and to. A zero to means the window has no end.
+func (o Occurrence) overlaps(from, to time.Time) bool {
+	if !to.IsZero() && !o.Start.Before(to) {
+		return false
+	}
+
+	if o.End.After(o.Start) {
+		return o.End.After(from)
+	}
+	return !o.Start.Before(from)
+}
+
+// Occurrences returns an iterator over the occurrences of the event that
+// overlap with the time window between from and to, in order. Occurrences
+// are generated on demand from the start of the event, its RRULE and its
+// RDATEs, leaving out the ones in its EXDATEs, so it is safe to iterate
+// events that repeat forever. If to is zero the window has no end. Events
+// with a RRULE that can not be parsed only have the occurrences of their
+// start and RDATEs.
+func (e *Event) Occurrences(from, to time.Time) iter.Seq[Occurrence] {
+	return func(yield func(Occurrence) bool) {
+		duration := e.End.Sub(e.Start)
+		next := e.starts()
+		for {
+			start, ok := next()
+			if !ok || (!to.IsZero() && !start.Before(to)) {
+				return
+			}
+
+			o := Occurrence{
+				Event:        e,
+				Start:        start,
+				End:          start.Add(duration),
+				RecurrenceID: start,
+			}
+
+			if o.overlaps(from, to) && !yield(o) {
+				return
+			}
+		}
+	}
+}
+
+// starts returns a function that returns the start of every occurrence of
+// the event in order, merging the occurrences of its RRULE and its RDATEs
+// and leaving out the ones in its EXDATEs.
+func (e *Event) starts() func() (time.Time, bool) {
+	return recurrenceStarts(e.Start, e.RRule, e.RDates, e.ExDates)
+}
+
+// recurrenceStarts returns a function that returns in order the start of
+// every occurrence of a component starting at start with the given RRULE,
+// RDATEs and EXDATEs.
+func recurrenceStarts(start time.Time, rrule string, rdates, exdates []time.Time) func() (time.Time, bool) {
+	var rule *recurrence.Iterator
+	if rrule != "" {
+		if r, err := recurrence.Parse(rrule, start); err == nil {
+			rule = r.Iterator()
+		}
+	}
+
+	rdates = append([]time.Time{start}, rdates...)
+	sort.Slice(rdates, func(i, j int) bool {
+		return rdates[i].Before(rdates[j])
+	})
+
+	var (
+		nextRule    time.Time
+		hasNextRule bool
+		last        time.Time
+		started     bool
+	)
+
+	if rule != nil {
+		nextRule, hasNextRule = rule.Next()
+	}
+
+	return func() (time.Time, bool) {
+		for {
+			var t time.Time
+			switch {
+			case hasNextRule && (len(rdates) == 0 || !rdates[0].Before(nextRule)):
+				t = nextRule
+				nextRule, hasNextRule = rule.Next()
+			case len(rdates) > 0:
+				t = rdates[0]
+				rdates = rdates[1:]
+			default:
+				return time.Time{}, false
+			}
+
+			if (started && !t.After(last)) || isExcluded(t, exdates) {
+				continue
+			}
+
+			started = true
+			last = t
+			return t, true
+		}
+	}
+}
+
+// Between returns an iterator over the occurrences of all the events of
+// the calendar that overlap with the time window between from and to,
+// ordered by their start. Instances of repeating events that have been
+// overridden by another event with the same ID and a RECURRENCE-ID are
+// replaced by the overriding event with the highest sequence, and the
+// ones after an override with RANGE=THISANDFUTURE are moved and resized
+// like it. Like Occurrences, it is safe to use with events that repeat
+// forever, but the calendar must have been parsed with maxRepeats set to
+// 0, or the repetitions generated during the parsing would be returned as
+// well.
+func (c *Calendar) Between(from, to time.Time) iter.Seq[Occurrence] {
+	return func(yield func(Occurrence) bool) {
+		overrides := make(map[string][]*Event)
+		for i := range c.Events {
+			e := &c.Events[i]
+			if !e.RecurrenceID.IsZero() {
+				overrides[e.ID] = append(overrides[e.ID], e)
+			}
+		}
+
+		var seqs []iter.Seq[Occurrence]
+		for _, evs := range overrides {
+			ids, _ := indexOverrides(evs)
+			for _, e := range ids {
+				o := Occurrence{Event: e, Start: e.Start, End: e.End, RecurrenceID: e.RecurrenceID}
+				if o.overlaps(from, to) {
+					seqs = append(seqs, single(o))
+				}
+			}
+		}
+
+		for i := range c.Events {
+			e := &c.Events[i]
+			if !e.RecurrenceID.IsZero() {
+				continue
+			}
+
+			ids, ranges := indexOverrides(overrides[e.ID])
+			var after time.Time
+			var r *Event
+			for _, next := range ranges {
+				seqs = append(seqs, e.segment(r, after, next.RecurrenceID, ids, from, to))
+				r, after = next, next.RecurrenceID
+			}
+			seqs = append(seqs, e.segment(r, after, time.Time{}, ids, from, to))
+		}
+
+		mergeOccurrences(seqs, yield)
+	}
+}
+
+// segment returns an iterator over the occurrences of the event that
+// overlap with the time window between from and to and whose instances
+// start after the given time and not after until, if they are not zero.
+// If r is not nil, it is the override with RANGE=THISANDFUTURE that moves
+// all of them. Instances overridden by one of the given overrides, by the
+// start of the instance they override, are left out.
+func (e *Event) segment(r *Event, after, until time.Time, overridden map[int64]*Event, from, to time.Time) iter.Seq[Occurrence] {
+	return func(yield func(Occurrence) bool) {
+		event, offset, duration := e, time.Duration(0), e.End.Sub(e.Start)
+		if r != nil {
+			event, offset, duration = r, r.Start.Sub(r.RecurrenceID), r.End.Sub(r.Start)
+		}
+
+		next := e.starts()
+		for {
+			start, ok := next()
+			if !ok || (!until.IsZero() && start.After(until)) {
+				return
+			}
+
+			if !after.IsZero() && !start.After(after) {
+				continue
+			}
+
+			o := Occurrence{
+				Event:        event,
+				Start:        start.Add(offset),
+				End:          start.Add(offset).Add(duration),
+				RecurrenceID: start,
+			}
+
+			if !to.IsZero() && !o.Start.Before(to) {
+				return
+			}
+
+			if _, ok := overridden[start.UnixNano()]; ok || !o.overlaps(from, to) {
+				continue
+			}
+
+			if !yield(o) {
+				return
+			}
+		}
+	}
+}
+
+func single(o Occurrence) iter.Seq[Occurrence] {
+	return func(yield func(Occurrence) bool) {
+		yield(o)
+	}
+}
+
+// mergeOccurrences yields the occurrences of all the given sequences,
+// which must be ordered by start, ordered by start.
+func mergeOccurrences(seqs []iter.Seq[Occurrence], yield func(Occurrence) bool) {
+	h := &occurrenceHeap{}
+	for _, seq := range seqs {
+		next, stop := iter.Pull(seq)
+		defer stop()
+
+		if o, ok := next(); ok {
+			h.items = append(h.items, pulledOccurrence{o, next})
+		}
+	}
+
+	heap.Init(h)
+	for h.Len() > 0 {
+		item := h.items[0]
+		if !yield(item.occurrence) {
+			return
+		}
+
+		if o, ok := item.next(); ok {
+			h.items[0].occurrence = o
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+}
+
+type pulledOccurrence struct {
+	occurrence Occurrence
+	next       func() (Occurrence, bool)
+}
+
+type occurrenceHeap struct {
+	items []pulledOccurrence
+}
+
+func (h *occurrenceHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *occurrenceHeap) Less(i, j int) bool {
+	return h.items[i].occurrence.Start.Before(h.items[j].occurrence.Start)
+}
+
+func (h *occurrenceHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+func (h *occurrenceHeap) Push(x interface{}) {
+	h.items = append(h.items, x.(pulledOccurrence))
+}
+
+func (h *occurrenceHeap) Pop() interface{} {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return item
+}
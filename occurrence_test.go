@@ -0,0 +1,218 @@
+package ics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventOccurrencesForever(t *testing.T) {
+	start := time.Date(2016, time.January, 1, 9, 0, 0, 0, time.UTC)
+	e := &Event{
+		ID:    "daily",
+		Start: start,
+		End:   start.Add(time.Hour),
+		RRule: "FREQ=DAILY",
+	}
+
+	from := time.Date(2116, time.January, 1, 9, 30, 0, 0, time.UTC)
+	to := time.Date(2116, time.January, 4, 0, 0, 0, 0, time.UTC)
+	var result []Occurrence
+	for o := range e.Occurrences(from, to) {
+		result = append(result, o)
+	}
+
+	// the first one started before the window but still overlaps with it
+	expected := []time.Time{
+		time.Date(2116, time.January, 1, 9, 0, 0, 0, time.UTC),
+		time.Date(2116, time.January, 2, 9, 0, 0, 0, time.UTC),
+		time.Date(2116, time.January, 3, 9, 0, 0, 0, time.UTC),
+	}
+	assertOccurrenceStarts(t, expected, result)
+
+	for _, o := range result {
+		if o.Event != e || !o.End.Equal(o.Start.Add(time.Hour)) {
+			t.Errorf("unexpected occurrence %v", o)
+		}
+	}
+
+	var count int
+	for range e.Occurrences(start, time.Time{}) {
+		count++
+		if count == 1000 {
+			break
+		}
+	}
+
+	if count != 1000 {
+		t.Errorf("expected to be able to iterate without an end, got %d occurrences", count)
+	}
+}
+
+func TestEventOccurrencesRecurrenceDates(t *testing.T) {
+	start := time.Date(2016, time.January, 4, 9, 0, 0, 0, time.UTC)
+	e := &Event{
+		Start: start,
+		End:   start.Add(time.Hour),
+		RRule: "FREQ=WEEKLY;COUNT=4",
+		RDates: []time.Time{
+			time.Date(2016, time.January, 20, 9, 0, 0, 0, time.UTC),
+			time.Date(2016, time.January, 11, 9, 0, 0, 0, time.UTC),
+		},
+		ExDates: []time.Time{
+			time.Date(2016, time.January, 18, 9, 0, 0, 0, time.UTC),
+		},
+	}
+
+	var result []Occurrence
+	for o := range e.Occurrences(start, time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		result = append(result, o)
+	}
+
+	assertOccurrenceStarts(t, []time.Time{
+		time.Date(2016, time.January, 4, 9, 0, 0, 0, time.UTC),
+		time.Date(2016, time.January, 11, 9, 0, 0, 0, time.UTC),
+		time.Date(2016, time.January, 20, 9, 0, 0, 0, time.UTC),
+		time.Date(2016, time.January, 25, 9, 0, 0, 0, time.UTC),
+	}, result)
+}
+
+func TestCalendarBetween(t *testing.T) {
+	start := time.Date(2016, time.January, 4, 9, 0, 0, 0, time.UTC)
+	cal := NewCalendar()
+	cal.Events = []Event{
+		{
+			ID:      "weekly",
+			Summary: "weekly",
+			Start:   start,
+			End:     start.Add(time.Hour),
+			RRule:   "FREQ=WEEKLY",
+		},
+		{
+			ID:           "weekly",
+			Summary:      "moved",
+			Start:        time.Date(2016, time.January, 12, 15, 0, 0, 0, time.UTC),
+			End:          time.Date(2016, time.January, 12, 16, 0, 0, 0, time.UTC),
+			RecurrenceID: time.Date(2016, time.January, 11, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:           "weekly",
+			Summary:      "moved into the window",
+			Start:        time.Date(2016, time.January, 13, 15, 0, 0, 0, time.UTC),
+			End:          time.Date(2016, time.January, 13, 16, 0, 0, 0, time.UTC),
+			RecurrenceID: time.Date(2016, time.February, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:      "single",
+			Summary: "single",
+			Start:   time.Date(2016, time.January, 11, 12, 0, 0, 0, time.UTC),
+			End:     time.Date(2016, time.January, 11, 13, 0, 0, 0, time.UTC),
+		},
+	}
+
+	var summaries []string
+	for o := range cal.Between(time.Date(2016, time.January, 10, 0, 0, 0, 0, time.UTC), time.Date(2016, time.January, 19, 0, 0, 0, 0, time.UTC)) {
+		summaries = append(summaries, o.Event.Summary)
+	}
+
+	expected := []string{"single", "moved", "moved into the window", "weekly"}
+	if len(summaries) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, summaries)
+	}
+
+	for i := range expected {
+		if summaries[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, summaries)
+		}
+	}
+
+	var count int
+	for o := range cal.Between(start, time.Time{}) {
+		if o.Start.Equal(time.Date(2016, time.February, 1, 9, 0, 0, 0, time.UTC)) {
+			t.Errorf("expected overridden instance not to be returned")
+		}
+
+		count++
+		if count == 10 {
+			break
+		}
+	}
+}
+
+func TestCalendarBetweenThisAndFuture(t *testing.T) {
+	start := time.Date(2016, time.January, 4, 9, 0, 0, 0, time.UTC)
+	cal := NewCalendar()
+	cal.Events = []Event{
+		{
+			ID:    "weekly",
+			Start: start,
+			End:   start.Add(time.Hour),
+			RRule: "FREQ=WEEKLY",
+		},
+		{
+			ID:            "weekly",
+			Start:         time.Date(2016, time.January, 19, 9, 0, 0, 0, time.UTC),
+			End:           time.Date(2016, time.January, 19, 10, 0, 0, 0, time.UTC),
+			RecurrenceID:  time.Date(2016, time.January, 18, 9, 0, 0, 0, time.UTC),
+			ThisAndFuture: true,
+		},
+		{
+			ID:            "weekly",
+			Start:         time.Date(2016, time.February, 1, 8, 0, 0, 0, time.UTC),
+			End:           time.Date(2016, time.February, 1, 9, 0, 0, 0, time.UTC),
+			RecurrenceID:  time.Date(2016, time.February, 1, 9, 0, 0, 0, time.UTC),
+			ThisAndFuture: true,
+		},
+	}
+
+	var result []Occurrence
+	for o := range cal.Between(time.Date(2016, time.January, 11, 0, 0, 0, 0, time.UTC), time.Date(2016, time.February, 16, 0, 0, 0, 0, time.UTC)) {
+		result = append(result, o)
+	}
+
+	assertOccurrenceStarts(t, []time.Time{
+		time.Date(2016, time.January, 11, 9, 0, 0, 0, time.UTC),
+		time.Date(2016, time.January, 19, 9, 0, 0, 0, time.UTC),
+		time.Date(2016, time.January, 26, 9, 0, 0, 0, time.UTC),
+		time.Date(2016, time.February, 1, 8, 0, 0, 0, time.UTC),
+		time.Date(2016, time.February, 8, 8, 0, 0, 0, time.UTC),
+		time.Date(2016, time.February, 15, 8, 0, 0, 0, time.UTC),
+	}, result)
+
+	if id := result[2].RecurrenceID; !id.Equal(time.Date(2016, time.January, 25, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected shifted occurrence to keep its recurrence id, got %s", id)
+	}
+}
+
+func TestCalendarBetweenParsed(t *testing.T) {
+	calendar, err := ParseCalendar("testCalendars/repetition.ics", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loc, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.FailNow()
+	}
+
+	from := time.Date(2016, time.July, 4, 0, 0, 0, 0, loc)
+	to := time.Date(2016, time.July, 9, 0, 0, 0, 0, loc)
+	var result []Occurrence
+	for o := range calendar.Between(from, to) {
+		result = append(result, o)
+	}
+
+	assertOccurrenceStarts(t, []time.Time{time.Date(2016, time.July, 4, 10, 0, 0, 0, loc)}, result)
+}
+
+func assertOccurrenceStarts(t *testing.T, expected []time.Time, result []Occurrence) {
+	t.Helper()
+	if len(result) != len(expected) {
+		t.Fatalf("expected %d occurrences, got %d: %v", len(expected), len(result), result)
+	}
+
+	for i := range expected {
+		if !expected[i].Equal(result[i].Start) {
+			t.Errorf("expected occurrence %d to start at %s, got %s", i, expected[i], result[i].Start)
+		}
+	}
+}
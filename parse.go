@@ -1,6 +1,7 @@
 package ics
 
 import (
+	"encoding/base64"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -9,58 +10,19 @@ import (
 	"strconv"
 	"strings"
 	"time"
-)
 
-var (
-	urlRegex    = regexp.MustCompile(`https?:\/\/`)
-	eventsRegex = regexp.MustCompile(`(BEGIN:VEVENT(.*\n)*?END:VEVENT\r?\n)`)
-
-	calNameRegex     = regexp.MustCompile(`X-WR-CALNAME:.*?\n`)
-	calDescRegex     = regexp.MustCompile(`X-WR-CALDESC:.*?\n`)
-	calVersionRegex  = regexp.MustCompile(`VERSION:.*?\n`)
-	calTimezoneRegex = regexp.MustCompile(`X-WR-TIMEZONE:.*?\n`)
-
-	eventSummaryRegex      = regexp.MustCompile(`SUMMARY:.*?\n`)
-	eventStatusRegex       = regexp.MustCompile(`STATUS:.*?\n`)
-	eventDescRegex         = regexp.MustCompile(`DESCRIPTION:.*?\n`)
-	eventUIDRegex          = regexp.MustCompile(`UID:.*?\n`)
-	eventClassRegex        = regexp.MustCompile(`CLASS:.*?\n`)
-	eventSequenceRegex     = regexp.MustCompile(`SEQUENCE:.*?\n`)
-	eventCreatedRegex      = regexp.MustCompile(`CREATED:.*?\n`)
-	eventModifiedRegex     = regexp.MustCompile(`LAST-MODIFIED:.*?\n`)
-	eventRecurrenceIDRegex = regexp.MustCompile(`RECURRENCE-ID(;TZID=.*?){0,1}:.*?\n`)
-	eventDateRegex         = regexp.MustCompile(`(DTSTART|DTEND).+\n`)
-	eventTimeRegex         = regexp.MustCompile(`(DTSTART|DTEND)(;TZID=.*?){0,1}:.*?\n`)
-	eventWholeDayRegex     = regexp.MustCompile(`(DTSTART|DTEND);VALUE=DATE:.*?\n`)
-	eventEndRegex          = regexp.MustCompile(`DTEND(;TZID=.*?){0,1}:.*?\n`)
-	eventEndWholeDayRegex  = regexp.MustCompile(`DTEND;VALUE=DATE:.*?\n`)
-	eventRRuleRegex        = regexp.MustCompile(`RRULE:.*?\n`)
-	eventLocationRegex     = regexp.MustCompile(`LOCATION:.*?\n`)
-	eventExDateRegex       = regexp.MustCompile(`EXDATE;TZID=(.*):(.*)\n`)
-
-	attendeesRegex = regexp.MustCompile(`ATTENDEE(:|;)(.*?\r?\n)(\s.*?\r?\n)*`)
-	organizerRegex = regexp.MustCompile(`ORGANIZER(:|;)(.*?\r?\n)(\s.*?\r?\n)*`)
-
-	attendeeEmailRegex  = regexp.MustCompile(`mailto:.*?\n`)
-	attendeeStatusRegex = regexp.MustCompile(`PARTSTAT=.*?;`)
-	attendeeRoleRegex   = regexp.MustCompile(`ROLE=.*?;`)
-	attendeeNameRegex   = regexp.MustCompile(`CN=.*?;`)
-	organizerNameRegex  = regexp.MustCompile(`CN=.*?:`)
-	attendeeTypeRegex   = regexp.MustCompile(`CUTYPE=.*?;`)
-
-	untilRegex    = regexp.MustCompile(`UNTIL=(\d)*T(\d)*Z(;){0,1}`)
-	intervalRegex = regexp.MustCompile(`INTERVAL=(\d)*(;){0,1}`)
-	countRegex    = regexp.MustCompile(`COUNT=(\d)*(;){0,1}`)
-	freqRegex     = regexp.MustCompile(`FREQ=.*?;`)
-	byMonthRegex  = regexp.MustCompile(`BYMONTH=.*?;`)
-	byDayRegex    = regexp.MustCompile(`BYDAY=.*?(;|){0,1}\z`)
+	"github.com/erizocosmico/go-ics/recurrence"
 )
 
+var urlRegex = regexp.MustCompile(`https?:\/\/`)
+
 // ParseCalendar parses the calendar in the given url (can be a local path)
 // and returns the parsed calendar with its events. If maxRepeats is greater
 // than 0 new events will be added if an event has a repetition rule up to
 // maxRepeats. If you pass a non-nil io.Writer the contents of the ics file
-// will also be written to that writer.
+// will also be written to that writer. To get the occurrences of repeating
+// events without adding them to the calendar, pass 0 as maxRepeats and use
+// Calendar.Between instead.
 func ParseCalendar(url string, maxRepeats int, w io.Writer) (Calendar, error) {
 	content, err := getICal(url)
 	if err != nil {
@@ -103,15 +65,45 @@ func getICal(url string) (string, error) {
 	return content, nil
 }
 
+// ParseICalContent parses the given ics content and returns the calendar
+// with its events. See ParseCalendar for the meaning of maxRepeats.
 func ParseICalContent(content, url string, maxRepeats int) (Calendar, error) {
 	cal := NewCalendar()
-	eventsData, info := explodeICal(content)
-	cal.Name = parseICalName(info)
-	cal.Description = parseICalDesc(info)
-	cal.Version = parseICalVersion(info)
-	cal.Timezone = parseICalTimezone(info)
+	comp, err := decodeCalendar(content)
+	if err != nil {
+		return cal, err
+	}
+
+	cal.Component = comp
+	cal.Name = parseICalName(comp)
+	cal.Description = parseICalDesc(comp)
+	cal.Version = parseICalVersion(comp)
+	cal.Method = strings.ToUpper(comp.Value("METHOD"))
+	cal.Timezones, cal.TimezoneErrors = parseTimezones(comp)
+	cal.Timezone = parseICalTimezone(comp, cal.Timezones)
 	cal.URL = url
-	err := parseEvents(&cal, eventsData, maxRepeats)
+	comp.typed = calendarHeader(&cal)
+	err = parseEvents(&cal, comp.ChildrenNamed("VEVENT"), maxRepeats)
+	if err != nil {
+		return cal, err
+	}
+
+	err = parseTodos(&cal, comp.ChildrenNamed("VTODO"))
+	if err != nil {
+		return cal, err
+	}
+
+	err = parseJournals(&cal, comp.ChildrenNamed("VJOURNAL"))
+	if err != nil {
+		return cal, err
+	}
+
+	err = parseFreeBusies(&cal, comp.ChildrenNamed("VFREEBUSY"))
+	if err != nil {
+		return cal, err
+	}
+
+	err = parseAvailabilities(&cal, comp.ChildrenNamed("VAVAILABILITY"))
 	if err != nil {
 		return cal, err
 	}
@@ -119,28 +111,39 @@ func ParseICalContent(content, url string, maxRepeats int) (Calendar, error) {
 	return cal, nil
 }
 
-func explodeICal(content string) ([]string, string) {
-	events := eventsRegex.FindAllString(content, -1)
-	info := eventsRegex.ReplaceAllString(content, "")
-	return events, info
+// decodeCalendar returns the first VCALENDAR component in the content.
+func decodeCalendar(content string) (*Component, error) {
+	dec := NewDecoder(strings.NewReader(content))
+	for {
+		comp, err := dec.Decode()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no VCALENDAR component found")
+		} else if err != nil {
+			return nil, err
+		}
+
+		if comp.Name == "VCALENDAR" {
+			return comp, nil
+		}
+	}
 }
 
-func parseICalName(content string) string {
-	return trimField(calNameRegex.FindString(content), "X-WR-CALNAME:")
+func parseICalName(info *Component) string {
+	return unescapeText(info.Value("X-WR-CALNAME"))
 }
 
-func parseICalDesc(content string) string {
-	return trimField(calDescRegex.FindString(content), "X-WR-CALDESC:")
+func parseICalDesc(info *Component) string {
+	return unescapeText(info.Value("X-WR-CALDESC"))
 }
 
-func parseICalVersion(content string) float64 {
-	version, _ := strconv.ParseFloat(trimField(calVersionRegex.FindString(content), "VERSION:"), 64)
+func parseICalVersion(info *Component) float64 {
+	version, _ := strconv.ParseFloat(info.Value("VERSION"), 64)
 	return version
 }
 
-func parseICalTimezone(content string) *time.Location {
-	timezone := trimField(calTimezoneRegex.FindString(content), "X-WR-TIMEZONE:")
-	loc, err := time.LoadLocation(timezone)
+func parseICalTimezone(info *Component, tz Timezones) *time.Location {
+	timezone := info.Value("X-WR-TIMEZONE")
+	loc, err := tz.Location(timezone)
 	if err != nil {
 		return time.Local
 	}
@@ -171,369 +174,482 @@ OuterLoop:
 	return result
 }
 
-func parseEvents(cal *Calendar, eventsData []string, maxRepeats int) error {
+// defaultEnd returns the end of the events that start at the given time
+// and have neither DTEND nor DURATION, which is the end of their day.
+func defaultEnd(start time.Time) time.Time {
+	return time.Date(start.Year(), start.Month(), start.Day(), 23, 59, 59, 0, start.Location())
+}
+
+func parseEvents(cal *Calendar, eventsData []*Component, maxRepeats int) error {
 	var excluded []Event
 	for _, eventData := range eventsData {
+		var err error
 		event := NewEvent()
+		event.Component = eventData
 
-		start, err := parseEventDate("DTSTART", eventData)
+		event.DTStart, err = parseDateProperty("DTSTART", eventData, cal.Timezones)
 		if err != nil {
 			return err
 		}
 
-		end, err := parseEventDate("DTEND", eventData)
+		event.DTEnd, err = parseDateProperty("DTEND", eventData, cal.Timezones)
 		if err != nil {
 			return err
 		}
 
-		if end.IsZero() {
-			end = time.Date(start.Year(), start.Month(), start.Day(), 23, 59, 59, 0, start.Location())
+		start := event.DTStart.In(cal.Timezone)
+		end := event.DTEnd.In(cal.Timezone)
+		if v := eventData.Value("DURATION"); v != "" {
+			if !end.IsZero() {
+				return fmt.Errorf("event %s with both DTEND and DURATION", parseUID(eventData))
+			}
+
+			event.Duration, err = parseDuration(v)
+			if err != nil {
+				return err
+			}
+			end = start.Add(event.Duration)
 		}
 
-		wholeDay := start.Hour() == 0 && end.Hour() == 0 && start.Minute() == 0 && end.Minute() == 0 && start.Second() == 0 && end.Second() == 0
+		if end.IsZero() {
+			end = defaultEnd(start)
+		}
 
-		event.Status = parseEventStatus(eventData)
-		event.Summary = parseEventSummary(eventData)
-		event.Description = parseEventDescription(eventData)
-		event.ID = parseEventID(eventData)
-		event.Class = parseEventClass(eventData)
-		event.Sequence = parseEventSequence(eventData)
-		event.Created = parseEventCreated(eventData)
-		event.Modified = parseEventModified(eventData)
-		event.RRule = parseEventRRule(eventData)
-		exclusions, err := parseExcludedDates(eventData)
+		event.Status = parseStatus(eventData)
+		event.Summary = parseSummary(eventData)
+		event.Description = parseDescription(eventData)
+		event.ID = parseUID(eventData)
+		event.Class = parseClass(eventData)
+		event.Sequence = parseSequence(eventData)
+		event.Created = parseCreated(eventData)
+		event.Modified = parseModified(eventData)
+		event.RRule = parseRRule(eventData)
+		exclusions, err := parseExcludedDates(eventData, cal.Timezones)
+		if err != nil {
+			return err
+		}
+		event.ExDates = resolveDates(exclusions, cal.Timezone)
+		rdates, err := parseRecurrenceDates(eventData, cal.Timezones)
 		if err != nil {
 			return err
 		}
-		event.RecurrenceID, err = parseEventRecurrenceID(eventData)
+		event.RDates = resolveDates(rdates, cal.Timezone)
+		recurrenceID, err := parseRecurrenceID(eventData, cal.Timezones)
 		if err != nil {
 			return err
 		}
+		event.RecurrenceID = recurrenceID.In(cal.Timezone)
+		event.ThisAndFuture = parseRecurrenceRange(eventData) == "THISANDFUTURE"
 
-		event.Location = parseEventLocation(eventData)
+		event.Location = parseLocation(eventData)
 		event.Start = start
 		event.End = end
-		event.WholeDayEvent = wholeDay
-		event.Attendees = parseEventAttendees(eventData)
-		event.Organizer = parseEventOrganizer(eventData)
+		event.WholeDayEvent = event.DTStart.Kind == Date
+		event.Transparent = strings.EqualFold(eventData.Value("TRANSP"), "TRANSPARENT")
+		event.Attendees = parseAttendees(eventData)
+		event.Organizer = parseOrganizer(eventData)
+		event.Alarms, err = parseAlarms(eventData, cal.Timezones)
+		if err != nil {
+			return err
+		}
+		event.AlarmTime = alarmTime(event.Alarms)
+		eventData.typed = eventComponent(event)
 		duration := end.Sub(start)
 		cal.Events = append(cal.Events, *event)
 
 		if maxRepeats > 0 && event.RRule != "" {
-			until := parseUntil(event.RRule)
-			interval := parseInterval(event.RRule)
-			count := parseCount(event.RRule, maxRepeats)
-			freq := trimField(freqRegex.FindString(event.RRule), `(FREQ=|;)`)
-			byMonth := trimField(byMonthRegex.FindString(event.RRule), `(BYMONTH=|;)`)
-			byDay := trimField(byDayRegex.FindString(event.RRule), `(BYDAY=|;)`)
-
-			var years, days, months int
-
-			switch freq {
-			case "DAILY":
-				days = interval
-			case "WEEKLY":
-				days = 7
-			case "MONTHLY":
-				months = interval
-			case "YEARLY":
-				years = interval
+			rule, err := recurrence.Parse(event.RRule, event.Start)
+			if err != nil {
+				// events with rules that can not be parsed are kept without
+				// repetitions, as Event.Occurrences does
+				continue
 			}
 
-			current := 0
-			freqDate := event.Start
-
-			for {
-				weekDays := freqDate
-				commitEvent := func() {
-					current++
-					count--
-					newEvent := event.Clone()
-					newEvent.Start = weekDays
-					newEvent.End = weekDays.Add(duration)
-					newEvent.Sequence = current
-
-					for _, e := range exclusions {
-						if e.Equal(weekDays) {
-							excluded = append(excluded, *newEvent)
-							return
-						}
-					}
-
-					if until.IsZero() || (!until.IsZero() && (until.After(weekDays) || until.Equal(weekDays))) {
-						cal.Events = append(cal.Events, *newEvent)
-					}
+			it := rule.Iterator()
+			// the first occurrence is the event itself
+			it.Next()
+			for current := 1; current <= maxRepeats; current++ {
+				t, ok := it.Next()
+				if !ok {
+					break
 				}
 
-				if byMonth == "" || strings.Contains(byMonth, weekDays.Format("1")) {
-					if byDay != "" {
-						for i := 0; i < 7; i++ {
-							day := parseDayNameToIcsName(weekDays.Format("Mon"))
-							if strings.Contains(byDay, day) && weekDays != event.Start {
-								commitEvent()
-							}
-							weekDays = weekDays.AddDate(0, 0, 1)
-						}
-					} else {
-						if weekDays != event.Start {
-							commitEvent()
-						}
-					}
-				}
+				newEvent := event.Clone()
+				newEvent.Start = t
+				newEvent.End = t.Add(duration)
+				newEvent.Repetition = current
 
-				freqDate = freqDate.AddDate(years, months, days)
-				if current > maxRepeats || count == 0 {
-					break
+				if isExcluded(t, event.ExDates) {
+					excluded = append(excluded, *newEvent)
+					continue
 				}
 
-				if !until.IsZero() && (until.Before(freqDate) || until.Equal(freqDate)) {
-					break
-				}
+				cal.Events = append(cal.Events, *newEvent)
 			}
 		}
 	}
 
 	sort.Sort(byDate(cal.Events))
-	cal.Events = diff(ExcludeRecurrences(cal.Events), excluded)
+	if maxRepeats > 0 {
+		// overrides are only applied to the generated repetitions, as
+		// otherwise the events they belong to could be removed
+		cal.Events = diff(ExcludeRecurrences(cal.Events), excluded)
+	}
 
 	return nil
 }
 
-func parseEventSummary(eventData string) string {
-	return trimField(eventSummaryRegex.FindString(eventData), "SUMMARY:")
-}
+// parseTodos parses the given VTODO components. Unlike events, repeating
+// todos are never expanded, their occurrences are given by
+// Todo.Occurrences.
+func parseTodos(cal *Calendar, todosData []*Component) error {
+	for _, todoData := range todosData {
+		var err error
+		todo := NewTodo()
+		todo.Component = todoData
 
-func parseEventStatus(eventData string) string {
-	return trimField(eventStatusRegex.FindString(eventData), "STATUS:")
-}
+		todo.DTStart, err = parseDateProperty("DTSTART", todoData, cal.Timezones)
+		if err != nil {
+			return err
+		}
 
-func parseEventDescription(eventData string) string {
-	return trimField(eventDescRegex.FindString(eventData), "DESCRIPTION:")
-}
+		todo.DTDue, err = parseDateProperty("DUE", todoData, cal.Timezones)
+		if err != nil {
+			return err
+		}
 
-func parseEventID(eventData string) string {
-	return trimField(eventUIDRegex.FindString(eventData), "DSTAMP:")
-}
+		completed, err := parseDateProperty("COMPLETED", todoData, cal.Timezones)
+		if err != nil {
+			return err
+		}
 
-func parseEventClass(eventData string) string {
-	return trimField(eventClassRegex.FindString(eventData), "CLASS:")
-}
+		exclusions, err := parseExcludedDates(todoData, cal.Timezones)
+		if err != nil {
+			return err
+		}
 
-func parseEventSequence(eventData string) int {
-	seq, _ := strconv.Atoi(trimField(eventSequenceRegex.FindString(eventData), "SEQUENCE:"))
-	return seq
+		rdates, err := parseRecurrenceDates(todoData, cal.Timezones)
+		if err != nil {
+			return err
+		}
+
+		recurrenceID, err := parseRecurrenceID(todoData, cal.Timezones)
+		if err != nil {
+			return err
+		}
+
+		todo.Start = todo.DTStart.In(cal.Timezone)
+		todo.Due = todo.DTDue.In(cal.Timezone)
+		todo.Completed = completed.In(cal.Timezone)
+		todo.ExDates = resolveDates(exclusions, cal.Timezone)
+		todo.RDates = resolveDates(rdates, cal.Timezone)
+		todo.RecurrenceID = recurrenceID.In(cal.Timezone)
+		todo.Status = parseStatus(todoData)
+		todo.Summary = parseSummary(todoData)
+		todo.Description = parseDescription(todoData)
+		todo.Location = parseLocation(todoData)
+		todo.ID = parseUID(todoData)
+		todo.Class = parseClass(todoData)
+		todo.Sequence = parseSequence(todoData)
+		todo.Created = parseCreated(todoData)
+		todo.Modified = parseModified(todoData)
+		todo.RRule = parseRRule(todoData)
+		todo.PercentComplete = parseTodoPercentComplete(todoData)
+		todo.Priority = parseTodoPriority(todoData)
+		todo.Attendees = parseAttendees(todoData)
+		todo.Organizer = parseOrganizer(todoData)
+		todo.Alarms, err = parseAlarms(todoData, cal.Timezones)
+		if err != nil {
+			return err
+		}
+		todoData.typed = todoComponent(todo)
+		cal.Todos = append(cal.Todos, *todo)
+	}
+
+	return nil
 }
 
-func parseEventCreated(eventData string) time.Time {
-	created := trimField(eventCreatedRegex.FindString(eventData), "CREATED:")
-	t, _ := time.Parse(icsFormat, created)
-	return t
+func parseTodoPercentComplete(todoData *Component) int {
+	percent, _ := strconv.Atoi(todoData.Value("PERCENT-COMPLETE"))
+	return percent
 }
 
-func parseEventModified(eventData string) time.Time {
-	date := trimField(eventModifiedRegex.FindString(eventData), "LAST-MODIFIED:")
-	t, _ := time.Parse(icsFormat, date)
-	return t
+func parseTodoPriority(todoData *Component) int {
+	priority, _ := strconv.Atoi(todoData.Value("PRIORITY"))
+	return priority
 }
 
-func parseEventRecurrenceID(eventData string) (time.Time, error) {
-	rec := eventRecurrenceIDRegex.FindString(eventData)
-	if rec == "" {
-		return time.Time{}, nil
-	}
+// parseJournals parses the given VJOURNAL components. Like todos, repeating
+// journals are never expanded.
+func parseJournals(cal *Calendar, journalsData []*Component) error {
+	for _, journalData := range journalsData {
+		var err error
+		journal := NewJournal()
+		journal.Component = journalData
 
-	return parseDatetime(rec)
-}
+		journal.DTStart, err = parseDateProperty("DTSTART", journalData, cal.Timezones)
+		if err != nil {
+			return err
+		}
 
-func parseEventDate(start, eventData string) (time.Time, error) {
-	ts := eventDateRegex.FindAllString(eventData, -1)
-	t := findWithStart(start, ts)
-	tWholeDay := eventWholeDayRegex.FindString(t)
-	if tWholeDay != "" {
-		return parseDate(strings.TrimSpace(tWholeDay))
-	}
+		exclusions, err := parseExcludedDates(journalData, cal.Timezones)
+		if err != nil {
+			return err
+		}
 
-	if t == "" {
-		return time.Time{}, nil
-	}
+		rdates, err := parseRecurrenceDates(journalData, cal.Timezones)
+		if err != nil {
+			return err
+		}
 
-	return parseDatetime(t)
-}
+		recurrenceID, err := parseRecurrenceID(journalData, cal.Timezones)
+		if err != nil {
+			return err
+		}
 
-func findWithStart(start string, list []string) string {
-	for _, t := range list {
-		if strings.HasPrefix(t, start) {
-			return t
+		journal.Attachments, err = parseAttachments(journalData)
+		if err != nil {
+			return err
 		}
+
+		journal.Start = journal.DTStart.In(cal.Timezone)
+		journal.ExDates = resolveDates(exclusions, cal.Timezone)
+		journal.RDates = resolveDates(rdates, cal.Timezone)
+		journal.RecurrenceID = recurrenceID.In(cal.Timezone)
+		journal.Status = parseStatus(journalData)
+		journal.Summary = parseSummary(journalData)
+		journal.Descriptions = parseJournalDescriptions(journalData)
+		journal.Categories = parseCategories(journalData)
+		journal.ID = parseUID(journalData)
+		journal.Class = parseClass(journalData)
+		journal.Sequence = parseSequence(journalData)
+		journal.Created = parseCreated(journalData)
+		journal.Modified = parseModified(journalData)
+		journal.RRule = parseRRule(journalData)
+		journal.Attendees = parseAttendees(journalData)
+		journal.Organizer = parseOrganizer(journalData)
+		journalData.typed = journalComponent(journal)
+		cal.Journals = append(cal.Journals, *journal)
 	}
 
-	return ""
+	return nil
 }
 
-func parseDatetime(data string) (time.Time, error) {
-	data = strings.TrimSpace(data)
-	var dataTz string
-	timeString := data
-	if strings.Contains(data, ":") {
-		dataParts := strings.Split(data, ":")
-		dataTz = dataParts[0]
-		timeString = dataParts[1]
+func parseJournalDescriptions(journalData *Component) []string {
+	var descriptions []string
+	for _, prop := range journalData.PropertiesNamed("DESCRIPTION") {
+		descriptions = append(descriptions, unescapeText(prop.Value))
 	}
+	return descriptions
+}
 
-	if !strings.Contains(timeString, "Z") {
-		timeString = timeString + "Z"
+// parseCategories returns the categories of all the CATEGORIES properties
+// of the component.
+func parseCategories(data *Component) []string {
+	var categories []string
+	for _, prop := range data.PropertiesNamed("CATEGORIES") {
+		categories = append(categories, splitText(prop.Value)...)
 	}
+	return categories
+}
 
-	t, err := time.Parse(icsFormat, timeString)
-	if err != nil {
-		return t, err
-	}
+// splitText splits a list of TEXT values by the commas that are not
+// escaped and unescapes them.
+func splitText(value string) []string {
+	var (
+		result []string
+		start  int
+	)
 
-	if strings.Contains(dataTz, "TZID") {
-		location := strings.Split(dataTz, "=")[1]
-		timezone, err := time.LoadLocation(location)
-		if err != nil {
-			return t, err
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			result = append(result, unescapeText(value[start:i]))
+			start = i + 1
 		}
-
-		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), timezone), nil
 	}
 
-	return t, nil
+	return append(result, unescapeText(value[start:]))
 }
 
-func parseDate(data string) (time.Time, error) {
-	return parseDatetime(data + "T000000")
-}
-
-func parseEventRRule(eventData string) string {
-	return trimField(eventRRuleRegex.FindString(eventData), "RRULE:")
+func parseAttachments(data *Component) ([]Attachment, error) {
+	var attachments []Attachment
+	for _, prop := range data.PropertiesNamed("ATTACH") {
+		attachment := Attachment{FormatType: prop.Params.Get("FMTTYPE")}
+		if strings.EqualFold(prop.Params.Get("ENCODING"), "BASE64") {
+			var err error
+			attachment.Data, err = base64.StdEncoding.DecodeString(prop.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ATTACH value: %s", err)
+			}
+		} else {
+			attachment.URI = prop.Value
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
 }
 
-func parseExcludedDates(eventData string) ([]time.Time, error) {
-	var dates []time.Time
-	excl := eventExDateRegex.FindAllStringSubmatch(eventData, -1)
+// The following functions parse the properties that components of any
+// kind, such as VEVENT, VTODO, VJOURNAL, VFREEBUSY or VAVAILABILITY, have
+// in common.
 
-	for _, e := range excl {
-		if len(e) < 3 {
-			continue
-		}
+func parseSummary(comp *Component) string {
+	return unescapeText(comp.Value("SUMMARY"))
+}
 
-		tz, err := time.LoadLocation(e[1])
-		if err != nil {
-			return nil, err
-		}
+func parseStatus(comp *Component) string {
+	return comp.Value("STATUS")
+}
 
-		dt := strings.TrimSpace(e[2])
-		if !strings.Contains(dt, "Z") {
-			dt += "Z"
-		}
+func parseDescription(comp *Component) string {
+	return unescapeText(comp.Value("DESCRIPTION"))
+}
 
-		t, err := time.Parse(icsFormat, dt)
-		if err != nil {
-			return nil, err
-		}
+func parseUID(comp *Component) string {
+	return comp.Value("UID")
+}
 
-		dates = append(dates, time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), tz))
-	}
+func parseClass(comp *Component) string {
+	return comp.Value("CLASS")
+}
 
-	return dates, nil
+func parseSequence(comp *Component) int {
+	seq, _ := strconv.Atoi(comp.Value("SEQUENCE"))
+	return seq
 }
 
-func parseEventLocation(eventData string) string {
-	return trimField(eventLocationRegex.FindString(eventData), "LOCATION:")
+func parseCreated(comp *Component) time.Time {
+	t, _ := time.Parse(icsFormat, comp.Value("CREATED"))
+	return t
 }
 
-func parseEventAttendees(eventData string) []Attendee {
-	attendeesList := []Attendee{}
-	attendees := attendeesRegex.FindAllString(eventData, -1)
+func parseModified(comp *Component) time.Time {
+	t, _ := time.Parse(icsFormat, comp.Value("LAST-MODIFIED"))
+	return t
+}
 
-	for _, a := range attendees {
-		if a == "" {
-			continue
-		}
-		attendee := parseAttendee(strings.Replace(strings.Replace(a, "\r", "", 1), "\n ", "", 1))
-		if attendee.Email != "" || attendee.Name != "" {
-			attendeesList = append(attendeesList, attendee)
-		}
+func parseRecurrenceID(comp *Component, tz Timezones) (DateTime, error) {
+	rec := comp.Property("RECURRENCE-ID")
+	if rec == nil {
+		return DateTime{}, nil
 	}
 
-	return attendeesList
+	return parsePropertyDateTime(rec, rec.Value, tz)
 }
 
-func parseEventOrganizer(eventData string) Attendee {
-	organizer := organizerRegex.FindString(eventData)
-	if organizer == "" {
-		return Attendee{}
+func parseRecurrenceRange(comp *Component) string {
+	if rec := comp.Property("RECURRENCE-ID"); rec != nil {
+		return strings.ToUpper(rec.Params.Get("RANGE"))
 	}
+	return ""
+}
 
-	organizer = strings.Replace(strings.Replace(organizer, "\r", "", 1), "\n ", "", 1)
-	return Attendee{
-		Email: parseAttendeeMail(organizer),
-		Name:  parseOrganizerName(organizer),
+func parseDateProperty(name string, comp *Component, tz Timezones) (DateTime, error) {
+	prop := comp.Property(name)
+	if prop == nil {
+		return DateTime{}, nil
 	}
+
+	return parsePropertyDateTime(prop, prop.Value, tz)
 }
 
-func parseAttendee(data string) Attendee {
-	return Attendee{
-		Email:  parseAttendeeMail(data),
-		Name:   parseAttendeeName(data),
-		Role:   parseAttendeeRole(data),
-		Status: parseAttendeeStatus(data),
-		Type:   parseAttendeeType(data),
-	}
+func parseDate(data string) (time.Time, error) {
+	return time.Parse(icsFormatWholeDay, data)
 }
 
-func parseAttendeeMail(attendeeData string) string {
-	return trimField(attendeeEmailRegex.FindString(attendeeData), "mailto:")
+func parseRRule(comp *Component) string {
+	return comp.Value("RRULE")
 }
 
-func parseAttendeeStatus(attendeeData string) string {
-	return trimField(attendeeStatusRegex.FindString(attendeeData), `(PARTSTAT=|;)`)
+func parseExcludedDates(comp *Component, tz Timezones) ([]DateTime, error) {
+	return parseDateList(comp, "EXDATE", tz)
 }
 
-func parseAttendeeRole(attendeeData string) string {
-	return trimField(attendeeRoleRegex.FindString(attendeeData), `(ROLE=|;)`)
+func parseRecurrenceDates(comp *Component, tz Timezones) ([]DateTime, error) {
+	return parseDateList(comp, "RDATE", tz)
 }
 
-func parseAttendeeName(attendeeData string) string {
-	return trimField(attendeeNameRegex.FindString(attendeeData), `(CN=|;)`)
+// parseDateList parses all the values of all the properties with the given
+// name. Only the start of PERIOD values is kept.
+func parseDateList(comp *Component, name string, tz Timezones) ([]DateTime, error) {
+	var dates []DateTime
+	for _, prop := range comp.PropertiesNamed(name) {
+		for _, v := range strings.Split(prop.Value, ",") {
+			if i := strings.IndexByte(v, '/'); i >= 0 {
+				v = v[:i]
+			}
+
+			t, err := parsePropertyDateTime(prop, v, tz)
+			if err != nil {
+				return nil, err
+			}
+			dates = append(dates, t)
+		}
+	}
+
+	return dates, nil
 }
 
-func parseOrganizerName(orgData string) string {
-	return trimField(organizerNameRegex.FindString(orgData), `(CN=|:)`)
+func isExcluded(t time.Time, exclusions []time.Time) bool {
+	for _, e := range exclusions {
+		if e.Equal(t) {
+			return true
+		}
+	}
+	return false
 }
 
-func parseAttendeeType(attendeeData string) string {
-	return trimField(attendeeTypeRegex.FindString(attendeeData), `(CUTYPE=|;)`)
+func parseLocation(comp *Component) string {
+	return unescapeText(comp.Value("LOCATION"))
 }
 
-func parseUntil(rrule string) time.Time {
-	until := trimField(untilRegex.FindString(rrule), `(UNTIL=|;)`)
-	var t time.Time
-	if until == "" {
-	} else {
-		t, _ = time.Parse(icsFormat, until)
+func parseAttendees(comp *Component) []Attendee {
+	attendeesList := []Attendee{}
+	for _, prop := range comp.PropertiesNamed("ATTENDEE") {
+		attendee := parseAttendee(prop)
+		if attendee.Email != "" || attendee.Name != "" {
+			attendeesList = append(attendeesList, attendee)
+		}
 	}
-	return t
+
+	return attendeesList
 }
 
-func parseInterval(rrule string) int {
-	interval := trimField(intervalRegex.FindString(rrule), `(INTERVAL=|;)`)
-	i, _ := strconv.Atoi(interval)
-	if i == 0 {
-		i = 1
+func parseOrganizer(comp *Component) Attendee {
+	organizer := comp.Property("ORGANIZER")
+	if organizer == nil {
+		return Attendee{}
 	}
 
-	return i
+	return Attendee{
+		Email: parseAttendeeMail(organizer),
+		Name:  organizer.Params.Get("CN"),
+	}
 }
 
-func parseCount(rrule string, maxRepeats int) int {
-	c := trimField(countRegex.FindString(rrule), `(COUNT=|;)`)
-	count, _ := strconv.Atoi(c)
-	if count == 0 {
-		count = maxRepeats
+func parseAttendee(prop *Property) Attendee {
+	a := Attendee{
+		Email:  parseAttendeeMail(prop),
+		Name:   prop.Params.Get("CN"),
+		Role:   prop.Params.Get("ROLE"),
+		Status: prop.Params.Get("PARTSTAT"),
+		Type:   prop.Params.Get("CUTYPE"),
 	}
 
-	return count
+	for _, param := range prop.Params {
+		if !attendeeParams[strings.ToUpper(param.Name)] {
+			a.Params = append(a.Params, param)
+		}
+	}
+	return a
+}
+
+func parseAttendeeMail(prop *Property) string {
+	if len(prop.Value) >= len("mailto:") && strings.EqualFold(prop.Value[:len("mailto:")], "mailto:") {
+		return prop.Value[len("mailto:"):]
+	}
+	return ""
 }
@@ -1,6 +1,8 @@
 package ics
 
 import (
+	"io"
+	"strings"
 	"testing"
 	"time"
 )
@@ -49,13 +51,125 @@ func TestParseSplitEventExclusion(t *testing.T) {
 	}
 }
 
+func TestParseRecurringEventsInterval(t *testing.T) {
+	calendar, err := ParseCalendar("testCalendars/repetition.ics", 1000, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []Event
+	for _, e := range calendar.Events {
+		d := time.Date(2016, time.July, 4, 0, 0, 0, 0, e.Start.Location())
+		d2 := time.Date(2016, time.July, 9, 0, 0, 0, 0, e.Start.Location())
+		if e.Start.After(d) && e.Start.Before(d2) {
+			events = append(events, e)
+		}
+	}
+
+	// only the second event repeats on that week, and all but the monday
+	// are excluded
+	if len(events) != 1 || events[0].Start.Weekday() != time.Monday {
+		t.Errorf("expected %d event on monday, got %v", 1, events)
+	}
+}
+
+func TestParseRepetitions(t *testing.T) {
+	calendar, err := ParseICalContent(strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"UID:daily@example.com",
+		"DTSTART:20240101T100000Z",
+		"DTEND:20240101T110000Z",
+		"RRULE:FREQ=DAILY;COUNT=3",
+		"SEQUENCE:2",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:invalid@example.com",
+		"DTSTART:20240101T100000Z",
+		"DTEND:20240101T110000Z",
+		"RRULE:FREQ=DAILY;COUNT=3;UNTIL=20240105T000000Z",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n"), "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var daily, invalid []Event
+	for _, e := range calendar.Events {
+		if e.ID == "daily@example.com" {
+			daily = append(daily, e)
+		} else {
+			invalid = append(invalid, e)
+		}
+	}
+
+	if len(daily) != 3 {
+		t.Fatalf("expected 3 repetitions, got %d", len(daily))
+	}
+
+	for i, e := range daily {
+		if e.Sequence != 2 || e.Repetition != i {
+			t.Errorf("expected repetition %d with the sequence of the event, got %d with %d", i, e.Repetition, e.Sequence)
+		}
+	}
+
+	// rules that can not be parsed do not expand the event
+	if len(invalid) != 1 {
+		t.Errorf("expected event with an invalid rule to be kept, got %v", invalid)
+	}
+}
+
+func TestParseEventDuration(t *testing.T) {
+	content := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:duration@example.com",
+		"DTSTART:20160704T100000Z",
+		"DURATION:PT1H30M",
+		"RRULE:FREQ=DAILY;COUNT=2",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	cal, err := ParseICalContent(content, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := cal.Events[0]
+	if e.Duration != 90*time.Minute || !e.End.Equal(time.Date(2016, time.July, 4, 11, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected end %s and duration %s", e.End, e.Duration)
+	}
+
+	var ends []time.Time
+	for o := range e.Occurrences(time.Time{}, time.Time{}) {
+		ends = append(ends, o.End)
+	}
+
+	if len(ends) != 2 || !ends[1].Equal(time.Date(2016, time.July, 5, 11, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected ends of the occurrences %v", ends)
+	}
+
+	fb := cal.FreeBusy(time.Date(2016, time.July, 5, 0, 0, 0, 0, time.UTC), time.Date(2016, time.July, 6, 0, 0, 0, 0, time.UTC))
+	expected := []Period{{time.Date(2016, time.July, 5, 10, 0, 0, 0, time.UTC), time.Date(2016, time.July, 5, 11, 30, 0, 0, time.UTC), FreeBusyBusy}}
+	assertPeriodsEqual(t, expected, fb.Periods)
+
+	both := strings.Replace(content, "DURATION:PT1H30M", "DTEND:20160704T110000Z\r\nDURATION:PT1H30M", 1)
+	if _, err := ParseICalContent(both, "", 0); err == nil {
+		t.Errorf("expected an error parsing an event with both DTEND and DURATION")
+	}
+}
+
 func TestCalendarEvents(t *testing.T) {
 	calendar, err := ParseCalendar("testCalendars/2eventsCal.ics", 1000, nil)
 	if err != nil {
 		t.Errorf("Failed to parse the calendar ( %s ) \n", err.Error())
 	}
-	tz, err := time.LoadLocation("Europe/Madrid")
-	if err != nil {
+	// the calendar defines its own Europe/Madrid timezone
+	tz := calendar.Timezones["Europe/Madrid"]
+	if tz == nil {
 		t.FailNow()
 	}
 
@@ -65,7 +179,7 @@ func TestCalendarEvents(t *testing.T) {
 	created, _ := time.Parse(icsFormat, "20140515T075711Z")
 	modified, _ := time.Parse(icsFormat, "20141125T074253Z")
 	location := "In The Office"
-	desc := "1. Report on previous weekly tasks. \\n2. Plan of the present weekly tasks."
+	desc := "1. Report on previous weekly tasks. \n2. Plan of the present weekly tasks."
 	seq := 1
 	status := "CONFIRMED"
 	summary := "General Operative Meeting"
@@ -117,53 +231,147 @@ func TestCalendarEvents(t *testing.T) {
 	}
 }
 
-func TestParseEventDate(t *testing.T) {
+func TestParseDateProperty(t *testing.T) {
 	loc, err := time.LoadLocation("Europe/Madrid")
 	if err != nil {
 		t.FailNow()
 	}
 
 	expected := time.Date(2015, time.Month(9), 30, 15, 0, 0, 0, loc)
-	dataStart := "DTSTART;TZID=Europe/Madrid:20150930T150000\n"
-	result, err := parseEventDate("DTSTART", dataStart)
+	dataStart := decodeEvent(t, "DTSTART;TZID=Europe/Madrid:20150930T150000\n")
+	result, err := parseDateProperty("DTSTART", dataStart, nil)
 	if err != nil {
 		t.FailNow()
 	}
 
-	if !expected.Equal(result) {
-		t.Errorf("Expected time %v to be %v", result, expected)
+	if !expected.Equal(result.Time) {
+		t.Errorf("Expected time %v to be %v", result.Time, expected)
 	}
 
-	dataEnd := "DTEND;TZID=Europe/Madrid:20150930T150000\n"
-	result, err = parseEventDate("DTEND", dataEnd)
+	dataEnd := decodeEvent(t, "DTEND;TZID=Europe/Madrid:20150930T150000\n")
+	result, err = parseDateProperty("DTEND", dataEnd, nil)
 	if err != nil {
 		t.FailNow()
 	}
 
-	if !expected.Equal(result) {
-		t.Errorf("Expected time %v to be %v", result, expected)
+	if !expected.Equal(result.Time) {
+		t.Errorf("Expected time %v to be %v", result.Time, expected)
 	}
 }
 
-func TestParseEventRecurrenceID(t *testing.T) {
+func TestParseRecurrenceID(t *testing.T) {
 	loc, err := time.LoadLocation("Europe/Madrid")
 	if err != nil {
 		t.FailNow()
 	}
 	expected := time.Date(2015, time.Month(10), 13, 15, 0, 0, 0, loc)
-	data := "RECURRENCE-ID;TZID=Europe/Madrid:20151013T150000\n"
+	data := decodeEvent(t, "RECURRENCE-ID;TZID=Europe/Madrid:20151013T150000\n")
 
-	result, err := parseEventRecurrenceID(data)
+	result, err := parseRecurrenceID(data, nil)
 	if err != nil {
 		t.Error(err)
 	}
 
-	if !expected.Equal(result) {
-		t.Errorf("Expected time %v to be %v", result, expected)
+	if !expected.Equal(result.Time) {
+		t.Errorf("Expected time %v to be %v", result.Time, expected)
+	}
+}
+
+func TestParseThisAndFutureOverride(t *testing.T) {
+	content := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:weekly",
+		"DTSTART:20160104T090000Z",
+		"DTEND:20160104T100000Z",
+		"RRULE:FREQ=WEEKLY;COUNT=5",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:weekly",
+		"RECURRENCE-ID;RANGE=THISANDFUTURE:20160118T090000Z",
+		"DTSTART:20160118T110000Z",
+		"DTEND:20160118T113000Z",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	cal, err := ParseICalContent(content, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cal.Events) != 5 {
+		t.Fatalf("expected 5 events, got %d", len(cal.Events))
+	}
+
+	for i, e := range cal.Events {
+		hour, length := 9, time.Hour
+		if i >= 2 {
+			hour, length = 11, 30*time.Minute
+		}
+
+		expected := time.Date(2016, time.January, 4+7*i, hour, 0, 0, 0, time.UTC)
+		if !e.Start.Equal(expected) || e.End.Sub(e.Start) != length {
+			t.Errorf("expected event %d to start at %s and last %s, got %s and %s", i, expected, length, e.Start, e.End.Sub(e.Start))
+		}
+	}
+
+	if !cal.Events[2].ThisAndFuture {
+		t.Errorf("expected override to have RANGE=THISANDFUTURE")
+	}
+}
+
+func TestParseOverrideRecurrenceIDs(t *testing.T) {
+	content := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:timed",
+		"DTSTART;TZID=Europe/Madrid:20160104T090000",
+		"DTEND;TZID=Europe/Madrid:20160104T100000",
+		"RRULE:FREQ=DAILY;COUNT=3",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:timed",
+		"SUMMARY:moved",
+		"RECURRENCE-ID:20160105T080000Z",
+		"DTSTART:20160105T150000Z",
+		"DTEND:20160105T160000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:allday",
+		"SUMMARY:moved",
+		"RECURRENCE-ID;VALUE=DATE:20160106",
+		"DTSTART;VALUE=DATE:20160107",
+		"DTEND;VALUE=DATE:20160108",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:allday",
+		"DTSTART;VALUE=DATE:20160104",
+		"DTEND;VALUE=DATE:20160105",
+		"RRULE:FREQ=DAILY;COUNT=3",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	cal, err := ParseICalContent(content, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moved := make(map[string]int)
+	for _, e := range cal.Events {
+		if e.Summary == "moved" {
+			moved[e.ID]++
+		}
+	}
+
+	if len(cal.Events) != 6 || moved["timed"] != 1 || moved["allday"] != 1 {
+		t.Errorf("expected every override to replace exactly one instance, got %v", cal.Events)
 	}
 }
 
 var testWholeDayEvent = `
+BEGIN:VCALENDAR
 BEGIN:VEVENT
 DTSTART;VALUE=DATE:20160122
 DTEND;VALUE=DATE:20160123
@@ -187,21 +395,96 @@ ACTION:DISPLAY
 DESCRIPTION:This is an event reminder
 END:VALARM
 END:VEVENT
+END:VCALENDAR
 `
 
-func TestParseEventDateWholeDay(t *testing.T) {
-	tResult, err := parseEventDate("DTSTART", testWholeDayEvent)
+func TestParseDatePropertyWholeDay(t *testing.T) {
+	cal, err := decodeCalendar(testWholeDayEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := cal.ChildrenNamed("VEVENT")
+	if len(events) != 1 {
+		t.Fatalf("expected %d event, got %d", 1, len(events))
+	}
+
+	tResult, err := parseDateProperty("DTSTART", events[0], nil)
 	if err != nil {
 		t.Error(err)
 	}
 
 	tExpected := time.Date(2016, time.January, 22, 0, 0, 0, 0, &time.Location{})
-	if !tResult.Equal(tExpected) {
-		t.Errorf("expected %v to be %v", tResult, tExpected)
+	if !tResult.Time.Equal(tExpected) || tResult.Kind != Date {
+		t.Errorf("expected %v to be the date %v", tResult.Time, tExpected)
 	}
 
-	err = parseEvents(&Calendar{}, []string{testWholeDayEvent}, 0)
+	err = parseEvents(&Calendar{}, events, 0)
 	if err != nil {
 		t.Error(err)
 	}
 }
+
+func TestDecoderUnfolding(t *testing.T) {
+	data := "ATTENDEE;CN=\"Smith, John\";PARTSTAT=ACCEPTED;CN=J\r\n ohn:mailto:j.smith@\r\n\texample.com\r\n" +
+		"DESCRIPTION:SUMMARY:not a summary\r\n" +
+		"X-FOO;X-BAR=a,\"b;c\",d:value:with:colons\r\n"
+
+	event := decodeEvent(t, data)
+	props := event.Properties
+	if len(props) != 3 {
+		t.Fatalf("expected %d properties, got %d", 3, len(props))
+	}
+
+	attendee := parseAttendee(props[0])
+	if attendee.Name != "Smith, John" {
+		t.Errorf("expected name %q, got %q", "Smith, John", attendee.Name)
+	}
+
+	if attendee.Email != "j.smith@example.com" {
+		t.Errorf("expected email %q, got %q", "j.smith@example.com", attendee.Email)
+	}
+
+	if parseSummary(event) != "" {
+		t.Errorf("expected no summary, got %q", parseSummary(event))
+	}
+
+	if props[1].Value != "SUMMARY:not a summary" {
+		t.Errorf("expected description %q, got %q", "SUMMARY:not a summary", props[1].Value)
+	}
+
+	values := props[2].Params.Values("x-bar")
+	if len(values) != 3 || values[1] != "b;c" {
+		t.Errorf("expected parameter values [a b;c d], got %v", values)
+	}
+
+	if props[2].Value != "value:with:colons" {
+		t.Errorf("expected value %q, got %q", "value:with:colons", props[2].Value)
+	}
+}
+
+func TestDecoderSyntaxError(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("BEGIN:VCALENDAR\r\nNOVALUE\r\n"))
+	if _, err := dec.ReadProperty(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := dec.ReadProperty()
+	if serr, ok := err.(*SyntaxError); !ok || serr.Line != 2 {
+		t.Errorf("expected syntax error on line 2, got %v", err)
+	}
+}
+
+func decodeEvent(t *testing.T, data string) *Component {
+	event := NewComponent("VEVENT")
+	dec := NewDecoder(strings.NewReader(data))
+	for {
+		prop, err := dec.ReadProperty()
+		if err == io.EOF {
+			return event
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		event.Add(prop)
+	}
+}
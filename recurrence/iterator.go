@@ -0,0 +1,463 @@
+package recurrence
+
+import (
+	"sort"
+	"time"
+)
+
+// maxYear is the year after which no more occurrences are looked for, so
+// rules that can never match, such as every February 30th, end.
+const maxYear = 9999
+
+// Iterator generates the occurrences of a recurrence rule in order.
+type Iterator struct {
+	r   *Recurrence
+	loc *time.Location
+
+	// start is the wall clock time of the first occurrence and period is
+	// the wall clock time at which the current period starts, both in UTC
+	// so that they can be used as civil times.
+	start  time.Time
+	period time.Time
+
+	byHour, byMinute, bySecond []int
+	byMonth, byMonthDay        []int
+	byDay                      []Weekday
+
+	pending []time.Time
+	emitted int
+	first   bool
+	done    bool
+}
+
+// Iterator returns a new iterator over the occurrences of the rule. The
+// first occurrence is always Start, even if it does not match the rule, as
+// defined by RFC 5545.
+func (r *Recurrence) Iterator() *Iterator {
+	rule := *r
+	if rule.Interval < 1 {
+		rule.Interval = 1
+	}
+
+	it := &Iterator{
+		r:          &rule,
+		loc:        r.Start.Location(),
+		start:      civil(r.Start),
+		byHour:     r.ByHour,
+		byMinute:   r.ByMinute,
+		bySecond:   r.BySecond,
+		byMonth:    r.ByMonth,
+		byMonthDay: r.ByMonthDay,
+		byDay:      r.ByDay,
+		first:      true,
+	}
+
+	// when no rule part says on which days the rule repeats, it repeats
+	// on the same day as the start
+	if len(r.ByWeekNo) == 0 && len(r.ByYearDay) == 0 && len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+		switch r.Freq {
+		case Yearly:
+			if len(r.ByMonth) == 0 {
+				it.byMonth = []int{int(it.start.Month())}
+			}
+			it.byMonthDay = []int{it.start.Day()}
+		case Monthly:
+			it.byMonthDay = []int{it.start.Day()}
+		case Weekly:
+			it.byDay = []Weekday{{Day: it.start.Weekday()}}
+		}
+	}
+
+	if r.Freq > Hourly && len(r.ByHour) == 0 {
+		it.byHour = []int{it.start.Hour()}
+	}
+
+	if r.Freq > Minutely && len(r.ByMinute) == 0 {
+		it.byMinute = []int{it.start.Minute()}
+	}
+
+	if r.Freq > Secondly && len(r.BySecond) == 0 {
+		it.bySecond = []int{it.start.Second()}
+	}
+
+	it.byHour = sortedCopy(it.byHour)
+	it.byMinute = sortedCopy(it.byMinute)
+	it.bySecond = sortedCopy(it.bySecond)
+	it.period = it.firstPeriod()
+	return it
+}
+
+// Next returns the start of the next occurrence. The second value is false
+// if there are no more occurrences.
+func (it *Iterator) Next() (time.Time, bool) {
+	if it.first {
+		it.first = false
+		if !it.r.Until.IsZero() && it.r.Start.After(it.r.Until) {
+			it.done = true
+			return time.Time{}, false
+		}
+		it.emitted++
+		return it.r.Start, true
+	}
+
+	for !it.done {
+		if it.r.Count > 0 && it.emitted >= it.r.Count {
+			it.done = true
+			break
+		}
+
+		for len(it.pending) == 0 {
+			if it.period.Year() > maxYear {
+				it.done = true
+				return time.Time{}, false
+			}
+			it.expandPeriod()
+		}
+
+		t := it.pending[0]
+		it.pending = it.pending[1:]
+
+		if !t.After(it.r.Start) {
+			continue
+		}
+
+		if !it.r.Until.IsZero() && t.After(it.r.Until) {
+			it.done = true
+			break
+		}
+
+		it.emitted++
+		return t, true
+	}
+
+	return time.Time{}, false
+}
+
+func (it *Iterator) firstPeriod() time.Time {
+	s := it.start
+	switch it.r.Freq {
+	case Yearly:
+		return date(s.Year(), time.January, 1)
+	case Monthly:
+		return date(s.Year(), s.Month(), 1)
+	case Weekly:
+		offset := (int(s.Weekday()) - int(it.r.WeekStart) + 7) % 7
+		return date(s.Year(), s.Month(), s.Day()-offset)
+	case Daily:
+		return date(s.Year(), s.Month(), s.Day())
+	case Hourly:
+		return s.Truncate(time.Hour)
+	case Minutely:
+		return s.Truncate(time.Minute)
+	default:
+		return s
+	}
+}
+
+// expandPeriod adds all the occurrences in the current period to the
+// pending ones and moves to the next period.
+func (it *Iterator) expandPeriod() {
+	var candidates []time.Time
+	days := it.days()
+	if len(days) == 0 && it.r.Freq < Daily {
+		// no occurrence can happen on the current day
+		it.skipTo(date(it.period.Year(), it.period.Month(), it.period.Day()+1))
+		return
+	}
+
+	hours, minutes, seconds := it.times()
+	if len(hours) == 0 && it.r.Freq < Hourly {
+		it.skipTo(it.period.Truncate(time.Hour).Add(time.Hour))
+		return
+	}
+
+	if len(minutes) == 0 && it.r.Freq < Minutely {
+		it.skipTo(it.period.Truncate(time.Minute).Add(time.Minute))
+		return
+	}
+
+	if len(seconds) == 0 {
+		it.skipTo(it.nextSecond())
+		return
+	}
+
+	for _, d := range days {
+		for _, h := range hours {
+			for _, m := range minutes {
+				for _, s := range seconds {
+					candidates = append(candidates, d.Add(time.Duration(h)*time.Hour+time.Duration(m)*time.Minute+time.Duration(s)*time.Second))
+				}
+			}
+		}
+	}
+
+	if len(it.r.BySetPos) > 0 {
+		candidates = setPositions(candidates, it.r.BySetPos)
+	}
+
+	for _, c := range candidates {
+		it.pending = append(it.pending, time.Date(c.Year(), c.Month(), c.Day(), c.Hour(), c.Minute(), c.Second(), 0, it.loc))
+	}
+
+	it.next()
+}
+
+// days returns the days of the current period that match the rule.
+func (it *Iterator) days() []time.Time {
+	var first, last time.Time
+	p := it.period
+	switch it.r.Freq {
+	case Yearly:
+		first, last = date(p.Year(), time.January, 1), date(p.Year()+1, time.January, 1)
+	case Monthly:
+		first, last = date(p.Year(), p.Month(), 1), date(p.Year(), p.Month()+1, 1)
+	case Weekly:
+		first, last = p, p.AddDate(0, 0, 7)
+	default:
+		first = date(p.Year(), p.Month(), p.Day())
+		last = first.AddDate(0, 0, 1)
+	}
+
+	var days []time.Time
+	for d := first; d.Before(last); d = d.AddDate(0, 0, 1) {
+		if it.matchesDay(d) {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+func (it *Iterator) matchesDay(d time.Time) bool {
+	r := it.r
+	if len(it.byMonth) > 0 && !contains(it.byMonth, int(d.Month())) {
+		return false
+	}
+
+	if len(r.ByWeekNo) > 0 && !matchesWeekNo(d, r.ByWeekNo, r.WeekStart) {
+		return false
+	}
+
+	if len(r.ByYearDay) > 0 && !matchesOrdinal(d.YearDay(), daysInYear(d.Year()), r.ByYearDay) {
+		return false
+	}
+
+	if len(it.byMonthDay) > 0 && !matchesOrdinal(d.Day(), daysInMonth(d.Year(), d.Month()), it.byMonthDay) {
+		return false
+	}
+
+	if len(it.byDay) > 0 && !it.matchesWeekday(d) {
+		return false
+	}
+
+	return true
+}
+
+// matchesWeekday reports whether the day matches any of the BYDAY days. In
+// MONTHLY rules, and YEARLY rules with BYMONTH, ordinals refer to the days
+// within the month. In YEARLY rules they refer to the days within the year.
+func (it *Iterator) matchesWeekday(d time.Time) bool {
+	for _, wd := range it.byDay {
+		if wd.Day != d.Weekday() {
+			continue
+		}
+
+		if wd.N == 0 {
+			return true
+		}
+
+		switch {
+		case it.r.Freq == Monthly || (it.r.Freq == Yearly && len(it.r.ByMonth) > 0):
+			if matchesNth(d.Day(), daysInMonth(d.Year(), d.Month()), wd.N) {
+				return true
+			}
+		case it.r.Freq == Yearly && len(it.r.ByWeekNo) == 0:
+			if matchesNth(d.YearDay(), daysInYear(d.Year()), wd.N) {
+				return true
+			}
+		default:
+			// ordinals have no meaning in any other case
+			return true
+		}
+	}
+	return false
+}
+
+// times returns the hours, minutes and seconds of the occurrences in the
+// current period.
+func (it *Iterator) times() (hours, minutes, seconds []int) {
+	p := it.period
+	hours, minutes, seconds = it.byHour, it.byMinute, it.bySecond
+	if it.r.Freq <= Hourly {
+		hours = filter([]int{p.Hour()}, it.r.ByHour)
+	}
+
+	if it.r.Freq <= Minutely {
+		minutes = filter([]int{p.Minute()}, it.r.ByMinute)
+	}
+
+	if it.r.Freq == Secondly {
+		seconds = filter([]int{p.Second()}, it.r.BySecond)
+	}
+
+	return hours, minutes, seconds
+}
+
+// nextSecond returns the next time after the current period whose second
+// is one of the ones of a secondly rule.
+func (it *Iterator) nextSecond() time.Time {
+	minute := it.period.Truncate(time.Minute)
+	for _, s := range it.bySecond {
+		if s > it.period.Second() {
+			return minute.Add(time.Duration(s) * time.Second)
+		}
+	}
+	return minute.Add(time.Minute + time.Duration(it.bySecond[0])*time.Second)
+}
+
+// next moves to the next period.
+func (it *Iterator) next() {
+	p, n := it.period, it.r.Interval
+	switch it.r.Freq {
+	case Yearly:
+		it.period = date(p.Year()+n, time.January, 1)
+	case Monthly:
+		it.period = date(p.Year(), p.Month()+time.Month(n), 1)
+	case Weekly:
+		it.period = p.AddDate(0, 0, 7*n)
+	case Daily:
+		it.period = p.AddDate(0, 0, n)
+	default:
+		it.period = p.Add(time.Duration(n) * it.unit())
+	}
+}
+
+// skipTo moves to the first period of a sub-daily rule that starts at or
+// after t.
+func (it *Iterator) skipTo(t time.Time) {
+	step := time.Duration(it.r.Interval) * it.unit()
+	periods := (t.Sub(it.period) + step - 1) / step
+	if periods < 1 {
+		periods = 1
+	}
+	it.period = it.period.Add(periods * step)
+}
+
+func (it *Iterator) unit() time.Duration {
+	switch it.r.Freq {
+	case Hourly:
+		return time.Hour
+	case Minutely:
+		return time.Minute
+	default:
+		return time.Second
+	}
+}
+
+// setPositions returns the candidates at the given positions, 1 being the
+// first one and -1 the last one, in order.
+func setPositions(candidates []time.Time, positions []int) []time.Time {
+	var result []time.Time
+	for i, c := range candidates {
+		for _, pos := range positions {
+			if pos == i+1 || pos == i-len(candidates) {
+				result = append(result, c)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// matchesWeekNo reports whether the day is in any of the given weeks of its
+// year. Week 1 is the first week with at least 4 days of the year, weeks
+// starting on wkst.
+func matchesWeekNo(d time.Time, weeks []int, wkst time.Weekday) bool {
+	year := d.Year()
+	start := weekOne(year, wkst)
+	if d.Before(start) {
+		year--
+		start = weekOne(year, wkst)
+	} else if next := weekOne(year+1, wkst); !d.Before(next) {
+		year++
+		start = next
+	}
+
+	weekNo := int(d.Sub(start).Hours()/24)/7 + 1
+	total := int(weekOne(year+1, wkst).Sub(start).Hours()/24) / 7
+	return matchesOrdinal(weekNo, total, weeks)
+}
+
+// weekOne returns the first day of the first week of the year.
+func weekOne(year int, wkst time.Weekday) time.Time {
+	jan1 := date(year, time.January, 1)
+	offset := (int(jan1.Weekday()) - int(wkst) + 7) % 7
+	if offset <= 3 {
+		return jan1.AddDate(0, 0, -offset)
+	}
+	return jan1.AddDate(0, 0, 7-offset)
+}
+
+// matchesOrdinal reports whether n, which is in the range [1, total],
+// matches any of the given ordinals, which count from the end if negative.
+func matchesOrdinal(n, total int, ordinals []int) bool {
+	for _, o := range ordinals {
+		if o == n || (o < 0 && total+o+1 == n) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesNth reports whether the week day at position n of a range of
+// total days is the nth of that week day in the range.
+func matchesNth(n, total, nth int) bool {
+	if nth > 0 {
+		return (n-1)/7+1 == nth
+	}
+	return -((total-n)/7 + 1) == nth
+}
+
+func civil(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func daysInYear(year int) int {
+	return date(year, time.December, 31).YearDay()
+}
+
+func daysInMonth(year int, month time.Month) int {
+	return date(year, month+1, 0).Day()
+}
+
+func contains(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func filter(values, allowed []int) []int {
+	if len(allowed) == 0 {
+		return values
+	}
+
+	var result []int
+	for _, v := range values {
+		if contains(allowed, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func sortedCopy(values []int) []int {
+	result := append([]int(nil), values...)
+	sort.Ints(result)
+	return result
+}
@@ -0,0 +1,385 @@
+// Package recurrence implements the recurrence rules of iCalendar, as
+// defined in RFC 5545 section 3.3.10.
+//
+// A Recurrence is parsed from the value of a RRULE property and the start
+// of the recurring component, and generates the start of every occurrence
+// in order:
+//
+//	r, err := recurrence.Parse("FREQ=MONTHLY;BYDAY=-1FR;COUNT=10", start)
+//	if err != nil {
+//		// handle error
+//	}
+//
+//	it := r.Iterator()
+//	for t, ok := it.Next(); ok; t, ok = it.Next() {
+//		// ...
+//	}
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the type of recurrence of a rule.
+type Frequency int
+
+const (
+	// Secondly repeats every second or more.
+	Secondly Frequency = iota
+	// Minutely repeats every minute or more.
+	Minutely
+	// Hourly repeats every hour or more.
+	Hourly
+	// Daily repeats every day or more.
+	Daily
+	// Weekly repeats every week or more.
+	Weekly
+	// Monthly repeats every month or more.
+	Monthly
+	// Yearly repeats every year or more.
+	Yearly
+)
+
+var frequencyNames = []string{"SECONDLY", "MINUTELY", "HOURLY", "DAILY", "WEEKLY", "MONTHLY", "YEARLY"}
+
+func (f Frequency) String() string {
+	if f < Secondly || f > Yearly {
+		return fmt.Sprintf("Frequency(%d)", int(f))
+	}
+	return frequencyNames[f]
+}
+
+var weekdayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Weekday is a day of the week in a BYDAY rule part. If N is not 0 it is
+// the nth occurrence of that day within the month or year, counting from
+// the end if it is negative. For example, -1SU is the last Sunday.
+type Weekday struct {
+	Day time.Weekday
+	N   int
+}
+
+func (w Weekday) String() string {
+	if w.N != 0 {
+		return strconv.Itoa(w.N) + weekdayNames[w.Day]
+	}
+	return weekdayNames[w.Day]
+}
+
+// Recurrence is a recurrence rule together with the start of the first
+// occurrence. Fields that are not set in the rule are left empty; the
+// defaults taken from Start are applied when generating occurrences.
+type Recurrence struct {
+	// Start is the start of the first occurrence, the value of DTSTART.
+	// All occurrences are generated in its location.
+	Start time.Time
+
+	Freq     Frequency
+	Interval int
+	// Count is the number of occurrences, 0 if unlimited.
+	Count int
+	// Until is the last moment an occurrence can start, zero if unlimited.
+	Until time.Time
+
+	BySecond   []int
+	ByMinute   []int
+	ByHour     []int
+	ByDay      []Weekday
+	ByMonthDay []int
+	ByYearDay  []int
+	ByWeekNo   []int
+	ByMonth    []int
+	BySetPos   []int
+	WeekStart  time.Weekday
+
+	// untilDate is true if UNTIL was a DATE value.
+	untilDate bool
+}
+
+// Parse parses the value of a RRULE property, such as
+// "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", for a component that starts at
+// the given time.
+func Parse(rrule string, start time.Time) (*Recurrence, error) {
+	r := &Recurrence{
+		Start:     start,
+		Interval:  1,
+		WeekStart: time.Monday,
+		Freq:      -1,
+	}
+
+	rrule = strings.TrimPrefix(strings.TrimSpace(rrule), "RRULE:")
+	for _, part := range strings.Split(rrule, ";") {
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("recurrence: invalid rule part %q", part)
+		}
+
+		name, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		var err error
+		switch name {
+		case "FREQ":
+			r.Freq = parseFrequency(value)
+			if r.Freq < 0 {
+				err = fmt.Errorf("invalid frequency %q", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+			if err == nil && r.Interval < 1 {
+				err = fmt.Errorf("interval must be positive")
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+			if err == nil && r.Count < 1 {
+				err = fmt.Errorf("count must be positive")
+			}
+		case "UNTIL":
+			r.Until, r.untilDate, err = parseUntil(value, start.Location())
+		case "BYSECOND":
+			r.BySecond, err = parseInts(value, 0, 60, false)
+			r.BySecond = withoutLeapSecond(r.BySecond)
+		case "BYMINUTE":
+			r.ByMinute, err = parseInts(value, 0, 59, false)
+		case "BYHOUR":
+			r.ByHour, err = parseInts(value, 0, 23, false)
+		case "BYDAY":
+			r.ByDay, err = parseWeekdays(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseInts(value, 1, 31, true)
+		case "BYYEARDAY":
+			r.ByYearDay, err = parseInts(value, 1, 366, true)
+		case "BYWEEKNO":
+			r.ByWeekNo, err = parseInts(value, 1, 53, true)
+		case "BYMONTH":
+			r.ByMonth, err = parseInts(value, 1, 12, false)
+		case "BYSETPOS":
+			r.BySetPos, err = parseInts(value, 1, 366, true)
+		case "WKST":
+			day, ok := parseWeekday(value)
+			if !ok {
+				err = fmt.Errorf("invalid week day %q", value)
+			}
+			r.WeekStart = day
+		default:
+			// unknown rule parts are ignored, as they may be extensions
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("recurrence: %s: %s", name, err)
+		}
+	}
+
+	if r.Freq < 0 {
+		return nil, fmt.Errorf("recurrence: missing FREQ")
+	}
+
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, fmt.Errorf("recurrence: COUNT and UNTIL can not be used together")
+	}
+
+	return r, nil
+}
+
+// String returns the rule in the format of the value of a RRULE property.
+func (r *Recurrence) String() string {
+	parts := []string{"FREQ=" + r.Freq.String()}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+
+	if !r.Until.IsZero() {
+		if r.untilDate {
+			parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+		}
+	}
+
+	ints := []struct {
+		name   string
+		values []int
+	}{
+		{"BYSECOND", r.BySecond},
+		{"BYMINUTE", r.ByMinute},
+		{"BYHOUR", r.ByHour},
+	}
+
+	for _, p := range ints {
+		if len(p.values) > 0 {
+			parts = append(parts, p.name+"="+joinInts(p.values))
+		}
+	}
+
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = d.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+
+	ints = []struct {
+		name   string
+		values []int
+	}{
+		{"BYMONTHDAY", r.ByMonthDay},
+		{"BYYEARDAY", r.ByYearDay},
+		{"BYWEEKNO", r.ByWeekNo},
+		{"BYMONTH", r.ByMonth},
+		{"BYSETPOS", r.BySetPos},
+	}
+
+	for _, p := range ints {
+		if len(p.values) > 0 {
+			parts = append(parts, p.name+"="+joinInts(p.values))
+		}
+	}
+
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayNames[r.WeekStart])
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// All returns the start of the first limit occurrences. If limit is 0 all
+// the occurrences are returned, which never ends for rules without COUNT
+// or UNTIL.
+func (r *Recurrence) All(limit int) []time.Time {
+	var result []time.Time
+	it := r.Iterator()
+	for t, ok := it.Next(); ok; t, ok = it.Next() {
+		result = append(result, t)
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+	return result
+}
+
+// Between returns the start of all the occurrences starting at or after
+// from and before to.
+func (r *Recurrence) Between(from, to time.Time) []time.Time {
+	var result []time.Time
+	it := r.Iterator()
+	for t, ok := it.Next(); ok && t.Before(to); t, ok = it.Next() {
+		if !t.Before(from) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func parseFrequency(s string) Frequency {
+	for i, name := range frequencyNames {
+		if name == s {
+			return Frequency(i)
+		}
+	}
+	return -1
+}
+
+func parseUntil(s string, loc *time.Location) (time.Time, bool, error) {
+	switch {
+	case len(s) == len("20060102"):
+		t, err := time.ParseInLocation("20060102", s, loc)
+		// a DATE value includes the whole day
+		return t.Add(24*time.Hour - time.Second), true, err
+	case strings.HasSuffix(s, "Z"):
+		t, err := time.Parse("20060102T150405Z", s)
+		return t, false, err
+	default:
+		t, err := time.ParseInLocation("20060102T150405", s, loc)
+		return t, false, err
+	}
+}
+
+func parseInts(s string, min, max int, negative bool) ([]int, error) {
+	var result []int
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimPrefix(v, "+"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", v)
+		}
+
+		abs := n
+		if n < 0 && negative {
+			abs = -n
+		}
+
+		if abs < min || abs > max {
+			return nil, fmt.Errorf("value %d out of range", n)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// withoutLeapSecond returns the seconds with the leap second 60, which
+// times can not have, as the last second of the minute instead.
+func withoutLeapSecond(seconds []int) []int {
+	var result []int
+	for _, s := range seconds {
+		if s == 60 {
+			s = 59
+		}
+
+		if !contains(result, s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func parseWeekdays(s string) ([]Weekday, error) {
+	var result []Weekday
+	for _, v := range strings.Split(s, ",") {
+		if len(v) < 2 {
+			return nil, fmt.Errorf("invalid week day %q", v)
+		}
+
+		day, ok := parseWeekday(v[len(v)-2:])
+		if !ok {
+			return nil, fmt.Errorf("invalid week day %q", v)
+		}
+
+		var n int
+		if ordinal := v[:len(v)-2]; ordinal != "" {
+			var err error
+			n, err = strconv.Atoi(strings.TrimPrefix(ordinal, "+"))
+			if err != nil || n == 0 || n < -53 || n > 53 {
+				return nil, fmt.Errorf("invalid week day %q", v)
+			}
+		}
+
+		result = append(result, Weekday{Day: day, N: n})
+	}
+	return result, nil
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	for i, name := range weekdayNames {
+		if name == s {
+			return time.Weekday(i), true
+		}
+	}
+	return 0, false
+}
+
+func joinInts(values []int) string {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = strconv.Itoa(v)
+	}
+	return strings.Join(strs, ",")
+}
@@ -0,0 +1,489 @@
+package recurrence
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcExamples are the examples of RFC 5545 section 3.8.5.3. The ones that
+// are unbounded or very long are checked up to the number of expected
+// occurrences.
+var rfcExamples = []struct {
+	name     string
+	start    string
+	rrule    string
+	expected []string
+}{
+	{
+		"daily for 10 occurrences",
+		"19970902T090000",
+		"FREQ=DAILY;COUNT=10",
+		[]string{"19970902T090000", "19970903T090000", "19970904T090000", "19970905T090000", "19970906T090000", "19970907T090000", "19970908T090000", "19970909T090000", "19970910T090000", "19970911T090000"},
+	},
+	{
+		"every other day",
+		"19970902T090000",
+		"FREQ=DAILY;INTERVAL=2",
+		[]string{"19970902T090000", "19970904T090000", "19970906T090000", "19970908T090000", "19970910T090000"},
+	},
+	{
+		"every 10 days, 5 occurrences",
+		"19970902T090000",
+		"FREQ=DAILY;INTERVAL=10;COUNT=5",
+		[]string{"19970902T090000", "19970912T090000", "19970922T090000", "19971002T090000", "19971012T090000"},
+	},
+	{
+		"weekly for 10 occurrences",
+		"19970902T090000",
+		"FREQ=WEEKLY;COUNT=10",
+		[]string{"19970902T090000", "19970909T090000", "19970916T090000", "19970923T090000", "19970930T090000", "19971007T090000", "19971014T090000", "19971021T090000", "19971028T090000", "19971104T090000"},
+	},
+	{
+		"every other week",
+		"19970902T090000",
+		"FREQ=WEEKLY;INTERVAL=2;WKST=SU",
+		[]string{"19970902T090000", "19970916T090000", "19970930T090000", "19971014T090000", "19971028T090000", "19971111T090000", "19971125T090000", "19971209T090000", "19971223T090000", "19980106T090000"},
+	},
+	{
+		"weekly on tuesday and thursday for five weeks",
+		"19970902T090000",
+		"FREQ=WEEKLY;UNTIL=19971007T000000Z;WKST=SU;BYDAY=TU,TH",
+		[]string{"19970902T090000", "19970904T090000", "19970909T090000", "19970911T090000", "19970916T090000", "19970918T090000", "19970923T090000", "19970925T090000", "19970930T090000", "19971002T090000"},
+	},
+	{
+		"every other week on monday, wednesday and friday until december 24",
+		"19970901T090000",
+		"FREQ=WEEKLY;INTERVAL=2;UNTIL=19971224T000000Z;WKST=SU;BYDAY=MO,WE,FR",
+		[]string{"19970901T090000", "19970903T090000", "19970905T090000", "19970915T090000", "19970917T090000", "19970919T090000", "19970929T090000", "19971001T090000", "19971003T090000", "19971013T090000", "19971015T090000", "19971017T090000", "19971027T090000", "19971029T090000", "19971031T090000", "19971110T090000", "19971112T090000", "19971114T090000", "19971124T090000", "19971126T090000", "19971128T090000", "19971208T090000", "19971210T090000", "19971212T090000", "19971222T090000"},
+	},
+	{
+		"every other week on tuesday and thursday for 8 occurrences",
+		"19970902T090000",
+		"FREQ=WEEKLY;INTERVAL=2;COUNT=8;WKST=SU;BYDAY=TU,TH",
+		[]string{"19970902T090000", "19970904T090000", "19970916T090000", "19970918T090000", "19970930T090000", "19971002T090000", "19971014T090000", "19971016T090000"},
+	},
+	{
+		"monthly on the first friday for 10 occurrences",
+		"19970905T090000",
+		"FREQ=MONTHLY;COUNT=10;BYDAY=1FR",
+		[]string{"19970905T090000", "19971003T090000", "19971107T090000", "19971205T090000", "19980102T090000", "19980206T090000", "19980306T090000", "19980403T090000", "19980501T090000", "19980605T090000"},
+	},
+	{
+		"monthly on the first friday until december 24",
+		"19970905T090000",
+		"FREQ=MONTHLY;UNTIL=19971224T000000Z;BYDAY=1FR",
+		[]string{"19970905T090000", "19971003T090000", "19971107T090000", "19971205T090000"},
+	},
+	{
+		"every other month on the first and last sunday for 10 occurrences",
+		"19970907T090000",
+		"FREQ=MONTHLY;INTERVAL=2;COUNT=10;BYDAY=1SU,-1SU",
+		[]string{"19970907T090000", "19970928T090000", "19971102T090000", "19971130T090000", "19980104T090000", "19980125T090000", "19980301T090000", "19980329T090000", "19980503T090000", "19980531T090000"},
+	},
+	{
+		"monthly on the second to last monday for 6 months",
+		"19970922T090000",
+		"FREQ=MONTHLY;COUNT=6;BYDAY=-2MO",
+		[]string{"19970922T090000", "19971020T090000", "19971117T090000", "19971222T090000", "19980119T090000", "19980216T090000"},
+	},
+	{
+		"monthly on the third to last day",
+		"19970928T090000",
+		"FREQ=MONTHLY;BYMONTHDAY=-3",
+		[]string{"19970928T090000", "19971029T090000", "19971128T090000", "19971229T090000", "19980129T090000", "19980226T090000"},
+	},
+	{
+		"monthly on the 2nd and 15th for 10 occurrences",
+		"19970902T090000",
+		"FREQ=MONTHLY;COUNT=10;BYMONTHDAY=2,15",
+		[]string{"19970902T090000", "19970915T090000", "19971002T090000", "19971015T090000", "19971102T090000", "19971115T090000", "19971202T090000", "19971215T090000", "19980102T090000", "19980115T090000"},
+	},
+	{
+		"monthly on the first and last day for 10 occurrences",
+		"19970930T090000",
+		"FREQ=MONTHLY;COUNT=10;BYMONTHDAY=1,-1",
+		[]string{"19970930T090000", "19971001T090000", "19971031T090000", "19971101T090000", "19971130T090000", "19971201T090000", "19971231T090000", "19980101T090000", "19980131T090000", "19980201T090000"},
+	},
+	{
+		"every 18 months on the 10th to 15th for 10 occurrences",
+		"19970910T090000",
+		"FREQ=MONTHLY;INTERVAL=18;COUNT=10;BYMONTHDAY=10,11,12,13,14,15",
+		[]string{"19970910T090000", "19970911T090000", "19970912T090000", "19970913T090000", "19970914T090000", "19970915T090000", "19990310T090000", "19990311T090000", "19990312T090000", "19990313T090000"},
+	},
+	{
+		"every tuesday, every other month",
+		"19970902T090000",
+		"FREQ=MONTHLY;INTERVAL=2;BYDAY=TU",
+		[]string{"19970902T090000", "19970909T090000", "19970916T090000", "19970923T090000", "19970930T090000", "19971104T090000", "19971111T090000", "19971118T090000", "19971125T090000", "19980106T090000", "19980113T090000", "19980120T090000", "19980127T090000", "19980303T090000"},
+	},
+	{
+		"yearly in june and july for 10 occurrences",
+		"19970610T090000",
+		"FREQ=YEARLY;COUNT=10;BYMONTH=6,7",
+		[]string{"19970610T090000", "19970710T090000", "19980610T090000", "19980710T090000", "19990610T090000", "19990710T090000", "20000610T090000", "20000710T090000", "20010610T090000", "20010710T090000"},
+	},
+	{
+		"every other year on january, february and march for 10 occurrences",
+		"19970310T090000",
+		"FREQ=YEARLY;INTERVAL=2;COUNT=10;BYMONTH=1,2,3",
+		[]string{"19970310T090000", "19990110T090000", "19990210T090000", "19990310T090000", "20010110T090000", "20010210T090000", "20010310T090000", "20030110T090000", "20030210T090000", "20030310T090000"},
+	},
+	{
+		"every third year on the 1st, 100th and 200th day for 10 occurrences",
+		"19970101T090000",
+		"FREQ=YEARLY;INTERVAL=3;COUNT=10;BYYEARDAY=1,100,200",
+		[]string{"19970101T090000", "19970410T090000", "19970719T090000", "20000101T090000", "20000409T090000", "20000718T090000", "20030101T090000", "20030410T090000", "20030719T090000", "20060101T090000"},
+	},
+	{
+		"every 20th monday of the year",
+		"19970519T090000",
+		"FREQ=YEARLY;BYDAY=20MO",
+		[]string{"19970519T090000", "19980518T090000", "19990517T090000"},
+	},
+	{
+		"monday of week number 20",
+		"19970512T090000",
+		"FREQ=YEARLY;BYWEEKNO=20;BYDAY=MO",
+		[]string{"19970512T090000", "19980511T090000", "19990517T090000"},
+	},
+	{
+		"every thursday in march",
+		"19970313T090000",
+		"FREQ=YEARLY;BYMONTH=3;BYDAY=TH",
+		[]string{"19970313T090000", "19970320T090000", "19970327T090000", "19980305T090000", "19980312T090000", "19980319T090000", "19980326T090000", "19990304T090000", "19990311T090000", "19990318T090000", "19990325T090000"},
+	},
+	{
+		"every thursday during june, july and august",
+		"19970605T090000",
+		"FREQ=YEARLY;BYDAY=TH;BYMONTH=6,7,8",
+		[]string{"19970605T090000", "19970612T090000", "19970619T090000", "19970626T090000", "19970703T090000", "19970710T090000", "19970717T090000", "19970724T090000", "19970731T090000", "19970807T090000", "19970814T090000", "19970821T090000", "19970828T090000", "19980604T090000"},
+	},
+	{
+		"every friday the 13th",
+		"19970902T090000",
+		"FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13",
+		[]string{"19970902T090000", "19980213T090000", "19980313T090000", "19981113T090000", "19990813T090000", "20001013T090000"},
+	},
+	{
+		"first saturday that follows the first sunday of the month",
+		"19970913T090000",
+		"FREQ=MONTHLY;BYDAY=SA;BYMONTHDAY=7,8,9,10,11,12,13",
+		[]string{"19970913T090000", "19971011T090000", "19971108T090000", "19971213T090000", "19980110T090000", "19980207T090000", "19980307T090000", "19980411T090000", "19980509T090000", "19980613T090000"},
+	},
+	{
+		"us presidential election day",
+		"19961105T090000",
+		"FREQ=YEARLY;INTERVAL=4;BYMONTH=11;BYDAY=TU;BYMONTHDAY=2,3,4,5,6,7,8",
+		[]string{"19961105T090000", "20001107T090000", "20041102T090000"},
+	},
+	{
+		"third instance of tuesday, wednesday or thursday for the next 3 months",
+		"19970904T090000",
+		"FREQ=MONTHLY;COUNT=3;BYDAY=TU,WE,TH;BYSETPOS=3",
+		[]string{"19970904T090000", "19971007T090000", "19971106T090000"},
+	},
+	{
+		"second to last weekday of the month",
+		"19970929T090000",
+		"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-2",
+		[]string{"19970929T090000", "19971030T090000", "19971127T090000", "19971230T090000", "19980129T090000", "19980226T090000", "19980330T090000"},
+	},
+	{
+		"every 15 minutes for 6 occurrences",
+		"19970902T090000",
+		"FREQ=MINUTELY;INTERVAL=15;COUNT=6",
+		[]string{"19970902T090000", "19970902T091500", "19970902T093000", "19970902T094500", "19970902T100000", "19970902T101500"},
+	},
+	{
+		"every hour and a half for 4 occurrences",
+		"19970902T090000",
+		"FREQ=MINUTELY;INTERVAL=90;COUNT=4",
+		[]string{"19970902T090000", "19970902T103000", "19970902T120000", "19970902T133000"},
+	},
+	{
+		"every 20 minutes from 9:00 to 16:40 every day, daily",
+		"19970902T090000",
+		"FREQ=DAILY;BYHOUR=9,10,11,12,13,14,15,16;BYMINUTE=0,20,40",
+		[]string{"19970902T090000", "19970902T092000", "19970902T094000", "19970902T100000", "19970902T102000", "19970902T104000", "19970902T110000", "19970902T112000", "19970902T114000", "19970902T120000", "19970902T122000", "19970902T124000", "19970902T130000", "19970902T132000", "19970902T134000", "19970902T140000", "19970902T142000", "19970902T144000", "19970902T150000", "19970902T152000", "19970902T154000", "19970902T160000", "19970902T162000", "19970902T164000", "19970903T090000"},
+	},
+	{
+		"every 20 minutes from 9:00 to 16:40 every day, minutely",
+		"19970902T090000",
+		"FREQ=MINUTELY;INTERVAL=20;BYHOUR=9,10,11,12,13,14,15,16",
+		[]string{"19970902T090000", "19970902T092000", "19970902T094000", "19970902T100000", "19970902T102000", "19970902T104000", "19970902T110000", "19970902T112000", "19970902T114000", "19970902T120000", "19970902T122000", "19970902T124000", "19970902T130000", "19970902T132000", "19970902T134000", "19970902T140000", "19970902T142000", "19970902T144000", "19970902T150000", "19970902T152000", "19970902T154000", "19970902T160000", "19970902T162000", "19970902T164000", "19970903T090000"},
+	},
+	{
+		"week starting on monday",
+		"19970805T090000",
+		"FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=MO",
+		[]string{"19970805T090000", "19970810T090000", "19970819T090000", "19970824T090000"},
+	},
+	{
+		"week starting on sunday",
+		"19970805T090000",
+		"FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=SU",
+		[]string{"19970805T090000", "19970817T090000", "19970819T090000", "19970831T090000"},
+	},
+	{
+		"invalid dates are ignored",
+		"20070115T090000",
+		"FREQ=MONTHLY;BYMONTHDAY=15,30;COUNT=5",
+		[]string{"20070115T090000", "20070130T090000", "20070215T090000", "20070315T090000", "20070330T090000"},
+	},
+}
+
+func TestRFCExamples(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("America/New_York location not available")
+	}
+
+	for _, tt := range rfcExamples {
+		start := mustParse(t, tt.start, loc)
+		r, err := Parse(tt.rrule, start)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		result := r.All(len(tt.expected) + 1)
+		if r.Count == 0 && r.Until.IsZero() {
+			result = result[:len(tt.expected)]
+		}
+
+		if len(result) != len(tt.expected) {
+			t.Errorf("%s: expected %d occurrences, got %d: %v", tt.name, len(tt.expected), len(result), format(result))
+			continue
+		}
+
+		for i, e := range tt.expected {
+			if expected := mustParse(t, e, loc); !expected.Equal(result[i]) {
+				t.Errorf("%s: expected occurrence %d to be %s, got %s", tt.name, i, expected, result[i])
+			}
+		}
+	}
+}
+
+func TestUntil(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("America/New_York location not available")
+	}
+
+	start := mustParse(t, "19970902T090000", loc)
+	r, err := Parse("FREQ=DAILY;UNTIL=19971224T000000Z", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := r.All(0)
+	if len(result) != 113 {
+		t.Fatalf("expected %d occurrences, got %d", 113, len(result))
+	}
+
+	if last := mustParse(t, "19971223T090000", loc); !result[112].Equal(last) {
+		t.Errorf("expected last occurrence to be %s, got %s", last, result[112])
+	}
+
+	// every day in january for 3 years, both as yearly and daily rules
+	start = mustParse(t, "19980101T090000", loc)
+	for _, rrule := range []string{
+		"FREQ=YEARLY;UNTIL=20000131T140000Z;BYMONTH=1;BYDAY=SU,MO,TU,WE,TH,FR,SA",
+		"FREQ=DAILY;UNTIL=20000131T140000Z;BYMONTH=1",
+	} {
+		r, err := Parse(rrule, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := r.All(0)
+		if len(result) != 93 {
+			t.Errorf("%s: expected %d occurrences, got %d", rrule, 93, len(result))
+			continue
+		}
+
+		for _, o := range result {
+			if o.Month() != time.January || o.Hour() != 9 {
+				t.Errorf("%s: unexpected occurrence %s", rrule, o)
+			}
+		}
+	}
+}
+
+func TestDaylightSavingTime(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("America/New_York location not available")
+	}
+
+	start := mustParse(t, "19971021T090000", loc)
+	r, err := Parse("FREQ=WEEKLY;COUNT=3", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, o := range r.All(0) {
+		if o.Hour() != 9 {
+			t.Errorf("expected occurrences at 9:00 local time, got %s", o)
+		}
+	}
+}
+
+func TestBetween(t *testing.T) {
+	start := time.Date(2016, time.April, 21, 10, 0, 0, 0, time.UTC)
+	r, err := Parse("FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TU,WE,TH,FR", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := r.Between(time.Date(2016, time.July, 11, 0, 0, 0, 0, time.UTC), time.Date(2016, time.July, 25, 0, 0, 0, 0, time.UTC))
+	expected := []string{"20160711T100000", "20160712T100000", "20160713T100000", "20160714T100000", "20160715T100000"}
+	if len(result) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, format(result))
+	}
+
+	for i, e := range expected {
+		if !mustParse(t, e, time.UTC).Equal(result[i]) {
+			t.Errorf("expected %v, got %v", expected, format(result))
+		}
+	}
+}
+
+func TestSecondly(t *testing.T) {
+	start := time.Date(2016, time.January, 31, 23, 59, 58, 0, time.UTC)
+	r, err := Parse("FREQ=SECONDLY;INTERVAL=2;BYMONTH=2;COUNT=3", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := r.All(0)
+	expected := []time.Time{
+		start,
+		time.Date(2016, time.February, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2016, time.February, 1, 0, 0, 2, 0, time.UTC),
+	}
+
+	if len(result) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, result)
+	}
+
+	for i := range expected {
+		if !expected[i].Equal(result[i]) {
+			t.Errorf("expected %v, got %v", expected, result)
+		}
+	}
+}
+
+func TestLeapSecond(t *testing.T) {
+	start := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+	cases := map[string][]time.Time{
+		"FREQ=SECONDLY;BYSECOND=60;COUNT=2": {
+			start,
+			time.Date(2016, time.January, 1, 0, 0, 59, 0, time.UTC),
+		},
+		"FREQ=SECONDLY;BYMINUTE=30;BYSECOND=59,60;COUNT=3": {
+			start,
+			time.Date(2016, time.January, 1, 0, 30, 59, 0, time.UTC),
+			time.Date(2016, time.January, 1, 1, 30, 59, 0, time.UTC),
+		},
+	}
+
+	for rule, expected := range cases {
+		r, err := Parse(rule, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the rules used to take until the year 9999 to find no occurrence
+		done := make(chan []time.Time, 1)
+		go func() { done <- r.All(0) }()
+
+		select {
+		case result := <-done:
+			if len(result) != len(expected) {
+				t.Fatalf("%s: expected %v, got %v", rule, expected, result)
+			}
+
+			for i := range expected {
+				if !expected[i].Equal(result[i]) {
+					t.Errorf("%s: expected %v, got %v", rule, expected, result)
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: expected the occurrences to be found in time", rule)
+		}
+	}
+}
+
+func TestNeverMatchingRule(t *testing.T) {
+	start := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+	r, err := Parse("FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result := r.All(0); len(result) != 1 {
+		t.Errorf("expected only the start, got %v", result)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	start := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+	rules := []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=FORTNIGHTLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=2;UNTIL=20160101T000000Z",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;BYDAY=0MO",
+		"FREQ=MONTHLY;BYDAY=MX",
+		"FREQ=YEARLY;BYMONTH=13",
+		"FREQ=DAILY;BYHOUR=24",
+		"FREQ",
+	}
+
+	for _, rule := range rules {
+		if _, err := Parse(rule, start); err == nil {
+			t.Errorf("expected an error parsing %q", rule)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	start := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+	rules := []string{
+		"FREQ=MONTHLY;INTERVAL=2;COUNT=10;BYDAY=1SU,-1SU",
+		"FREQ=WEEKLY;UNTIL=19971007T000000Z;BYDAY=TU,TH;WKST=SU",
+		"FREQ=YEARLY;UNTIL=20201231;BYMONTHDAY=2,3;BYMONTH=11;BYSETPOS=-1",
+		"FREQ=DAILY;BYSECOND=0;BYMINUTE=0,20,40;BYHOUR=9,10",
+	}
+
+	for _, rule := range rules {
+		r, err := Parse(rule, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if r.String() != rule {
+			t.Errorf("expected %q, got %q", rule, r.String())
+		}
+	}
+}
+
+func mustParse(t *testing.T, s string, loc *time.Location) time.Time {
+	tm, err := time.ParseInLocation("20060102T150405", s, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+func format(times []time.Time) string {
+	strs := make([]string, len(times))
+	for i, t := range times {
+		strs[i] = t.Format("20060102T150405")
+	}
+	return strings.Join(strs, ",")
+}
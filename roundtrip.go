@@ -0,0 +1,258 @@
+package ics
+
+import "strings"
+
+// roundTripCalendarComponent returns the component to write for a parsed
+// calendar in round-trip mode. The components of the events and todos that
+// were not modified are kept as they were, removed ones are left out and
+// new ones are added after all the original components. Components that
+// only have repetitions generated from them left, such as the one of a
+// repeating event whose first instance is overridden, are kept as they
+// were, as repetitions can not change them.
+func roundTripCalendarComponent(cal *Calendar) *Component {
+	c := mergeTyped(cal.Component, calendarHeader(cal))
+	if c == cal.Component {
+		copied := *c
+		c = &copied
+	}
+
+	entities := cal.typedEntities()
+	byComponent := make(map[*Component]int)
+	repeated := make(map[*Component]bool)
+	var added []typedEntity
+	for i, entity := range entities {
+		if entity.component == nil {
+			added = append(added, entity)
+			continue
+		}
+
+		if entity.repetition {
+			repeated[entity.component] = true
+			continue
+		}
+
+		if _, ok := byComponent[entity.component]; !ok {
+			byComponent[entity.component] = i
+		}
+	}
+
+	var children []*Component
+	seen := make(map[*Component]bool)
+	for _, child := range cal.Component.Children {
+		if !typedComponents[child.Name] {
+			children = append(children, child)
+			continue
+		}
+
+		if i, ok := byComponent[child]; ok {
+			children = append(children, mergeTyped(child, entities[i].generate()))
+			seen[child] = true
+		} else if repeated[child] {
+			children = append(children, child)
+			seen[child] = true
+		}
+	}
+
+	for i, entity := range entities {
+		if entity.component != nil && !seen[entity.component] && !entity.repetition && byComponent[entity.component] == i {
+			added = append(added, entity)
+		}
+	}
+
+	for _, entity := range added {
+		children = append(children, mergeTyped(entity.component, entity.generate()))
+	}
+
+	c.Children = children
+	addTimezones(c)
+	return withoutReplyStamps(c, cal.Method)
+}
+
+// mergeTyped returns the component to write for a typed entity parsed from
+// orig whose current state generates the given component. The properties
+// whose generated form did not change since the entity was parsed are kept
+// from orig and the rest are replaced by the generated ones. If nothing
+// changed orig itself is returned.
+func mergeTyped(orig, generated *Component) *Component {
+	if orig == nil {
+		return generated
+	}
+
+	changed := changedProperties(orig.typed, generated)
+	childrenChanged := formatChildren(orig.typed) != formatChildren(generated)
+	if len(changed) == 0 && !childrenChanged {
+		return orig
+	}
+
+	c := *orig
+	if childrenChanged {
+		c.Children = mergeChildren(orig, generated)
+	}
+
+	if len(changed) == 0 {
+		return &c
+	}
+
+	c.Properties = nil
+	inserted := make(map[string]bool)
+	for _, p := range orig.Properties {
+		if !changed[p.Name] {
+			c.Properties = append(c.Properties, p)
+			continue
+		}
+
+		if !inserted[p.Name] {
+			for _, g := range generated.PropertiesNamed(p.Name) {
+				c.Properties = append(c.Properties, mergeProperty(g, orig))
+			}
+			inserted[p.Name] = true
+		}
+	}
+
+	for _, p := range generated.Properties {
+		if changed[p.Name] && !inserted[p.Name] {
+			c.Properties = append(c.Properties, p)
+		}
+	}
+
+	return &c
+}
+
+// mergeChildren returns the nested components to write for a typed entity
+// parsed from orig whose current state generates the given component. The
+// nested components of orig that are not generated from the entity are
+// kept first, followed by the generated ones, which are merged with the
+// components they come from.
+func mergeChildren(orig, generated *Component) []*Component {
+	names := make(map[string]bool)
+	for _, c := range []*Component{orig.typed, generated} {
+		if c == nil {
+			continue
+		}
+
+		for _, child := range c.Children {
+			names[child.Name] = true
+		}
+	}
+
+	var children []*Component
+	for _, child := range orig.Children {
+		if !names[child.Name] {
+			children = append(children, child)
+		}
+	}
+
+	for _, child := range generated.Children {
+		children = append(children, mergeTyped(child.origin, child))
+	}
+
+	return children
+}
+
+// formatChildren returns all the nested components of c, at any depth, in
+// a form that can be compared.
+func formatChildren(c *Component) string {
+	if c == nil {
+		return ""
+	}
+
+	var buf strings.Builder
+	for _, child := range c.Children {
+		buf.WriteString("BEGIN:" + child.Name + "\n")
+		for _, p := range child.Properties {
+			buf.WriteString(formatProperty(p) + "\n")
+		}
+		buf.WriteString(formatChildren(child))
+		buf.WriteString("END:" + child.Name + "\n")
+	}
+	return buf.String()
+}
+
+// mergeProperty returns the property to write for the generated property
+// of a changed group of properties, such as one of the attendees of an
+// event, matching it with the original property with the same value. If
+// the generated property did not change the original one is kept, and if
+// it did the parameters of the original one that are unknown to the typed
+// entity are copied to it.
+func mergeProperty(generated *Property, orig *Component) *Property {
+	var o, typed *Property
+	for _, p := range orig.PropertiesNamed(generated.Name) {
+		if p.Value == generated.Value {
+			o = p
+			break
+		}
+	}
+
+	if o == nil || orig.typed == nil {
+		return generated
+	}
+
+	for _, p := range orig.typed.PropertiesNamed(generated.Name) {
+		if p.Value == generated.Value {
+			typed = p
+			break
+		}
+	}
+
+	if typed == nil {
+		return generated
+	}
+
+	if formatProperty(typed) == formatProperty(generated) {
+		return o
+	}
+
+	result := *generated
+	result.Params = append(Params(nil), generated.Params...)
+	for _, param := range o.Params {
+		if typed.Params.Values(param.Name) == nil && result.Params.Values(param.Name) == nil {
+			result.Params = append(result.Params, param)
+		}
+	}
+	return &result
+}
+
+// changedProperties returns the names of the properties that are not
+// identical in both components.
+func changedProperties(before, after *Component) map[string]bool {
+	formatted := func(c *Component) map[string][]string {
+		result := make(map[string][]string)
+		if c == nil {
+			return result
+		}
+
+		for _, p := range c.Properties {
+			result[p.Name] = append(result[p.Name], formatProperty(p))
+		}
+		return result
+	}
+
+	b, a := formatted(before), formatted(after)
+	changed := make(map[string]bool)
+	for name, props := range a {
+		if !equalStrings(props, b[name]) {
+			changed[name] = true
+		}
+	}
+
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			changed[name] = true
+		}
+	}
+
+	return changed
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
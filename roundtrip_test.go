@@ -0,0 +1,189 @@
+package ics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRoundTripFixtures(t *testing.T) {
+	files := []string{
+		"testCalendars/2eventsCal.ics",
+		"testCalendars/3eventsNoAttendee.ics",
+		"testCalendars/repetition.ics",
+	}
+
+	for _, f := range files {
+		content, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		calendar, err := ParseICalContent(string(content), f, 0)
+		if err != nil {
+			t.Fatalf("%s: %s", f, err)
+		}
+
+		if out := encodeRoundTrip(t, &calendar); out != string(content) {
+			t.Errorf("%s: expected output to be identical to the input, got:\n%s", f, out)
+		}
+	}
+}
+
+func TestRoundTripModifiedEvent(t *testing.T) {
+	content, err := ioutil.ReadFile("testCalendars/2eventsCal.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calendar, err := ParseICalContent(string(content), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var modified *Event
+	for i, e := range calendar.Events {
+		if e.Summary == "General Operative Meeting" {
+			modified = &calendar.Events[i]
+		}
+	}
+	modified.Summary = "General Operative Meeting (moved)"
+	modified.Attendees[0].Status = "DECLINED"
+
+	out := encodeRoundTrip(t, &calendar)
+	expected := strings.NewReplacer(
+		"SUMMARY:General Operative Meeting\n",
+		"SUMMARY:General Operative Meeting (moved)\r\n",
+		"ATTENDEE;CUTYPE=INDIVIDUAL;ROLE=REQ-PARTICIPANT;PARTSTAT=ACCEPTED;CN=John S\n mith;X-NUM-GUESTS=0:mailto:j.smith@gmail.com\n",
+		"ATTENDEE;CUTYPE=INDIVIDUAL;ROLE=REQ-PARTICIPANT;PARTSTAT=DECLINED;CN=John S\r\n mith;X-NUM-GUESTS=0:mailto:j.smith@gmail.com\r\n",
+	).Replace(string(content))
+
+	if out != expected {
+		t.Errorf("expected only the modified properties to change, got:\n%s", out)
+	}
+
+	result, err := ParseICalContent(out, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCalendarsEqual(t, calendar, result)
+}
+
+func TestRoundTripAddedAndRemovedEvents(t *testing.T) {
+	content, err := ioutil.ReadFile("testCalendars/3eventsNoAttendee.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calendar, err := ParseICalContent(string(content), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sortEvents(calendar.Events)
+	removed := calendar.Events[0].Summary
+	added := calendar.Events[0]
+	added.Component = nil
+	added.ID = "new@example.com"
+	added.Summary = "New event"
+	calendar.Events = append(calendar.Events[1:], added)
+
+	out := encodeRoundTrip(t, &calendar)
+	if strings.Contains(out, "SUMMARY:"+removed+"\n") {
+		t.Errorf("expected removed event not to be written, got:\n%s", out)
+	}
+
+	if !strings.Contains(out, "BEGIN:VTIMEZONE\nTZID:Europe/Sofia\n") {
+		t.Errorf("expected VTIMEZONE to be kept, got:\n%s", out)
+	}
+
+	if !strings.Contains(out, "UID:new@example.com\r\n") {
+		t.Errorf("expected new event to be written, got:\n%s", out)
+	}
+
+	result, err := ParseICalContent(out, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCalendarsEqual(t, calendar, result)
+}
+
+func TestRoundTripRepetitions(t *testing.T) {
+	content := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"UID:daily@example.com",
+		"DTSTAMP:20240101T000000Z",
+		"DTSTART:20240101T100000Z",
+		"DTEND:20240101T110000Z",
+		"RRULE:FREQ=DAILY;COUNT=3",
+		"SUMMARY:Daily",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:daily@example.com",
+		"DTSTAMP:20240101T000000Z",
+		"RECURRENCE-ID:20240101T100000Z",
+		"DTSTART:20240101T120000Z",
+		"DTEND:20240101T130000Z",
+		"SUMMARY:Daily (moved)",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n") + "\r\n"
+
+	calendar, err := ParseICalContent(content, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first instance is overridden, so there is no event that is not
+	// an override or a repetition for the repeating event
+	if len(calendar.Events) != 3 || calendar.Events[0].RecurrenceID.IsZero() || calendar.Events[1].Repetition != 1 {
+		t.Fatalf("unexpected events %+v", calendar.Events)
+	}
+
+	calendar.Events[1].Summary = "Changed repetition"
+	if out := encodeRoundTrip(t, &calendar); out != content {
+		t.Errorf("expected repetitions not to change the repeating event, got:\n%s", out)
+	}
+
+	calendar.Events[0].Summary = "Daily (moved again)"
+	out := encodeRoundTrip(t, &calendar)
+	expected := strings.Replace(content, "SUMMARY:Daily (moved)", "SUMMARY:Daily (moved again)", 1)
+	if out != expected {
+		t.Errorf("expected only the override to change, got:\n%s", out)
+	}
+}
+
+func TestRoundTripModifiedComponent(t *testing.T) {
+	content := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nX-FOO;A=\"b\":c\r\nBEGIN:X-THING\r\nX-BAR:1\r\nEND:X-THING\r\nEND:VCALENDAR\r\n"
+	comp, err := NewDecoder(strings.NewReader(content)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comp.Children[0].Property("X-BAR").Value = "2"
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetRoundTrip(true)
+	if err := enc.EncodeComponent(comp); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Replace(content, "X-BAR:1", "X-BAR:2", 1)
+	if buf.String() != expected {
+		t.Errorf("expected:\n%q\ngot:\n%q", expected, buf.String())
+	}
+}
+
+func encodeRoundTrip(t *testing.T, cal *Calendar) string {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetRoundTrip(true)
+	if err := enc.Encode(cal); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,203 @@
+package ics
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// schedulerHorizon is how far ahead of the current time the scheduler looks
+// for alarms each time it wakes up.
+const schedulerHorizon = 24 * time.Hour
+
+// Clock tells the current time and waits for durations to pass. It allows
+// to control the time of a Scheduler.
+type Clock interface {
+	Now() time.Time
+	// After returns a channel that receives the current time once the
+	// given duration has passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// AlarmFired is an alarm that went off for an occurrence of an event or a
+// todo. Only one of Event and Todo is set. The occurrence of a todo starts
+// at the start of the todo and ends when it is due.
+type AlarmFired struct {
+	Event      *Event
+	Todo       *Todo
+	Occurrence Occurrence
+	Alarm      Alarm
+	// At is the time the alarm was scheduled to go off.
+	At time.Time
+}
+
+// Scheduler delivers the alarms of the events and todos of some calendars
+// when they go off.
+type Scheduler struct {
+	clock  Clock
+	reload chan struct{}
+
+	mu        sync.Mutex
+	calendars []*Calendar
+}
+
+// NewScheduler returns a new scheduler of the alarms in the given
+// calendars, which uses the given clock to tell the time. If clock is nil
+// the system clock is used.
+func NewScheduler(clock Clock, calendars ...*Calendar) *Scheduler {
+	if clock == nil {
+		clock = systemClock{}
+	}
+
+	return &Scheduler{
+		clock:     clock,
+		reload:    make(chan struct{}, 1),
+		calendars: calendars,
+	}
+}
+
+// SetCalendars replaces the calendars of the scheduler, even if it is
+// running. Alarms that already went off are not delivered again, even if
+// they are in the new calendars.
+func (s *Scheduler) SetCalendars(calendars ...*Calendar) {
+	s.mu.Lock()
+	s.calendars = calendars
+	s.mu.Unlock()
+
+	select {
+	case s.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Run calls fn with every alarm that goes off from now on, in order, until
+// the context is done, and returns the error of the context. Alarms that
+// should have gone off before Run was called are not delivered.
+func (s *Scheduler) Run(ctx context.Context, fn func(AlarmFired)) error {
+	last := s.clock.Now()
+	for {
+		now := s.clock.Now()
+		wait := schedulerHorizon
+		for _, f := range s.firings(last, now.Add(schedulerHorizon)) {
+			if f.At.After(now) {
+				wait = f.At.Sub(now)
+				break
+			}
+			fn(f)
+		}
+
+		if now.After(last) {
+			last = now
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.reload:
+		case <-s.clock.After(wait):
+		}
+	}
+}
+
+// firings returns the alarms of the calendars of the scheduler that go off
+// after from and not after to, ordered by the time they go off.
+func (s *Scheduler) firings(from, to time.Time) []AlarmFired {
+	s.mu.Lock()
+	calendars := s.calendars
+	s.mu.Unlock()
+
+	var result []AlarmFired
+	add := func(f AlarmFired) {
+		if f.At.After(from) && !f.At.After(to) {
+			result = append(result, f)
+		}
+	}
+
+	for _, cal := range calendars {
+		var span time.Duration
+		for i := range cal.Events {
+			e := &cal.Events[i]
+			for _, a := range e.Alarms {
+				if a.TriggerTime.IsZero() {
+					span = max(span, alarmSpan(a))
+					continue
+				}
+
+				for _, at := range a.FireTimes(Occurrence{}) {
+					add(AlarmFired{Event: e, Occurrence: firstOccurrence(e), Alarm: a, At: at})
+				}
+			}
+		}
+
+		for o := range cal.Between(from.Add(-span), to.Add(span)) {
+			for _, a := range o.Event.Alarms {
+				if !a.TriggerTime.IsZero() {
+					continue
+				}
+
+				for _, at := range a.FireTimes(o) {
+					add(AlarmFired{Event: o.Event, Occurrence: o, Alarm: a, At: at})
+				}
+			}
+		}
+
+		for i := range cal.Todos {
+			t := &cal.Todos[i]
+			for _, a := range t.Alarms {
+				if !a.TriggerTime.IsZero() {
+					for _, at := range a.FireTimes(Occurrence{}) {
+						add(AlarmFired{Todo: t, Occurrence: Occurrence{Start: t.Start, End: t.Due}, Alarm: a, At: at})
+					}
+					continue
+				}
+
+				span := alarmSpan(a)
+				for o := range t.Occurrences(from.Add(-span), to.Add(span)) {
+					occurrence := Occurrence{Start: o.Start, End: o.Due, RecurrenceID: o.RecurrenceID}
+					for _, at := range a.FireTimes(occurrence) {
+						add(AlarmFired{Todo: t, Occurrence: occurrence, Alarm: a, At: at})
+					}
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].At.Before(result[j].At)
+	})
+	return result
+}
+
+// alarmSpan returns how far from the start or end of an occurrence a
+// relative alarm can go off.
+func alarmSpan(a Alarm) time.Duration {
+	span := a.Trigger
+	if span < 0 {
+		span = -span
+	}
+
+	if a.Duration > 0 {
+		span += time.Duration(a.Repeat) * a.Duration
+	}
+	return span
+}
+
+// firstOccurrence returns the first occurrence of the event, which is the
+// one alarms with an absolute trigger go off for.
+func firstOccurrence(e *Event) Occurrence {
+	for o := range e.Occurrences(time.Time{}, time.Time{}) {
+		return o
+	}
+	return Occurrence{Event: e, Start: e.Start, End: e.End, RecurrenceID: e.RecurrenceID}
+}
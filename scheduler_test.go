@@ -0,0 +1,157 @@
+package ics
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// fakeClock is a clock whose time only changes when it is advanced. Every
+// time someone waits on it a value is sent on waiting.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []fakeTimer
+	waiting chan struct{}
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, waiting: make(chan struct{}, 16)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := fakeTimer{c.now.Add(d), make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	c.waiting <- struct{}{}
+	return t.c
+}
+
+func (c *fakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+	var timers []fakeTimer
+	for _, t := range c.timers {
+		if t.at.After(now) {
+			timers = append(timers, t)
+		} else {
+			t.c <- now
+		}
+	}
+	c.timers = timers
+}
+
+func (c *fakeClock) wait(t *testing.T) {
+	select {
+	case <-c.waiting:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduler did not wait for the clock")
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	cal, err := ParseICalContent(testAlarms, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := func(day, hour, min int) time.Time {
+		return time.Date(2016, time.July, day, hour, min, 0, 0, time.UTC)
+	}
+
+	clock := newFakeClock(date(4, 9, 0))
+	scheduler := NewScheduler(clock, &cal)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fired := make(chan AlarmFired, 16)
+	done := make(chan error)
+	go func() {
+		done <- scheduler.Run(ctx, func(f AlarmFired) { fired <- f })
+	}()
+
+	expect := func(expected ...time.Time) {
+		t.Helper()
+		clock.wait(t)
+		for _, at := range expected {
+			select {
+			case f := <-fired:
+				if !f.At.Equal(at) {
+					t.Errorf("expected alarm at %s, got %s", at, f.At)
+				}
+			default:
+				t.Errorf("expected alarm at %s", at)
+			}
+		}
+
+		select {
+		case f := <-fired:
+			t.Errorf("unexpected alarm at %s", f.At)
+		default:
+		}
+	}
+
+	expect()
+
+	clock.Set(date(4, 9, 45))
+	expect(date(4, 9, 45))
+
+	clock.Set(date(4, 9, 52))
+	expect(date(4, 9, 50))
+
+	reloaded, err := ParseICalContent(testAlarms, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler.SetCalendars(&reloaded)
+	expect()
+
+	clock.Set(date(4, 11, 0))
+	expect(date(4, 9, 55), date(4, 11, 0))
+
+	clock.Set(date(5, 10, 0))
+	expect(date(4, 17, 0), date(5, 9, 0))
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected context to be canceled, got %v", err)
+	}
+}
+
+func TestSchedulerFirings(t *testing.T) {
+	cal, err := ParseICalContent(testAlarms, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := NewScheduler(nil, &cal)
+	firings := scheduler.firings(
+		time.Date(2016, time.July, 4, 0, 0, 0, 0, time.UTC),
+		time.Date(2016, time.July, 6, 0, 0, 0, 0, time.UTC),
+	)
+
+	if len(firings) != 6 {
+		t.Fatalf("expected 6 alarms, got %d", len(firings))
+	}
+
+	if firings[0].Event != &cal.Events[0] || firings[0].Occurrence.Event != &cal.Events[0] {
+		t.Errorf("expected first alarm to be of the event, got %+v", firings[0])
+	}
+
+	if last := firings[5]; last.Todo != &cal.Todos[0] || last.Alarm.Action != AlarmAudio {
+		t.Errorf("expected last alarm to be the absolute alarm of the todo, got %+v", last)
+	}
+}
@@ -0,0 +1,271 @@
+package ics
+
+import (
+	"sort"
+	"time"
+)
+
+// defaultSlotStep is the time between the starts of candidate slots when
+// the search does not define it.
+const defaultSlotStep = 15 * time.Minute
+
+// WorkingHours are the hours of the day someone can attend meetings, from
+// Start to End after midnight in Location on the given days. If Days is
+// empty they are the hours of every day from Monday to Friday. A zero
+// WorkingHours means any time of any day. If Location is nil the hours
+// are in UTC.
+type WorkingHours struct {
+	Location *time.Location
+	Start    time.Duration
+	End      time.Duration
+	Days     []time.Weekday
+}
+
+// Participant is someone who has to attend a meeting, with the calendar of
+// their busy time and their working hours.
+type Participant struct {
+	Calendar     *Calendar
+	WorkingHours WorkingHours
+}
+
+// SlotSearch describes the slots to look for. Participants need to be
+// free BufferBefore before the start of a slot and BufferAfter after its
+// end, to have time between meetings. Candidate slots start every Step,
+// 15 minutes by default. If Limit is not zero at most Limit slots are
+// returned.
+type SlotSearch struct {
+	From         time.Time
+	To           time.Time
+	Duration     time.Duration
+	BufferBefore time.Duration
+	BufferAfter  time.Duration
+	Step         time.Duration
+	Limit        int
+}
+
+// Slot is a time window in which all the participants of a meeting are free.
+// Score is between 0 and 1, and it is higher the closer the slot is to the
+// middle of the working hours of the participants.
+type Slot struct {
+	Start time.Time
+	End   time.Time
+	Score float64
+}
+
+// FindSlots returns the slots between search.From and search.To in which
+// all the participants are free and within their working hours, ranked by
+// their score and then by their start. Participants are busy during the
+// busy time of their calendars, as returned by Calendar.FreeBusy, so
+// repeating events are expanded and whole day events take the whole day,
+// unless they are transparent.
+func FindSlots(participants []Participant, search SlotSearch) []Slot {
+	if search.Duration <= 0 || !search.From.Before(search.To) {
+		return nil
+	}
+
+	step := search.Step
+	if step <= 0 {
+		step = defaultSlotStep
+	}
+
+	free := []Period{{Start: search.From, End: search.To}}
+	for _, p := range participants {
+		free = intersectPeriods(free, p.free(search))
+	}
+
+	var slots []Slot
+	for _, f := range free {
+		start := f.Start.Truncate(step)
+		if start.Before(f.Start) {
+			start = start.Add(step)
+		}
+
+		for ; !start.Add(search.Duration).After(f.End); start = start.Add(step) {
+			slot := Slot{Start: start, End: start.Add(search.Duration)}
+			slot.Score = slotScore(participants, slot)
+			slots = append(slots, slot)
+		}
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		return slots[i].Score > slots[j].Score
+	})
+
+	if search.Limit > 0 && len(slots) > search.Limit {
+		slots = slots[:search.Limit]
+	}
+	return slots
+}
+
+// free returns the time in which the participant is free between the start
+// and end of the search, taking the buffers of the search into account, in
+// order.
+func (p Participant) free(search SlotSearch) []Period {
+	free := p.WorkingHours.between(search.From, search.To)
+	if p.Calendar == nil {
+		return free
+	}
+
+	fb := p.Calendar.FreeBusy(search.From.Add(-search.BufferAfter), search.To.Add(search.BufferBefore))
+	var busy []Period
+	for _, b := range fb.Periods {
+		if b.Type == FreeBusyFree {
+			continue
+		}
+
+		busy = append(busy, Period{
+			Start: b.Start.Add(-search.BufferAfter),
+			End:   b.End.Add(search.BufferBefore),
+		})
+	}
+
+	return subtractPeriods(free, mergePeriods(busy))
+}
+
+// between returns the working hours between from and to, in order.
+func (h WorkingHours) between(from, to time.Time) []Period {
+	if h.Start == 0 && h.End == 0 && len(h.Days) == 0 {
+		return []Period{{Start: from, End: to}}
+	}
+
+	var result []Period
+	for _, p := range h.days(from, to) {
+		if p.Start.Before(from) {
+			p.Start = from
+		}
+
+		if p.End.After(to) {
+			p.End = to
+		}
+
+		if p.Start.Before(p.End) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// days returns the working hours of all the working days that overlap
+// with the time between from and to, without clipping them.
+func (h WorkingHours) days(from, to time.Time) []Period {
+	loc := h.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	var result []Period
+	from = from.In(loc)
+	day := time.Date(from.Year(), from.Month(), from.Day()-1, 0, 0, 0, 0, loc)
+	for ; day.Before(to); day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc) {
+		if !h.isWorkingDay(day.Weekday()) {
+			continue
+		}
+
+		result = append(result, Period{
+			Start: time.Date(day.Year(), day.Month(), day.Day(), 0, 0, int(h.Start/time.Second), 0, loc),
+			End:   time.Date(day.Year(), day.Month(), day.Day(), 0, 0, int(h.End/time.Second), 0, loc),
+		})
+	}
+	return result
+}
+
+func (h WorkingHours) isWorkingDay(day time.Weekday) bool {
+	if len(h.Days) == 0 {
+		return day != time.Saturday && day != time.Sunday
+	}
+
+	for _, d := range h.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// slotScore returns the average, for all the participants, of how close
+// the middle of the slot is to the middle of their working hours, from 0
+// at their start or end to 1 at their middle.
+func slotScore(participants []Participant, slot Slot) float64 {
+	if len(participants) == 0 {
+		return 1
+	}
+
+	middle := slot.Start.Add(slot.End.Sub(slot.Start) / 2)
+	var total float64
+	for _, p := range participants {
+		if p.WorkingHours.Start == 0 && p.WorkingHours.End == 0 && len(p.WorkingHours.Days) == 0 {
+			total++
+			continue
+		}
+
+		for _, day := range p.WorkingHours.days(slot.Start, slot.End) {
+			if middle.Before(day.Start) || middle.After(day.End) {
+				continue
+			}
+
+			half := day.End.Sub(day.Start) / 2
+			distance := middle.Sub(day.Start.Add(half))
+			if distance < 0 {
+				distance = -distance
+			}
+			total += 1 - float64(distance)/float64(half)
+			break
+		}
+	}
+	return total / float64(len(participants))
+}
+
+// intersectPeriods returns the time that is in both lists of periods, which
+// must be ordered and not overlap.
+func intersectPeriods(a, b []Period) []Period {
+	var result []Period
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		start, end := a[i].Start, a[i].End
+		if b[j].Start.After(start) {
+			start = b[j].Start
+		}
+
+		if b[j].End.Before(end) {
+			end = b[j].End
+		}
+
+		if start.Before(end) {
+			result = append(result, Period{Start: start, End: end})
+		}
+
+		if a[i].End.Before(b[j].End) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
+
+// subtractPeriods returns the time of the periods in a that is not in any
+// of the periods in b, with the type of the periods in a. Both lists must
+// be ordered and not overlap.
+func subtractPeriods(a, b []Period) []Period {
+	var result []Period
+	j := 0
+	for _, p := range a {
+		start := p.Start
+		for ; j < len(b) && !b[j].Start.After(p.End); j++ {
+			if b[j].End.After(start) {
+				if b[j].Start.After(start) {
+					result = append(result, Period{Start: start, End: b[j].Start, Type: p.Type})
+				}
+				start = b[j].End
+			}
+
+			if b[j].End.After(p.End) {
+				break
+			}
+		}
+
+		if start.Before(p.End) {
+			result = append(result, Period{Start: start, End: p.End, Type: p.Type})
+		}
+	}
+	return result
+}
@@ -0,0 +1,148 @@
+package ics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindSlots(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.FailNow()
+	}
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.FailNow()
+	}
+
+	alice, err := ParseICalContent(strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"X-WR-TIMEZONE:Europe/Madrid",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"DTSTART;TZID=Europe/Madrid:20160704T153000",
+		"DTEND;TZID=Europe/Madrid:20160704T160000",
+		"RRULE:FREQ=DAILY",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:offsite",
+		"DTSTART;VALUE=DATE:20160706",
+		"DTEND;VALUE=DATE:20160707",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:birthday",
+		"DTSTART;VALUE=DATE:20160707",
+		"DTEND;VALUE=DATE:20160708",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n"), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob, err := ParseICalContent(strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:review",
+		"DTSTART;TZID=America/New_York:20160708T103000",
+		"DTEND;TZID=America/New_York:20160708T110000",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n"), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	participants := []Participant{
+		{&alice, WorkingHours{Location: madrid, Start: 9 * time.Hour, End: 17 * time.Hour}},
+		{&bob, WorkingHours{Location: newYork, Start: 9 * time.Hour, End: 17 * time.Hour}},
+	}
+
+	date := func(day, hour, min int) time.Time {
+		return time.Date(2016, time.July, day, hour, min, 0, 0, time.UTC)
+	}
+
+	slots := FindSlots(participants, SlotSearch{
+		From:         date(4, 0, 0),
+		To:           date(11, 0, 0),
+		Duration:     30 * time.Minute,
+		BufferBefore: 10 * time.Minute,
+		BufferAfter:  10 * time.Minute,
+	})
+
+	// both are in their working hours from 13:00 to 15:00 UTC, alice has
+	// her standup from 13:30 to 14:00 UTC every day, is out on Wednesday
+	// and bob is busy on Friday from 14:30 to 15:00 UTC
+	expected := []time.Time{
+		date(4, 14, 15), date(4, 14, 30),
+		date(5, 14, 15), date(5, 14, 30),
+		date(7, 14, 15), date(7, 14, 30),
+	}
+
+	if len(slots) != len(expected) {
+		t.Fatalf("expected %d slots, got %v", len(expected), slots)
+	}
+
+	for i, s := range slots {
+		if !s.Start.Equal(expected[i]) || s.End.Sub(s.Start) != 30*time.Minute {
+			t.Errorf("expected slot %d to start at %s, got %s to %s", i, expected[i], s.Start, s.End)
+		}
+	}
+}
+
+func TestFindSlotsRanking(t *testing.T) {
+	cal := NewCalendar()
+	participants := []Participant{
+		{&cal, WorkingHours{Start: 9 * time.Hour, End: 17 * time.Hour, Days: []time.Weekday{time.Saturday}}},
+	}
+
+	slots := FindSlots(participants, SlotSearch{
+		From:     time.Date(2016, time.July, 4, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2016, time.July, 11, 0, 0, 0, 0, time.UTC),
+		Duration: 2 * time.Hour,
+		Step:     time.Hour,
+		Limit:    3,
+	})
+
+	expected := []struct {
+		hour  int
+		score float64
+	}{
+		{12, 1},
+		{11, 0.75},
+		{13, 0.75},
+	}
+
+	if len(slots) != len(expected) {
+		t.Fatalf("expected %d slots, got %v", len(expected), slots)
+	}
+
+	for i, s := range slots {
+		start := time.Date(2016, time.July, 9, expected[i].hour, 0, 0, 0, time.UTC)
+		if !s.Start.Equal(start) || s.Score != expected[i].score {
+			t.Errorf("expected slot %d to start at %s with score %v, got %s with %v", i, start, expected[i].score, s.Start, s.Score)
+		}
+	}
+}
+
+func TestSubtractPeriods(t *testing.T) {
+	date := func(hour int) time.Time {
+		return time.Date(2016, time.July, 4, hour, 0, 0, 0, time.UTC)
+	}
+
+	free := subtractPeriods(
+		[]Period{{Start: date(1), End: date(5)}, {Start: date(6), End: date(10)}},
+		[]Period{{Start: date(0), End: date(2)}, {Start: date(3), End: date(4)}, {Start: date(5), End: date(7)}, {Start: date(9), End: date(12)}},
+	)
+
+	expected := []Period{
+		{Start: date(2), End: date(3)},
+		{Start: date(4), End: date(5)},
+		{Start: date(7), End: date(9)},
+	}
+
+	assertPeriodsEqual(t, expected, free)
+}
@@ -0,0 +1,562 @@
+package ics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erizocosmico/go-ics/recurrence"
+)
+
+// Timezones are the locations defined by the VTIMEZONE components of a
+// calendar, by their TZID.
+type Timezones map[string]*time.Location
+
+// Location returns the location with the given TZID. Locations defined in
+// the calendar take precedence over the ones in the IANA database, which
+// are only used when the calendar does not define the TZID itself. TZIDs
+// can also be registered aliases, such as Windows time zone names, or IANA
+// names with a vendor prefix.
+func (tz Timezones) Location(tzid string) (*time.Location, error) {
+	if loc, ok := tz[tzid]; ok {
+		return loc, nil
+	}
+
+	return loadTimezone(tzid)
+}
+
+// timezoneHorizon is the last year for which the transitions of the rules
+// of a VTIMEZONE are computed. Later times use the rules themselves if they
+// can be represented, or the last offset otherwise.
+const timezoneHorizon = 2100
+
+// parseTimezones parses all the VTIMEZONE components of the calendar. The
+// ones that can not be parsed are left out and their errors returned, so
+// their TZIDs are resolved as if the calendar did not define them.
+func parseTimezones(cal *Component) (Timezones, []error) {
+	tz := make(Timezones)
+	var errs []error
+	for _, comp := range cal.ChildrenNamed("VTIMEZONE") {
+		loc, err := parseTimezone(comp)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		tz[loc.String()] = loc
+	}
+	return tz, errs
+}
+
+// observance is a STANDARD or DAYLIGHT component of a VTIMEZONE.
+type observance struct {
+	daylight   bool
+	name       string
+	offsetFrom int
+	offsetTo   int
+	// onsets are the moments in which the observance starts to be used.
+	onsets []time.Time
+	// rule is the recurrence rule of the onsets, if it never ends.
+	rule *recurrence.Recurrence
+}
+
+// parseTimezone returns the location defined by the given VTIMEZONE. Its
+// name is the TZID of the component.
+func parseTimezone(comp *Component) (*time.Location, error) {
+	tzid := comp.Value("TZID")
+	if tzid == "" {
+		return nil, fmt.Errorf("VTIMEZONE without TZID")
+	}
+
+	var observances []*observance
+	for _, child := range comp.Children {
+		if child.Name != "STANDARD" && child.Name != "DAYLIGHT" {
+			continue
+		}
+
+		o, err := parseObservance(child)
+		if err != nil {
+			return nil, fmt.Errorf("VTIMEZONE %s: %s", tzid, err)
+		}
+		observances = append(observances, o)
+	}
+
+	if len(observances) == 0 {
+		return nil, fmt.Errorf("VTIMEZONE %s: no STANDARD or DAYLIGHT components", tzid)
+	}
+
+	data := timezoneData(observances)
+	return time.LoadLocationFromTZData(tzid, data)
+}
+
+func parseObservance(comp *Component) (*observance, error) {
+	o := &observance{
+		daylight: comp.Name == "DAYLIGHT",
+		name:     comp.Value("TZNAME"),
+	}
+
+	var err error
+	o.offsetFrom, err = parseUTCOffset(comp.Value("TZOFFSETFROM"))
+	if err != nil {
+		return nil, fmt.Errorf("TZOFFSETFROM: %s", err)
+	}
+
+	o.offsetTo, err = parseUTCOffset(comp.Value("TZOFFSETTO"))
+	if err != nil {
+		return nil, fmt.Errorf("TZOFFSETTO: %s", err)
+	}
+
+	// times of the observance are wall clock times before its onset
+	loc := time.FixedZone(o.name, o.offsetFrom)
+	start, err := time.ParseInLocation("20060102T150405", comp.Value("DTSTART"), loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DTSTART %q", comp.Value("DTSTART"))
+	}
+	o.onsets = append(o.onsets, start)
+
+	if rrule := comp.Value("RRULE"); rrule != "" {
+		rule, err := recurrence.Parse(rrule, start)
+		if err != nil {
+			return nil, err
+		}
+
+		it := rule.Iterator()
+		// the first onset is DTSTART
+		it.Next()
+		for t, ok := it.Next(); ok && t.Year() <= timezoneHorizon; t, ok = it.Next() {
+			o.onsets = append(o.onsets, t)
+		}
+
+		if rule.Count == 0 && rule.Until.IsZero() {
+			o.rule = rule
+		}
+	}
+
+	for _, prop := range comp.PropertiesNamed("RDATE") {
+		for _, v := range strings.Split(prop.Value, ",") {
+			t, err := time.ParseInLocation("20060102T150405", v, loc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RDATE %q", v)
+			}
+			o.onsets = append(o.onsets, t)
+		}
+	}
+
+	return o, nil
+}
+
+// parseUTCOffset parses an UTC offset such as -0500 or +013045 and returns
+// it in seconds.
+func parseUTCOffset(s string) (int, error) {
+	if (len(s) != 5 && len(s) != 7) || (s[0] != '+' && s[0] != '-') {
+		return 0, fmt.Errorf("invalid UTC offset %q", s)
+	}
+
+	var offset int
+	for i, unit := range []int{3600, 60, 1} {
+		if 1+2*i >= len(s) {
+			break
+		}
+
+		n, err := strconv.Atoi(s[1+2*i : 3+2*i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid UTC offset %q", s)
+		}
+		offset += n * unit
+	}
+
+	if s[0] == '-' {
+		offset = -offset
+	}
+	return offset, nil
+}
+
+type zoneType struct {
+	offset   int
+	daylight bool
+	name     string
+}
+
+type zoneTransition struct {
+	when int64
+	typ  int
+}
+
+// timezoneData returns the given observances in the TZif format, as
+// described in RFC 8536, which is the only way to define a location with
+// changing offsets.
+func timezoneData(observances []*observance) []byte {
+	var (
+		types       []zoneType
+		transitions []zoneTransition
+		first       zoneTransition
+	)
+
+	typeIndex := func(t zoneType) int {
+		for i := 1; i < len(types); i++ {
+			if types[i] == t {
+				return i
+			}
+		}
+		types = append(types, t)
+		return len(types) - 1
+	}
+
+	// the first type is the one before any onset, which must not be used
+	// by any transition
+	types = append(types, zoneType{})
+	for _, o := range observances {
+		typ := typeIndex(zoneType{o.offsetTo, o.daylight, zoneName(o.name, o.offsetTo)})
+		for _, t := range o.onsets {
+			tr := zoneTransition{t.Unix(), typ}
+			transitions = append(transitions, tr)
+			if len(transitions) == 1 || tr.when < first.when {
+				first = tr
+				types[0] = zoneType{o.offsetFrom, false, zoneName("", o.offsetFrom)}
+			}
+		}
+	}
+
+	sort.SliceStable(transitions, func(i, j int) bool {
+		return transitions[i].when < transitions[j].when
+	})
+
+	var chars []byte
+	nameIndex := make([]int, len(types))
+	for i, t := range types {
+		if idx := bytes.Index(chars, []byte(t.name+"\x00")); idx >= 0 {
+			nameIndex[i] = idx
+			continue
+		}
+		nameIndex[i] = len(chars)
+		chars = append(chars, t.name...)
+		chars = append(chars, 0)
+	}
+
+	var buf bytes.Buffer
+	// version 1 header without data, only the version 2 data is used
+	buf.WriteString("TZif2")
+	buf.Write(make([]byte, 15+6*4))
+
+	buf.WriteString("TZif2")
+	buf.Write(make([]byte, 15))
+	counts := []int{0, 0, 0, len(transitions), len(types), len(chars)}
+	for _, n := range counts {
+		binary.Write(&buf, binary.BigEndian, uint32(n))
+	}
+
+	for _, t := range transitions {
+		binary.Write(&buf, binary.BigEndian, t.when)
+	}
+
+	for _, t := range transitions {
+		buf.WriteByte(byte(t.typ))
+	}
+
+	for i, t := range types {
+		binary.Write(&buf, binary.BigEndian, int32(t.offset))
+		if t.daylight {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		buf.WriteByte(byte(nameIndex[i]))
+	}
+
+	buf.Write(chars)
+	buf.WriteString("\n" + posixRule(observances) + "\n")
+	return buf.Bytes()
+}
+
+// zoneName returns the given abbreviation of a time zone if it is valid or
+// one made from its offset otherwise.
+func zoneName(name string, offset int) string {
+	valid := len(name) >= 3
+	for _, r := range name {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '+' || r == '-') {
+			valid = false
+		}
+	}
+
+	if valid {
+		return name
+	}
+
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+
+	if offset%3600 == 0 {
+		return fmt.Sprintf("%c%02d", sign, offset/3600)
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset%3600/60)
+}
+
+// posixRule returns the TZ string of POSIX for the observances that keep
+// repeating forever, which is used for the times after the last computed
+// transition. It is empty if they are not a standard and a daylight
+// observance repeating every year on a given week day of a month, which is
+// the only kind of rule the format supports.
+func posixRule(observances []*observance) string {
+	var std, dst *observance
+	for _, o := range observances {
+		switch {
+		case o.rule == nil:
+			continue
+		case o.daylight && dst == nil:
+			dst = o
+		case !o.daylight && std == nil:
+			std = o
+		default:
+			return ""
+		}
+	}
+
+	if std == nil || dst == nil {
+		return ""
+	}
+
+	stdRule, ok := posixDate(std.rule)
+	if !ok {
+		return ""
+	}
+
+	dstRule, ok := posixDate(dst.rule)
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf(
+		"<%s>%s<%s>%s,%s,%s",
+		zoneName(std.name, std.offsetTo), posixOffset(-std.offsetTo),
+		zoneName(dst.name, dst.offsetTo), posixOffset(-dst.offsetTo),
+		dstRule, stdRule,
+	)
+}
+
+// posixDate returns the onset of a yearly rule in the Mm.w.d/time format
+// of POSIX TZ strings.
+func posixDate(r *recurrence.Recurrence) (string, bool) {
+	if r.Freq != recurrence.Yearly || r.Interval != 1 ||
+		len(r.ByMonth) != 1 || len(r.ByDay) != 1 ||
+		len(r.BySecond)+len(r.ByMinute)+len(r.ByHour)+len(r.ByMonthDay)+
+			len(r.ByYearDay)+len(r.ByWeekNo)+len(r.BySetPos) > 0 {
+		return "", false
+	}
+
+	week := r.ByDay[0].N
+	switch {
+	case week == -1:
+		week = 5
+	case week < 1 || week > 4:
+		return "", false
+	}
+
+	start := r.Start
+	at := start.Hour()*3600 + start.Minute()*60 + start.Second()
+	return fmt.Sprintf("M%d.%d.%d/%s", r.ByMonth[0], week, int(r.ByDay[0].Day), posixOffset(at)), true
+}
+
+func posixOffset(seconds int) string {
+	sign := ""
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	return fmt.Sprintf("%s%d:%02d:%02d", sign, seconds/3600, seconds%3600/60, seconds%60)
+}
+
+// timezoneWindow is the number of years, starting the year before the
+// first time a VTIMEZONE is generated for, whose transitions are looked
+// for in the location to define it.
+const timezoneWindow = 3
+
+// zoneChange is a change of the offset of a location.
+type zoneChange struct {
+	at         time.Time
+	offsetFrom int
+	offsetTo   int
+	name       string
+	daylight   bool
+}
+
+// TimezoneComponent returns a VTIMEZONE component with the given TZID that
+// defines the given location for the times from the given one on, so that
+// calendars can be read by clients that do not know the location, as RFC
+// 5546 requires for iTIP messages. Changes of offset that happen every
+// year, such as daylight saving time, are written as yearly rules.
+func TimezoneComponent(tzid string, loc *time.Location, from time.Time) *Component {
+	c := NewComponent("VTIMEZONE")
+	c.Add(&Property{Name: "TZID", Value: tzid})
+
+	start := time.Date(from.Year()-1, time.January, 1, 0, 0, 0, 0, loc)
+	end := start.AddDate(timezoneWindow, 0, 0)
+	changes := zoneChanges(loc, start, end)
+	if len(changes) == 0 || changes[0].at.After(from) {
+		name, offset := start.Zone()
+		c.Children = append(c.Children, observanceComponent(zoneChange{
+			at:         start,
+			offsetFrom: offset,
+			offsetTo:   offset,
+			name:       name,
+			daylight:   start.IsDST(),
+		}, nil, ""))
+	}
+
+	// changes to the same offset are written as a single observance
+	type key struct {
+		offsetFrom, offsetTo int
+		name                 string
+		daylight             bool
+	}
+
+	var keys []key
+	groups := make(map[key][]zoneChange)
+	for _, change := range changes {
+		k := key{change.offsetFrom, change.offsetTo, change.name, change.daylight}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], change)
+	}
+
+	for _, k := range keys {
+		group := groups[k]
+		rule := yearlyRule(group, end.Year()-1)
+		if rule != "" {
+			group = group[:1]
+		}
+		c.Children = append(c.Children, observanceComponent(group[0], group[1:], rule))
+	}
+
+	return c
+}
+
+// zoneChanges returns the changes of offset of the location between start
+// and end.
+func zoneChanges(loc *time.Location, start, end time.Time) []zoneChange {
+	var result []zoneChange
+	_, offset := start.In(loc).Zone()
+	daylight := start.In(loc).IsDST()
+	same := func(unix int64) bool {
+		t := time.Unix(unix, 0).In(loc)
+		_, o := t.Zone()
+		return o == offset && t.IsDST() == daylight
+	}
+
+	const day = 24 * 3600
+	for t := start.Unix(); t < end.Unix(); t += day {
+		if same(t + day) {
+			continue
+		}
+
+		// the change is at the first second with the new offset
+		lo, hi := t, t+day
+		for hi-lo > 1 {
+			mid := lo + (hi-lo)/2
+			if same(mid) {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+
+		at := time.Unix(hi, 0).In(loc)
+		change := zoneChange{at: at, offsetFrom: offset, daylight: at.IsDST()}
+		change.name, change.offsetTo = at.Zone()
+		result = append(result, change)
+		offset, daylight = change.offsetTo, change.daylight
+	}
+
+	return result
+}
+
+// yearlyRule returns the RRULE of the given changes if there is one every
+// year until the given one on the same week day of the same month, such
+// as the last sunday of March, or an empty string otherwise.
+func yearlyRule(changes []zoneChange, until int) string {
+	if len(changes) < 2 || changes[len(changes)-1].at.Year() != until {
+		return ""
+	}
+
+	first := changes[0].wall()
+	week := (first.Day()-1)/7 + 1
+	candidates := []int{week}
+	if first.AddDate(0, 0, 7).Month() != first.Month() {
+		candidates = append(candidates, -1)
+	}
+
+	for _, week := range candidates {
+		rrule := fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", first.Month(), week, strings.ToUpper(first.Weekday().String()[:2]))
+		rule, err := recurrence.Parse(rrule, first)
+		if err != nil {
+			continue
+		}
+
+		onsets := rule.All(len(changes))
+		matches := len(onsets) == len(changes)
+		for i := 0; matches && i < len(changes); i++ {
+			matches = onsets[i].Equal(changes[i].at)
+		}
+
+		if matches {
+			return rrule
+		}
+	}
+
+	return ""
+}
+
+// wall returns the wall clock time of the change before it happens, which
+// is how the onsets of observances are written.
+func (c zoneChange) wall() time.Time {
+	return c.at.In(time.FixedZone(c.name, c.offsetFrom))
+}
+
+// observanceComponent returns the STANDARD or DAYLIGHT component of the
+// given change, which also happens in the given other changes or every
+// time the rule says if it is not empty.
+func observanceComponent(change zoneChange, others []zoneChange, rrule string) *Component {
+	name := "STANDARD"
+	if change.daylight {
+		name = "DAYLIGHT"
+	}
+
+	c := NewComponent(name)
+	c.Add(&Property{Name: "DTSTART", Value: change.wall().Format("20060102T150405")})
+	if rrule != "" {
+		c.Add(&Property{Name: "RRULE", Value: rrule})
+	}
+
+	for _, other := range others {
+		c.Add(&Property{Name: "RDATE", Value: other.wall().Format("20060102T150405")})
+	}
+
+	c.Add(&Property{Name: "TZOFFSETFROM", Value: formatUTCOffset(change.offsetFrom)})
+	c.Add(&Property{Name: "TZOFFSETTO", Value: formatUTCOffset(change.offsetTo)})
+
+	// abbreviations made from the offset, such as +03, are not names
+	if change.name != "" && change.name[0] != '+' && change.name[0] != '-' {
+		c.Add(&Property{Name: "TZNAME", Value: change.name})
+	}
+
+	return c
+}
+
+// formatUTCOffset returns the given offset in seconds in the format of UTC
+// offsets, such as -0500 or +013045.
+func formatUTCOffset(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+
+	s := fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset%3600/60)
+	if offset%60 != 0 {
+		s += fmt.Sprintf("%02d", offset%60)
+	}
+	return s
+}
@@ -0,0 +1,207 @@
+package ics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var testOutlookTimezone = strings.Join([]string{
+	"BEGIN:VCALENDAR",
+	"BEGIN:VTIMEZONE",
+	"TZID:W. Europe Standard Time",
+	"BEGIN:STANDARD",
+	"DTSTART:16011028T030000",
+	"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10",
+	"TZOFFSETFROM:+0200",
+	"TZOFFSETTO:+0100",
+	"END:STANDARD",
+	"BEGIN:DAYLIGHT",
+	"DTSTART:16010325T020000",
+	"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=3",
+	"TZOFFSETFROM:+0100",
+	"TZOFFSETTO:+0200",
+	"END:DAYLIGHT",
+	"END:VTIMEZONE",
+	"BEGIN:VTIMEZONE",
+	"TZID:/mozilla.org/20050126_1/Asia/Kolkata",
+	"BEGIN:STANDARD",
+	"DTSTART:19700101T000000",
+	"TZOFFSETFROM:+0530",
+	"TZOFFSETTO:+0530",
+	"TZNAME:IST",
+	"END:STANDARD",
+	"END:VTIMEZONE",
+	"BEGIN:VEVENT",
+	"UID:1",
+	`DTSTART;TZID="W. Europe Standard Time":20160704T100000`,
+	`DTEND;TZID="W. Europe Standard Time":20160704T110000`,
+	"END:VEVENT",
+	"BEGIN:VEVENT",
+	"UID:2",
+	"DTSTART;TZID=/mozilla.org/20050126_1/Asia/Kolkata:20160104T100000",
+	"DTEND;TZID=/mozilla.org/20050126_1/Asia/Kolkata:20160104T110000",
+	"END:VEVENT",
+	"BEGIN:VEVENT",
+	"UID:3",
+	"DTSTART;TZID=America/New_York:20160104T100000",
+	"DTEND;TZID=America/New_York:20160104T110000",
+	"END:VEVENT",
+	"END:VCALENDAR",
+}, "\r\n")
+
+func TestParseCustomTimezones(t *testing.T) {
+	cal, err := ParseICalContent(testOutlookTimezone, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]time.Time{
+		"1": time.Date(2016, time.July, 4, 8, 0, 0, 0, time.UTC),
+		"2": time.Date(2016, time.January, 4, 4, 30, 0, 0, time.UTC),
+		"3": time.Date(2016, time.January, 4, 15, 0, 0, 0, time.UTC),
+	}
+
+	if len(cal.Events) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(cal.Events))
+	}
+
+	for _, e := range cal.Events {
+		if !e.Start.Equal(expected[e.ID]) {
+			t.Errorf("expected event %s to start at %s, got %s", e.ID, expected[e.ID], e.Start.UTC())
+		}
+	}
+
+	if _, ok := cal.Timezones["America/New_York"]; ok {
+		t.Errorf("expected timezone not defined in the calendar not to be in its timezones")
+	}
+}
+
+func TestParseInvalidTimezone(t *testing.T) {
+	cal, err := ParseICalContent(strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VTIMEZONE",
+		"TZID:W. Europe Standard Time",
+		"BEGIN:STANDARD",
+		"DTSTART:16011028T030000",
+		"TZOFFSETFROM:+0200",
+		"TZOFFSETTO:one hour",
+		"END:STANDARD",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"UID:1",
+		`DTSTART;TZID="W. Europe Standard Time":20160704T100000`,
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n"), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cal.TimezoneErrors) != 1 {
+		t.Errorf("expected the error of the timezone to be kept, got %v", cal.TimezoneErrors)
+	}
+
+	// the TZID is resolved with its alias instead
+	expected := time.Date(2016, time.July, 4, 8, 0, 0, 0, time.UTC)
+	if len(cal.Events) != 1 || !cal.Events[0].Start.Equal(expected) {
+		t.Errorf("expected event to start at %s, got %v", expected, cal.Events)
+	}
+}
+
+func TestTimezoneTransitions(t *testing.T) {
+	cal, err := ParseICalContent(testOutlookTimezone, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loc, err := cal.Timezones.Location("W. Europe Standard Time")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		t      time.Time
+		offset int
+	}{
+		{time.Date(1700, time.July, 1, 12, 0, 0, 0, time.UTC), 7200},
+		{time.Date(2016, time.January, 1, 12, 0, 0, 0, time.UTC), 3600},
+		{time.Date(2016, time.March, 27, 0, 59, 59, 0, time.UTC), 3600},
+		{time.Date(2016, time.March, 27, 1, 0, 0, 0, time.UTC), 7200},
+		{time.Date(2016, time.October, 30, 0, 59, 59, 0, time.UTC), 7200},
+		{time.Date(2016, time.October, 30, 1, 0, 0, 0, time.UTC), 3600},
+		// after the last computed transition
+		{time.Date(2150, time.July, 1, 12, 0, 0, 0, time.UTC), 7200},
+		{time.Date(2150, time.December, 1, 12, 0, 0, 0, time.UTC), 3600},
+	}
+
+	for _, c := range cases {
+		if _, offset := c.t.In(loc).Zone(); offset != c.offset {
+			t.Errorf("expected offset at %s to be %d, got %d", c.t, c.offset, offset)
+		}
+	}
+}
+
+func TestParseUTCOffset(t *testing.T) {
+	cases := map[string]int{
+		"+0100":   3600,
+		"-0530":   -19800,
+		"+013045": 5445,
+		"-0000":   0,
+	}
+
+	for s, expected := range cases {
+		offset, err := parseUTCOffset(s)
+		if err != nil {
+			t.Errorf("%s: %s", s, err)
+		} else if offset != expected {
+			t.Errorf("expected offset of %s to be %d, got %d", s, expected, offset)
+		}
+	}
+
+	for _, s := range []string{"", "0100", "+1", "+01:00"} {
+		if _, err := parseUTCOffset(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
+
+func TestTimezoneComponent(t *testing.T) {
+	from := time.Date(2016, time.April, 21, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name  string
+		until time.Time
+	}{
+		{"Europe/Madrid", from.AddDate(30, 0, 0)},
+		{"America/New_York", from.AddDate(30, 0, 0)},
+		{"Australia/Sydney", from.AddDate(30, 0, 0)},
+		{"Asia/Kolkata", from.AddDate(30, 0, 0)},
+		// the end of daylight saving time changed every year, so only the
+		// changes until the end of the next year are known
+		{"America/Sao_Paulo", time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		loc, err := time.LoadLocation(c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		generated, err := parseTimezone(TimezoneComponent("Custom/"+c.name, loc, from))
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+
+		if generated.String() != "Custom/"+c.name {
+			t.Errorf("expected location to be named after the TZID, got %s", generated)
+		}
+
+		for at := from; at.Before(c.until); at = at.Add(5 * time.Hour) {
+			_, expected := at.In(loc).Zone()
+			if _, offset := at.In(generated).Zone(); offset != expected {
+				t.Errorf("%s: expected offset at %s to be %d, got %d", c.name, at, expected, offset)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package ics
+
+import (
+	"iter"
+	"time"
+)
+
+// Statuses of a todo.
+const (
+	TodoNeedsAction = "NEEDS-ACTION"
+	TodoInProcess   = "IN-PROCESS"
+	TodoCompleted   = "COMPLETED"
+	TodoCancelled   = "CANCELLED"
+)
+
+// Todo represents a task in the calendar, a VTODO component. Like events,
+// todos with a RecurrenceID override an instance of the repeating todo
+// with the same ID.
+//
+// Start and Due are the instants in which the todo starts and is due,
+// while DTStart and DTDue are the values of DTSTART and DUE as they are
+// in the calendar. PercentComplete is between 0 and 100 and Priority is
+// between 1, the highest, and 9, the lowest, or 0 if it is not defined.
+type Todo struct {
+	Start           time.Time
+	Due             time.Time
+	DTStart         DateTime
+	DTDue           DateTime
+	Completed       time.Time
+	Created         time.Time
+	Modified        time.Time
+	ID              string
+	Status          string
+	Summary         string
+	Description     string
+	Location        string
+	Class           string
+	PercentComplete int
+	Priority        int
+	Sequence        int
+	RRule           string
+	RDates          []time.Time
+	ExDates         []time.Time
+	RecurrenceID    time.Time
+	Attendees       []Attendee
+	Organizer       Attendee
+	Alarms          []Alarm
+
+	// Component is the raw VTODO component the todo was parsed from.
+	Component *Component
+}
+
+// NewTodo returns a new empty Todo entity
+func NewTodo() *Todo {
+	return &Todo{
+		Attendees: []Attendee{},
+	}
+}
+
+// Clone returns an identical clone of the current Todo entity
+func (t *Todo) Clone() *Todo {
+	newTodo := *t
+	return &newTodo
+}
+
+// TodoOccurrence is a single instance of a todo.
+type TodoOccurrence struct {
+	Todo         *Todo
+	Start        time.Time
+	Due          time.Time
+	RecurrenceID time.Time
+}
+
+// Occurrences returns an iterator over the occurrences of the todo that
+// overlap with the time window between from and to, in order, the same way
+// Event.Occurrences does. Occurrences of todos without a start are only
+// placed by their due time, and todos without start nor due time have no
+// occurrences.
+func (t *Todo) Occurrences(from, to time.Time) iter.Seq[TodoOccurrence] {
+	return func(yield func(TodoOccurrence) bool) {
+		anchor := t.Start
+		if anchor.IsZero() {
+			anchor = t.Due
+		}
+
+		if anchor.IsZero() {
+			return
+		}
+
+		var duration time.Duration
+		if !t.Start.IsZero() && !t.Due.IsZero() {
+			duration = t.Due.Sub(t.Start)
+		}
+
+		next := recurrenceStarts(anchor, t.RRule, t.RDates, t.ExDates)
+		for {
+			start, ok := next()
+			if !ok || (!to.IsZero() && !start.Before(to)) {
+				return
+			}
+
+			o := Occurrence{Start: start, End: start.Add(duration)}
+			if !o.overlaps(from, to) {
+				continue
+			}
+
+			todo := TodoOccurrence{Todo: t, RecurrenceID: start}
+			if !t.Start.IsZero() {
+				todo.Start = start
+			}
+			if !t.Due.IsZero() {
+				todo.Due = start.Add(duration)
+			}
+
+			if !yield(todo) {
+				return
+			}
+		}
+	}
+}
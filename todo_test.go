@@ -0,0 +1,178 @@
+package ics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTodos(t *testing.T) {
+	calendar, err := ParseCalendar("testCalendars/todos.ics", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calendar.Events) != 0 {
+		t.Errorf("expected no events, got %d", len(calendar.Events))
+	}
+
+	if len(calendar.Todos) != 3 {
+		t.Fatalf("expected 3 todos, got %d", len(calendar.Todos))
+	}
+
+	berlin := calendar.Timezones["Europe/Berlin"]
+	plants, milk, bank := calendar.Todos[0], calendar.Todos[1], calendar.Todos[2]
+
+	if plants.Summary != "Water the plants" || plants.Status != TodoInProcess || plants.PercentComplete != 40 || plants.Priority != 5 {
+		t.Errorf("unexpected todo %+v", plants)
+	}
+
+	if !plants.Start.Equal(time.Date(2016, time.July, 4, 9, 0, 0, 0, berlin)) || !plants.Due.Equal(time.Date(2016, time.July, 4, 18, 0, 0, 0, berlin)) {
+		t.Errorf("expected todo from 9:00 to 18:00, got %s to %s", plants.Start, plants.Due)
+	}
+
+	if plants.RRule != "FREQ=WEEKLY;COUNT=4" {
+		t.Errorf("expected weekly rule, got %q", plants.RRule)
+	}
+
+	if milk.Description != "Semi-skimmed, two bottles" || milk.Status != TodoCompleted || milk.PercentComplete != 100 {
+		t.Errorf("unexpected todo %+v", milk)
+	}
+
+	if !milk.Completed.Equal(time.Date(2016, time.July, 2, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected completion time, got %s", milk.Completed)
+	}
+
+	if !milk.Start.IsZero() || milk.DTDue.Kind != Date {
+		t.Errorf("expected due date without start, got %s and %+v", milk.Start, milk.DTDue)
+	}
+
+	if bank.Status != TodoNeedsAction || bank.Priority != 1 || !bank.Due.IsZero() {
+		t.Errorf("unexpected todo %+v", bank)
+	}
+}
+
+func TestTodoOccurrences(t *testing.T) {
+	calendar, err := ParseCalendar("testCalendars/todos.ics", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	berlin := calendar.Timezones["Europe/Berlin"]
+	var starts []time.Time
+	for o := range calendar.Todos[0].Occurrences(time.Date(2016, time.July, 10, 0, 0, 0, 0, berlin), time.Time{}) {
+		if o.Due.Sub(o.Start) != 9*time.Hour {
+			t.Errorf("expected occurrence to last 9 hours, got %s", o.Due.Sub(o.Start))
+		}
+		starts = append(starts, o.Start)
+	}
+
+	expected := []time.Time{
+		time.Date(2016, time.July, 11, 9, 0, 0, 0, berlin),
+		time.Date(2016, time.July, 18, 9, 0, 0, 0, berlin),
+		time.Date(2016, time.July, 25, 9, 0, 0, 0, berlin),
+	}
+
+	if len(starts) != len(expected) {
+		t.Fatalf("expected %d occurrences, got %v", len(expected), starts)
+	}
+
+	for i := range expected {
+		if !starts[i].Equal(expected[i]) {
+			t.Errorf("expected occurrence %d to start at %s, got %s", i, expected[i], starts[i])
+		}
+	}
+
+	var count int
+	for o := range calendar.Todos[1].Occurrences(time.Time{}, time.Time{}) {
+		if !o.Start.IsZero() || !o.Due.Equal(calendar.Todos[1].Due) {
+			t.Errorf("expected single occurrence at the due date, got %+v", o)
+		}
+		count++
+	}
+
+	for range calendar.Todos[2].Occurrences(time.Time{}, time.Time{}) {
+		count++
+	}
+
+	if count != 1 {
+		t.Errorf("expected 1 occurrence, got %d", count)
+	}
+}
+
+func TestEncodeTodos(t *testing.T) {
+	calendar, err := ParseCalendar("testCalendars/todos.ics", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := calendar.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []string{
+		"DTSTART;TZID=Europe/Berlin:20160704T090000\r\n",
+		"DUE;VALUE=DATE:20160702\r\n",
+		"COMPLETED:20160702T120000Z\r\n",
+		"PERCENT-COMPLETE:40\r\n",
+		"DESCRIPTION:Semi-skimmed\\, two bottles\r\n",
+	} {
+		if !strings.Contains(buf.String(), e) {
+			t.Errorf("expected output to contain %q:\n%s", e, buf.String())
+		}
+	}
+
+	result, err := ParseICalContent(buf.String(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Todos) != len(calendar.Todos) {
+		t.Fatalf("expected %d todos, got %d", len(calendar.Todos), len(result.Todos))
+	}
+
+	for i, todo := range result.Todos {
+		expected := calendar.Todos[i]
+		if todo.ID != expected.ID || todo.Summary != expected.Summary || todo.Status != expected.Status ||
+			todo.PercentComplete != expected.PercentComplete || todo.Priority != expected.Priority ||
+			!todo.Start.Equal(expected.Start) || !todo.Due.Equal(expected.Due) || !todo.Completed.Equal(expected.Completed) {
+			t.Errorf("expected todo:\n%+v\ngot:\n%+v", expected, todo)
+		}
+	}
+}
+
+func TestRoundTripTodos(t *testing.T) {
+	content, err := ioutil.ReadFile("testCalendars/todos.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calendar, err := ParseICalContent(string(content), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out := encodeRoundTrip(t, &calendar); out != string(content) {
+		t.Errorf("expected output to be identical to the input, got:\n%s", out)
+	}
+
+	calendar.Todos[2].Status = TodoCompleted
+	calendar.Todos[2].PercentComplete = 100
+	calendar.Todos = calendar.Todos[1:]
+
+	out := encodeRoundTrip(t, &calendar)
+	if strings.Contains(out, "Water the plants") {
+		t.Errorf("expected removed todo not to be written")
+	}
+
+	if !strings.Contains(out, "X-APPLE-SORT-ORDER:522673200\r\n") {
+		t.Errorf("expected unknown properties to be kept")
+	}
+
+	if !strings.Contains(out, "STATUS:COMPLETED\r\nPRIORITY:1\r\nPERCENT-COMPLETE:100\r\nEND:VTODO") {
+		t.Errorf("expected modified todo to be written, got:\n%s", out)
+	}
+}
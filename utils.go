@@ -4,8 +4,6 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
-	"regexp"
-	"strings"
 )
 
 const (
@@ -29,34 +27,7 @@ func downloadFromURL(url string) (string, error) {
 	return string(contents), nil
 }
 
-func trimField(field, cutset string) string {
-	re, _ := regexp.Compile(cutset)
-	cutsetRem := re.ReplaceAllString(field, "")
-	return strings.TrimRight(cutsetRem, "\r\n")
-}
-
 func fileExists(fileName string) bool {
 	_, err := os.Stat(fileName)
 	return err == nil
 }
-
-func parseDayNameToIcsName(day string) string {
-	switch day {
-	case "Mon":
-		return "MO"
-	case "Tue":
-		return "TU"
-	case "Wed":
-		return "WE"
-	case "Thu":
-		return "TH"
-	case "Fri":
-		return "FR"
-	case "Sat":
-		return "ST"
-	case "Sun":
-		return "SU"
-	default:
-		return ""
-	}
-}